@@ -1,20 +1,25 @@
 #!/bin/sh
 
+# stop at the first failed build instead of packaging whatever was left over
+set -e
+
 LINUX_ENV="env CGO_ENABLED=0 GOOS=linux GOARCH=amd64"
 WINTURDS_ENV="env CGO_ENABLED=0 GOOS=windows GOARCH=amd64"
-BUILD_CMD=`go build -ldflags '-s -w'`
+VERSION=${VERSION:-`git describe --tags --always 2>/dev/null || echo dev`}
+LDFLAGS="-s -w -X github.com/kthomas422/csgosync/internal/version.Version=$VERSION"
 
 mkdir client server
 cp csgosync.yaml.example client/csgosync.yaml
+cp init/csgosync.service init/csgosync-service.xml client/
 cp csgosyncd.yaml.example server/csgosyncd.yaml
 
-env CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -ldflags '-s -w' -o client/csgosync cmd/client/csgosync.go
-env CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -ldflags '-s -w' -o server/csgosyncd cmd/server/csgosyncd.go
+# build the packages, the client and server are split over several files
+$LINUX_ENV go build -ldflags "$LDFLAGS" -o client/csgosync ./cmd/client
+$LINUX_ENV go build -ldflags "$LDFLAGS" -o server/csgosyncd ./cmd/server
 tar -czvf csgosync-linux-x64.tgz server client
 rm client/csgosync server/csgosyncd
 
-env CGO_ENABLED=0 GOOS=windows GOARCH=amd64 go build -ldflags '-s -w' -o client/csgosync.exe cmd/client/csgosync.go
-env CGO_ENABLED=0 GOOS=windows GOARCH=amd64 go build -ldflags '-s -w' -o server/csgosyncd.exe cmd/server/csgosyncd.go
+$WINTURDS_ENV go build -ldflags "$LDFLAGS" -o client/csgosync.exe ./cmd/client
+$WINTURDS_ENV go build -ldflags "$LDFLAGS" -o server/csgosyncd.exe ./cmd/server
 zip -r csgosync-windows-x64.zip server client
 rm -rf client server
-
@@ -11,8 +11,12 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"sort"
+	"time"
 
 	"github.com/spf13/viper"
 
@@ -20,16 +24,38 @@ import (
 
 	"github.com/kthomas422/csgosync/internal/filelist"
 	"github.com/kthomas422/csgosync/internal/httpclient"
+	"github.com/kthomas422/csgosync/internal/ignore"
 	"github.com/kthomas422/csgosync/internal/models"
+	"github.com/kthomas422/csgosync/internal/output"
 )
 
 func main() {
-	var (
-		files models.FileHashMap
-		err   error
-		errs  []error
-	)
-	fmt.Println("csgo sync client")
+	var err error
+	format := flag.String("output", output.Text, "output format: \"text\" or \"json\" (newline delimited events on stdout)")
+	daemon := flag.Bool("daemon", false, "keep running and sync every SYNC_INTERVAL (can also be set with DAEMON)")
+	library := flag.String("library", "", "library in LIBRARIES to restore backups of instead of MAP_PATH's")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags]            sync MAP_PATH with the server\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] push <file>... upload files to the server (needs UPLOAD_TOKEN)\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] restore [<backup> [file...]] list backups or put files back from one\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] groups            list the server's groups of files for GROUPS\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	out, err := output.New(*format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	config.PromptOutput = out.Human()
+
+	// Nobody is around to press enter when a program is reading our json or we're a service
+	wait := func() {
+		if !out.Json() && !*daemon {
+			config.Wait() // config package already handles user input, this prevents windturds from closing cmd
+		}
+	}
+	out.Println("csgo sync client")
 
 	// Read in config
 	viper.SetConfigFile("csgosync.yaml")
@@ -38,18 +64,51 @@ func main() {
 	// TODO: don't crash and burn on missing file... try from env to be 12 factor
 	err = viper.ReadInConfig()
 	if err != nil {
-		fmt.Println("failed to read config: ", err)
-		config.Wait()
+		out.Println("failed to read config: ", err)
+		wait()
+		os.Exit(1)
+	}
+	clientConfig, err := config.InitClientConfig()
+	if err != nil {
+		out.Println("failed to load config: ", err)
+		wait()
+		os.Exit(1)
+	}
+	httpclient.SetRateLimit(clientConfig.RateLimit, clientConfig.RateBurst)
+	if err = httpclient.SetZstd(clientConfig.Zstd); err != nil {
+		out.Println("failed to find zstd: ", err)
+		wait()
 		os.Exit(1)
 	}
-	clientConfig := config.InitClientConfig()
+	if clientConfig.Chunked {
+		if err = httpclient.SetChunkStore(clientConfig.ChunkPath); err != nil {
+			out.Println("failed to open chunk store: ", err)
+			wait()
+			os.Exit(1)
+		}
+	}
+	*daemon = *daemon || clientConfig.Daemon
+
+	// uploading files, restoring backups or listing groups instead of syncing
+	switch flag.Arg(0) {
+	case "groups":
+		os.Exit(runGroups(clientConfig, out))
+	case "push":
+		os.Exit(runPush(clientConfig, out, flag.Args()[1:]))
+	case "restore":
+		os.Exit(runRestore(clientConfig, *library, out, flag.Args()[1:]))
+	}
+
+	if *daemon {
+		os.Exit(runDaemon(clientConfig, out))
+	}
 
 	// Check certain config params are met
 	if clientConfig.Uri == "" {
 		err = clientConfig.GetUri()
 		if err != nil {
-			fmt.Println("failed to get uri", err)
-			config.Wait()
+			out.Println("failed to get uri", err)
+			wait()
 			os.Exit(1)
 		}
 	}
@@ -57,37 +116,124 @@ func main() {
 	if clientConfig.Pass == "" {
 		err = clientConfig.GetPass()
 		if err != nil {
-			fmt.Println("failed to get password", err)
-			config.Wait()
+			out.Println("failed to get password", err)
+			wait()
 			os.Exit(1)
 		}
 	}
 
+	summary, err := syncAll(clientConfig, out)
+	if err != nil {
+		out.Println(err)
+		wait()
+		os.Exit(1)
+	}
+	wait()
+	if summary.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// syncAll syncs the map directory and then every library into its own directory, the summary adds
+// them all up. A library that fails doesn't stop the rest, the first error is returned.
+func syncAll(c *config.ClientConfig, out *output.Output) (models.Summary, error) {
+	summary, err := syncMaps(c, out)
+	names := make([]string, 0, len(c.Libraries))
+	for name := range c.Libraries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lc := c.Library(name)
+		lc.Uri = httpclient.Library(c.Uri, name)
+		out.Printf("syncing library %s into %s\n", name, lc.MapPath)
+		s, libErr := syncMaps(lc, out)
+		if libErr != nil {
+			libErr = fmt.Errorf("library %s: %w", name, libErr)
+			out.Println(libErr)
+			if err == nil {
+				err = libErr
+			}
+		}
+		summary.Needed += s.Needed
+		summary.Downloaded += s.Downloaded
+		summary.Uploaded += s.Uploaded
+		summary.Conflicts += s.Conflicts
+		summary.Failed += s.Failed
+		summary.FailedFiles = append(summary.FailedFiles, s.FailedFiles...)
+		summary.Bytes += s.Bytes
+	}
+	return summary, err
+}
+
+// syncMaps does a single sync of the map directory with the server
+func syncMaps(c *config.ClientConfig, out *output.Output) (models.Summary, error) {
+	var (
+		files   models.FileHashMap
+		errs    []error
+		summary models.Summary
+	)
+
+	// replaced files are backed up in the directory they came from
+	if c.Backups {
+		httpclient.SetBackups(backupStore(c))
+	}
+
+	// Find out what the server supports before hashing anything
+	if _, err := httpclient.Negotiate(c.Uri); err != nil {
+		return summary, err
+	}
+	// rather not download every file when only some were wanted
+	if len(c.Groups) > 0 && !httpclient.Supports(models.FeatureGroups) {
+		return summary, httpclient.ErrNoGroups
+	}
+	files.Groups = c.Groups
+
 	// Create the hash map of our files and send to server
-	fmt.Println("generating hash map...")
-	files.Files, errs = filelist.GenerateMap(clientConfig.MapPath)
+	out.Emit(models.Event{Type: models.EventHashStart, Dir: c.MapPath})
+	start := time.Now()
+	matcher, err := ignore.Load(c.MapPath, c.Include, c.Exclude)
+	if err != nil {
+		return summary, err
+	}
+	files.Files, errs = filelist.GenerateMap(c.MapPath, matcher)
 	if len(errs) > 0 {
 		for _, err := range errs {
-			fmt.Println("error creating hash map:", err)
+			out.Println("error creating hash map:", err)
 		}
-		config.Wait()
-		os.Exit(1)
+		return summary, errors.New("failed to create hash map")
 	}
+	out.Emit(models.Event{
+		Type:    models.EventHashDone,
+		Dir:     c.MapPath,
+		Count:   len(files.Files),
+		Elapsed: time.Since(start).Seconds(),
+	})
 
-	fmt.Println("sending hashmap to server")
-	resp, err := httpclient.SendServerHashes(clientConfig.Uri+"/csgosync", clientConfig.Pass, files)
+	out.Println("sending hashmap to server")
+	resp, err := httpclient.SendServerHashes(c.Uri, c.Pass, files)
 	if err != nil {
-		fmt.Println("failed to get files list from server ", err)
-		fmt.Println(resp)
-		config.Wait()
-		os.Exit(1)
+		return summary, fmt.Errorf("failed to get files list from server: %w", err)
 	}
+	// we didn't send the files we ignore so the server thinks we need them, leave them alone
+	resp.Files = matcher.Filter(resp.Files)
+	retireFiles(c, out, files.Files, resp.Retired)
+	if c.TwoWay {
+		if httpclient.Supports(models.FeatureUpload) {
+			summary, err = syncTwoWay(c, out, files.Files, resp)
+			out.Emit(models.Event{Type: models.EventSummary, Summary: &summary})
+			return summary, err
+		}
+		out.Println("server doesn't take uploads, only downloading")
+	}
+	out.Emit(models.Event{Type: models.EventDiff, Files: resp.Files, Count: len(resp.Files)})
+	summary.Generation = resp.Generation
+
 	// Download the missing/different files from server (if any)
 	if len(resp.Files) != 0 {
-		fmt.Printf("downloading %d files from server...\n", len(resp.Files))
-		httpclient.DownloadFiles(clientConfig.Uri, clientConfig.Pass, clientConfig.MapPath, resp.Files)
-	} else {
-		fmt.Println("nothing to do, already have server's maps")
+		summary = httpclient.DownloadFiles(c.Uri, c.Pass, c.MapPath, resp, out)
+		summary.Generation = resp.Generation
 	}
-	config.Wait() // config package already handles user input, this prevents windturds from closing cmd
+	out.Emit(models.Event{Type: models.EventSummary, Summary: &summary})
+	return summary, nil
 }
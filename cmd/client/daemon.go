@@ -0,0 +1,139 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/cmd/client/daemon.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the client's daemon mode which keeps the maps in sync on an interval.
+*/
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/kthomas422/csgosync/config"
+	"github.com/kthomas422/csgosync/internal/csgolog"
+	"github.com/kthomas422/csgosync/internal/httpclient"
+	"github.com/kthomas422/csgosync/internal/output"
+)
+
+const (
+	minBackoff       = time.Second * 10 // How long to wait before retrying when the server can't be reached, doubles on every failure
+	maxEventsBackoff = time.Minute * 5  // Longest to wait before reconnecting to the event stream
+)
+
+// runDaemon syncs every interval until it gets told to stop and returns the exit code
+func runDaemon(c *config.ClientConfig, out *output.Output) int {
+	l, err := csgolog.InitLogger(c.LogFile)
+	if err != nil {
+		log.Printf("could not start logger: %v\n", err)
+		return 1
+	}
+	defer func() {
+		if err := l.Close(); err != nil {
+			log.Printf("error closing log file: %v\n", err)
+		}
+	}()
+	out.SetLogger(l)
+
+	// there is no one to prompt as a daemon
+	if c.Uri == "" || c.Pass == "" {
+		l.Err("missing config: ", fmt.Errorf("URI and PASSWORD must be set to run as a daemon"))
+		return 1
+	}
+	l.Simple(fmt.Sprintf("syncing %s from %s every %v", c.MapPath, c.Uri, c.Interval))
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	// sync as soon as the server says its files changed instead of waiting for the interval
+	gens := make(chan uint64)
+	stopEvents := make(chan struct{})
+	defer close(stopEvents)
+	if c.Events {
+		go watchEvents(c, l, gens, stopEvents)
+	}
+
+	var synced uint64 // generation of the server's files we last synced with
+	backoff := minBackoff
+	for {
+		next := c.Interval
+		summary, err := syncAll(c, out)
+		switch {
+		case err != nil:
+			l.Err("sync failed: ", err)
+			next, backoff = backoff, nextBackoff(backoff, c.Interval)
+		case summary.Failed > 0:
+			l.Err("sync incomplete: ", fmt.Errorf("%d of %d files failed to download", summary.Failed, summary.Needed))
+			next, backoff = backoff, nextBackoff(backoff, c.Interval)
+		default:
+			backoff = minBackoff
+			synced = summary.Generation
+		}
+		l.Simple(fmt.Sprintf("next sync in %v", next))
+
+		timer := time.NewTimer(next)
+	wait:
+		for {
+			select {
+			case <-timer.C:
+				break wait
+			case gen := <-gens:
+				if gen != synced {
+					l.Simple(fmt.Sprintf("server files changed (generation: %d), syncing now", gen))
+					timer.Stop()
+					break wait
+				}
+			case sig := <-stop:
+				l.Simple(fmt.Sprintf("got %v, shutting down", sig))
+				timer.Stop()
+				return 0
+			}
+		}
+	}
+}
+
+// watchEvents stays subscribed to the server's event stream, reconnecting with a backoff when it
+// drops, until stop is closed or the server turns out to not support events
+func watchEvents(c *config.ClientConfig, l *csgolog.CsgoLogger, gens chan<- uint64, stop <-chan struct{}) {
+	backoff := minBackoff
+	for {
+		start := time.Now()
+		err := httpclient.Subscribe(c.Uri, c.Pass, gens, stop)
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		if err == httpclient.ErrNoEvents {
+			l.Simple("server doesn't support events, only syncing every interval")
+			return
+		}
+		if time.Since(start) > maxEventsBackoff {
+			backoff = minBackoff // stream was up for a while, this isn't a repeated failure
+		}
+		l.Err(fmt.Sprintf("event stream dropped, reconnecting in %v: ", backoff), err)
+		select {
+		case <-time.After(backoff):
+		case <-stop:
+			return
+		}
+		backoff = nextBackoff(backoff, maxEventsBackoff)
+	}
+}
+
+// nextBackoff doubles the backoff without going over the sync interval
+func nextBackoff(backoff, max time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/cmd/client/groups.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the groups command which lists the groups of files that can be put in GROUPS.
+*/
+
+package main
+
+import (
+	"github.com/kthomas422/csgosync/config"
+	"github.com/kthomas422/csgosync/internal/httpclient"
+	"github.com/kthomas422/csgosync/internal/models"
+	"github.com/kthomas422/csgosync/internal/output"
+)
+
+// runGroups lists the server's groups and returns the exit code
+func runGroups(c *config.ClientConfig, out *output.Output) int {
+	if c.Uri == "" {
+		if err := c.GetUri(); err != nil {
+			out.Println("failed to get uri", err)
+			return 1
+		}
+	}
+	if c.Pass == "" {
+		if err := c.GetPass(); err != nil {
+			out.Println("failed to get password", err)
+			return 1
+		}
+	}
+	if _, err := httpclient.Negotiate(c.Uri); err != nil {
+		out.Println(err)
+		return 1
+	}
+	groups, err := httpclient.Groups(c.Uri, c.Pass)
+	if err != nil {
+		out.Println("failed to get groups: ", err)
+		return 1
+	}
+	if len(groups) == 0 {
+		out.Println("the server doesn't have any groups")
+	}
+	for i := range groups {
+		out.Emit(models.Event{Type: models.EventGroup, Group: &groups[i]})
+	}
+	return 0
+}
@@ -0,0 +1,64 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/cmd/client/push.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the push command which uploads maps to the server.
+*/
+
+package main
+
+import (
+	"github.com/kthomas422/csgosync/config"
+	"github.com/kthomas422/csgosync/internal/httpclient"
+	"github.com/kthomas422/csgosync/internal/models"
+	"github.com/kthomas422/csgosync/internal/output"
+)
+
+// runPush uploads the files to the server with UPLOAD_TOKEN and returns the exit code
+func runPush(c *config.ClientConfig, out *output.Output, files []string) int {
+	if len(files) == 0 {
+		out.Println("usage: csgosync push <file>...")
+		return 2
+	}
+	if c.Uri == "" {
+		if err := c.GetUri(); err != nil {
+			out.Println("failed to get uri", err)
+			return 1
+		}
+	}
+	token := c.Token
+	if token == "" {
+		if c.Pass == "" {
+			if err := c.GetPass(); err != nil {
+				out.Println("failed to get password", err)
+				return 1
+			}
+		}
+		token = c.Pass // only works if it's really a token with the upload scope
+	}
+
+	if _, err := httpclient.Negotiate(c.Uri); err != nil {
+		out.Println(err)
+		return 1
+	}
+	failed := 0
+	for _, file := range files {
+		uploaded, err := httpclient.Upload(c.Uri, token, file, out)
+		if err != nil {
+			failed++
+			out.Emit(models.Event{Type: models.EventFileFailed, File: file, Error: err.Error()})
+			continue
+		}
+		out.Emit(models.Event{Type: models.EventFileUploaded, File: uploaded.File, Bytes: uploaded.Size})
+		if uploaded.Replaced {
+			out.Printf("replaced the server's copy of %s, it's in generation %d\n", uploaded.File, uploaded.Generation)
+		}
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/cmd/client/restore.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the restore command which lists the backups of files syncs replaced and
+	puts them back.
+*/
+
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/kthomas422/csgosync/config"
+	"github.com/kthomas422/csgosync/internal/backup"
+	"github.com/kthomas422/csgosync/internal/models"
+	"github.com/kthomas422/csgosync/internal/output"
+)
+
+// backupStore returns where the files a sync of c.MapPath replaces are backed up
+func backupStore(c *config.ClientConfig) *backup.Store {
+	return backup.New(filepath.Join(c.MapPath, config.StateDir, "backup"), c.MapPath, c.BackupKeep, c.BackupAge)
+}
+
+// runRestore lists the backups of MAP_PATH (or the library's directory) with no args, otherwise
+// restores the files (all of them if none) from the backup and returns the exit code
+func runRestore(c *config.ClientConfig, library string, out *output.Output, args []string) int {
+	if library != "" {
+		if _, ok := c.Libraries[library]; !ok {
+			out.Printf("library %s isn't in LIBRARIES\n", library)
+			return 2
+		}
+		c = c.Library(library)
+	}
+	store := backupStore(c)
+	if len(args) == 0 {
+		backups, err := store.List()
+		if err != nil {
+			out.Println(err)
+			return 1
+		}
+		if len(backups) == 0 {
+			out.Println("no backups")
+		}
+		for _, b := range backups {
+			out.Emit(models.Event{Type: models.EventBackup, Time: b.Time, Backup: b.ID, Files: b.Files})
+		}
+		return 0
+	}
+
+	restored, err := store.Restore(args[0], args[1:]...)
+	for _, file := range restored {
+		out.Emit(models.Event{Type: models.EventFileRestored, File: file, Backup: args[0]})
+	}
+	if err != nil {
+		out.Println("failed to restore: ", err)
+		return 1
+	}
+	if len(restored) > 0 {
+		out.Println("the next sync downloads the server's copies again unless TWO_WAY is on")
+	}
+	return 0
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/cmd/client/retire.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains getting rid of files the server retired.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/kthomas422/csgosync/config"
+	"github.com/kthomas422/csgosync/internal/models"
+	"github.com/kthomas422/csgosync/internal/output"
+)
+
+// retireFiles archives or removes our copies of files the server retired and takes them out of
+// local. Copies that aren't the one the server deleted changed here, those are never touched.
+func retireFiles(c *config.ClientConfig, out *output.Output, local map[string]string, retired map[string]models.Tombstone) {
+	for _, file := range sortedNames(retired) {
+		ts := retired[file]
+		if local[file] != ts.Hash {
+			out.Printf("kept %s, the server retired it but it changed here since it was synced\n", file)
+			continue
+		}
+		src := filepath.Join(c.MapPath, file)
+		var err error
+		switch c.Retired {
+		case config.RetiredKeep:
+			continue
+		case config.RetiredRemove:
+			err = os.Remove(src)
+		default:
+			dir := filepath.Join(c.MapPath, config.StateDir, "retired")
+			if err = os.MkdirAll(dir, 0755); err == nil {
+				err = os.Rename(src, filepath.Join(dir, file))
+			}
+		}
+		if err != nil {
+			out.Printf("failed to retire %s: %v\n", file, err)
+			continue
+		}
+		delete(local, file)
+		out.Emit(models.Event{Type: models.EventFileRetired, File: file})
+	}
+}
+
+func sortedNames(retired map[string]models.Tombstone) []string {
+	names := make([]string, 0, len(retired))
+	for name := range retired {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/cmd/client/twoway.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the client's two way sync which uploads files that changed here too.
+*/
+
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/kthomas422/csgosync/config"
+	"github.com/kthomas422/csgosync/internal/httpclient"
+	"github.com/kthomas422/csgosync/internal/models"
+	"github.com/kthomas422/csgosync/internal/output"
+	"github.com/kthomas422/csgosync/internal/twoway"
+)
+
+// syncTwoWay downloads what changed on the server and uploads what changed here since the last
+// two way sync, files that changed on both sides are settled with CONFLICT_POLICY
+func syncTwoWay(c *config.ClientConfig, out *output.Output, local map[string]string, resp *models.FileResponse) (models.Summary, error) {
+	summary := models.Summary{Generation: resp.Generation}
+	basePath := filepath.Join(c.MapPath, config.StateDir, "base.json")
+	base, err := twoway.LoadBase(basePath, c.Uri)
+	if err != nil {
+		return summary, err
+	}
+	plan := twoway.MakePlan(local, base.Files, resp, c.Conflicts, time.Now())
+	renameErrs := plan.Rename(c.MapPath)
+	for _, err := range renameErrs {
+		out.Println(err)
+	}
+	for i := range plan.Conflicts {
+		out.Emit(models.Event{Type: models.EventConflict, File: plan.Conflicts[i].File, Conflict: &plan.Conflicts[i]})
+	}
+	for _, file := range plan.Removed {
+		out.Printf("%s was removed from the server, not uploading it\n", file)
+	}
+
+	out.Emit(models.Event{Type: models.EventDiff, Files: plan.Download, Count: len(plan.Download)})
+	if len(plan.Download) != 0 {
+		download := *resp
+		download.Files = plan.Download
+		summary = httpclient.DownloadFiles(c.Uri, c.Pass, c.MapPath, &download, out)
+		summary.Generation = resp.Generation
+	}
+	failed := make(map[string]bool)
+	for _, file := range summary.FailedFiles {
+		failed[file] = true
+	}
+
+	token := c.Token
+	if token == "" {
+		token = c.Pass // only works if it's a token with both scopes
+	}
+	for _, file := range plan.Upload {
+		uploaded, err := httpclient.Upload(c.Uri, token, filepath.Join(c.MapPath, file), out)
+		if err != nil {
+			failed[file] = true
+			var serr *models.Error
+			if errors.As(err, &serr) && serr.Code == models.ErrCodeUnsupportedType {
+				out.Printf("not uploading %s, the server doesn't take files like it\n", file)
+				continue
+			}
+			summary.Failed++
+			summary.FailedFiles = append(summary.FailedFiles, file)
+			out.Emit(models.Event{Type: models.EventFileFailed, File: file, Error: err.Error()})
+			continue
+		}
+		summary.Uploaded++
+		if uploaded.Generation > summary.Generation {
+			summary.Generation = uploaded.Generation // so the daemon doesn't sync again for our own upload
+		}
+		out.Emit(models.Event{Type: models.EventFileUploaded, File: uploaded.File, Bytes: uploaded.Size})
+	}
+	summary.Conflicts = len(plan.Conflicts)
+	summary.Failed += len(renameErrs)
+
+	base.Files = plan.NextBase(local, base.Files, resp, failed)
+	if err := base.Save(basePath); err != nil {
+		return summary, err
+	}
+	return summary, nil
+}
@@ -18,14 +18,16 @@ import (
 	"time"
 
 	"github.com/kthomas422/csgosync/internal/csgolog"
-
-	"github.com/kthomas422/csgosync/internal/filelist"
+	"github.com/kthomas422/csgosync/internal/fastdl"
+	"github.com/kthomas422/csgosync/internal/firewall"
 
 	"github.com/kthomas422/csgosync/config"
 
 	"github.com/spf13/viper"
 
 	"github.com/kthomas422/csgosync/internal/httpserver"
+	"github.com/kthomas422/csgosync/internal/tokens"
+	"github.com/kthomas422/csgosync/internal/version"
 )
 
 func main() {
@@ -41,14 +43,17 @@ func main() {
 	if err != nil {
 		log.Fatal("failed to get config file: ", err)
 	}
-	cs.C = config.InitServerConfig()
+	cs.C, err = config.InitServerConfig()
+	if err != nil {
+		log.Fatal("failed to load config: ", err)
+	}
 
 	// init logger
 	cs.L, err = csgolog.InitLogger(cs.C.LogFile)
 	if err != nil {
 		log.Fatalf("could not start logger: %v\n", err)
 	}
-	cs.L.Simple("CSGO Sync Server!")
+	cs.L.Simple(fmt.Sprintf("CSGO Sync Server %s (protocol %d)", version.Version, version.Protocol))
 
 	// Make sure we close the log file
 	defer func() {
@@ -71,56 +76,166 @@ func main() {
 		log.Fatalf("could not write to logger: %v", err)
 	}
 
-	// Generate hash map (and regenerate every so often)
-	// Timing how long it takes to get the map as well
-	go func() {
-		var errs []error
-		for {
-			cs.L.Simple("generating hash map")
-			start := time.Now()
-			cs.HashMap, errs = filelist.GenerateMap(cs.C.MapPath)
-			if len(errs) > 0 {
-				for _, err := range errs {
-					cs.L.Err("failed getting hashmap", err)
-				}
-				os.Exit(1) // crash and burn since we can't make maps
-			}
-			elapsed := time.Since(start)
-			cs.L.Simple(fmt.Sprintf("hash map generated in %v", elapsed))
-			if err != nil {
-				cs.L.Err("couldn't load server maps: ", err)
-			}
-			cs.L.Simple(fmt.Sprintf("files list: %v", cs.HashMap))
-			time.Sleep(time.Hour * 24 * 7) // regenerate hash map every week TODO: set this as config
+	// FastDL mirror gets updated every time the hash map is generated
+	if cs.C.FastDLPath != "" {
+		cs.FastDL, err = fastdl.NewMirror(cs.C.MapPath, cs.C.FastDLPath, cs.C.Bzip2)
+		if err != nil {
+			cs.L.Err("failed to create fastdl mirror: ", err)
+			os.Exit(1)
 		}
-	}()
+		cs.L.Simple(fmt.Sprintf("fastdl mirror of %s in %s served at /fastdl/maps/", cs.C.MapPath, cs.C.FastDLPath))
+	}
 
-	// Handler for serving map files
-	// TODO add auth to file server
-	http.Handle("/maps/", http.StripPrefix(
-		"/maps/", http.FileServer(http.Dir(cs.C.MapPath))))
+	// Compressed maps are cached on disk so they're only compressed once
+	if cs.C.CompressCache != "" {
+		cs.Compress, err = httpserver.NewCompressCache(cs.C.CompressCache, cs.C.Zstd)
+		if err != nil {
+			cs.L.Err("failed to create compression cache: ", err)
+			os.Exit(1)
+		}
+		cs.L.Simple(fmt.Sprintf("compressing maps with %v in %s", cs.Compress.Encodings(), cs.C.CompressCache))
+	}
 
-	// Handler for map hashes
-	http.Handle("/csgosync", &cs)
+	// Api tokens that can be used instead of the password
+	cs.Tokens, err = tokens.Open(cs.C.TokensFile)
+	if err != nil {
+		cs.L.Err("failed to load tokens: ", err)
+		os.Exit(1)
+	}
 
-	// Catchall handler
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		cs.L.WebRequest(r)
-		w.WriteHeader(http.StatusNotFound)
-		_, err = w.Write([]byte("{ \"Message\": \"Not found\"}"))
+	// Allow/deny lists, per ip request limits and bans for failed logins
+	cs.Firewall = firewall.New(firewall.Config{
+		Allow:         cs.C.AllowIPs,
+		Deny:          cs.C.DenyIPs,
+		Rate:          cs.C.RequestRate,
+		Burst:         cs.C.RequestBurst,
+		MaxFailures:   cs.C.MaxAuthFailures,
+		FailureWindow: cs.C.AuthFailWindow,
+		BanTime:       cs.C.BanTime,
+	})
+
+	// Groups of files clients can subscribe to
+	cs.Groups, err = httpserver.NewGroups(cs.C.Groups)
+	if err != nil {
+		cs.L.Err("failed to load groups: ", err)
+		os.Exit(1)
+	}
+
+	// Start counting before anything happens worth counting
+	if cs.C.Metrics {
+		cs.InitMetrics()
+	}
+
+	// Generate hash map (and regenerate every refresh interval)
+	cs.Manifest, err = httpserver.LoadManifest(cs.C.ManifestFile)
+	if err != nil {
+		cs.L.Err("failed to load manifest: ", err)
+		os.Exit(1)
+	}
+	go cs.RefreshLoop(func() { os.Exit(1) })
+
+	// Other directories served next to the maps, each with its own hash map
+	for _, lc := range cs.C.Libraries {
+		lib, err := cs.NewLibrary(lc)
 		if err != nil {
-			cs.L.Err("failed to write back to client: ", err)
+			cs.L.Err("failed to load library: ", err)
+			os.Exit(1)
 		}
-	})
+		cs.Libraries = append(cs.Libraries, lib)
+		cs.L.Simple(fmt.Sprintf("serving library %s from %s at /v1/libraries/%s/", lc.Name, lc.MapPath, lc.Name))
+		go lib.RefreshLoop(func() { os.Exit(1) })
+	}
+
+	routes(http.DefaultServeMux, &cs, "")
+	for _, lib := range cs.Libraries {
+		routes(http.DefaultServeMux, lib, httpserver.LibraryPrefix+lib.Library)
+	}
+
+	// Handler for the FastDL mirror (sv_downloadurl "http://<server>/fastdl"), game clients can't
+	// send a password so it's open
+	if cs.FastDL != nil {
+		http.Handle("/fastdl/maps/", httpserver.Route("/fastdl/maps/", http.StripPrefix(
+			"/fastdl/maps/", http.FileServer(http.Dir(cs.FastDL.Files())))))
+	}
+
+	// Dashboard for admins (needs ADMIN_PASSWORD)
+	http.Handle("/admin/", httpserver.Route("/admin/", http.HandlerFunc(cs.Dashboard)))
+
+	// Handlers for load balancers and orchestrators, not under /v1 since they aren't for clients
+	http.Handle("/healthz", httpserver.Route("/healthz", http.HandlerFunc(cs.Healthz)))
+	http.Handle("/readyz", httpserver.Route("/readyz", http.HandlerFunc(cs.Readyz)))
+
+	// Handler for prometheus
+	if cs.Metrics != nil {
+		http.Handle("/metrics", httpserver.Route("/metrics", http.HandlerFunc(cs.ServeMetrics)))
+	}
+
+	// Catchall handler
+	http.HandleFunc("/", cs.NotFound)
 
 	// Create web server and run it
 	s := http.Server{
-		ReadTimeout:       time.Second * 10,
+		ReadTimeout:       httpserver.ReadTimeout, // uploads get longer
 		ReadHeaderTimeout: time.Second * 10,
-		WriteTimeout:      time.Minute * 10, // hopefully files don't take longer than 10 minutes to download
+		WriteTimeout:      httpserver.WriteTimeout, // throttled downloads get longer
 		IdleTimeout:       time.Second * 30,
 		Addr:              ":" + cs.C.Port,
+		Handler:           cs.AccessLog(cs.Filter(cs.Throttle(http.DefaultServeMux))),
+		ConnContext:       cs.ConnContext,
 	}
 
 	cs.L.Err("server shutdown response:", s.ListenAndServe())
 }
+
+// routes adds the api handlers of cs to mux under /v1 and prefix
+func routes(mux *http.ServeMux, cs *httpserver.CsgoSync, prefix string) {
+	// Every api handler is at /v1/... and, for clients from before there was a /v1, at its old path.
+	// Both are counted as the /v1 route in the metrics. Libraries are only at /v1/libraries/<name>/...
+	route := func(legacy, v1 string, h http.Handler) {
+		h = httpserver.Route("/v1"+prefix+v1, h)
+		if legacy != "" && prefix == "" {
+			mux.Handle(legacy, h)
+		}
+		mux.Handle("/v1"+prefix+v1, http.StripPrefix("/v1"+prefix, h))
+	}
+
+	// Handler telling clients what we support
+	route("", "/info", http.HandlerFunc(cs.Info))
+
+	// Handler for serving map files
+	route("/maps/", "/maps/", cs.Maps())
+
+	// Handler for map hashes, clients from before /v1 can't compare their hashes to ours
+	route("", "/sync", cs)
+	if prefix == "" {
+		mux.Handle("/csgosync", httpserver.Route("/csgosync", http.HandlerFunc(cs.Outdated)))
+	}
+
+	// Handler for the groups of files clients can subscribe to
+	route("", "/groups", http.HandlerFunc(cs.GroupList))
+
+	// Handler for sending only the changed blocks of maps
+	route("/delta/", "/delta/", http.HandlerFunc(cs.Delta))
+
+	// Handlers for the chunked manifest and chunks by hash
+	route("/chunks/", "/chunks/", http.HandlerFunc(cs.Chunks))
+	route("/chunk/", "/chunk/", http.HandlerFunc(cs.Chunk))
+
+	// Handler for downloading many small files at once
+	route("/bundle", "/bundle", http.HandlerFunc(cs.Bundle))
+
+	// Handler for uploading files (needs a token with the upload scope)
+	route("", "/files/", http.HandlerFunc(cs.Upload))
+
+	// Handler for telling clients when the map hashes change
+	route("/events", "/events", http.HandlerFunc(cs.Events))
+
+	// Handlers for admins (need ADMIN_PASSWORD)
+	route("", "/admin/firewall", http.HandlerFunc(cs.AdminFirewall))
+	route("", "/admin/bans/", http.HandlerFunc(cs.AdminBans))
+	route("", "/admin/status", http.HandlerFunc(cs.AdminStatus))
+	route("", "/admin/rescan", http.HandlerFunc(cs.AdminRescan))
+	route("", "/admin/tokens", http.HandlerFunc(cs.AdminTokens))
+	route("", "/admin/tokens/", http.HandlerFunc(cs.AdminToken))
+	route("", "/admin/files/", http.HandlerFunc(cs.AdminRetire))
+}
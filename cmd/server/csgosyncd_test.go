@@ -0,0 +1,166 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/cmd/server/csgosyncd_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the routes of the server binary.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/kthomas422/csgosync/config"
+	"github.com/kthomas422/csgosync/internal/csgolog"
+	"github.com/kthomas422/csgosync/internal/httpserver"
+	"github.com/kthomas422/csgosync/internal/tokens"
+)
+
+// writeFiles puts the files in a new directory
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// newTestMux returns the routes of a server with a sounds library that has its own password
+func newTestMux(t *testing.T) (*http.ServeMux, *httpserver.CsgoSync) {
+	t.Helper()
+	state := t.TempDir()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("MAP_PATH", writeFiles(t, map[string]string{"de_a.bsp": "map"}))
+	viper.Set("PASSWORD", "pass")
+	viper.Set("TOKENS_FILE", filepath.Join(state, "tokens.json"))
+	viper.Set("MANIFEST_FILE", filepath.Join(state, "manifest.json"))
+	viper.Set("LIBRARIES", map[string]interface{}{"sounds": map[string]interface{}{
+		"MAP_PATH": writeFiles(t, map[string]string{"a.wav": "wav"}),
+		"PASSWORD": "soundpass",
+	}})
+	c, err := config.InitServerConfig()
+	if err != nil {
+		t.Fatal("config: ", err)
+	}
+	l, err := csgolog.InitLogger(filepath.Join(state, "csgosyncd.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	cs := &httpserver.CsgoSync{L: l, C: c}
+	if cs.Tokens, err = tokens.Open(c.TokensFile); err != nil {
+		t.Fatal(err)
+	}
+	if cs.Manifest, err = httpserver.LoadManifest(c.ManifestFile); err != nil {
+		t.Fatal(err)
+	}
+	if errs := cs.Refresh(); len(errs) > 0 {
+		t.Fatal("refresh: ", errs)
+	}
+	for _, lc := range c.Libraries {
+		lib, err := cs.NewLibrary(lc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if errs := lib.Refresh(); len(errs) > 0 {
+			t.Fatal("refresh ", lc.Name, ": ", errs)
+		}
+		cs.Libraries = append(cs.Libraries, lib)
+	}
+
+	mux := http.NewServeMux()
+	routes(mux, cs, "")
+	for _, lib := range cs.Libraries {
+		routes(mux, lib, httpserver.LibraryPrefix+lib.Library)
+	}
+	return mux, cs
+}
+
+func TestLibraryRoutes(t *testing.T) {
+	mux, cs := newTestMux(t)
+	tests := []struct {
+		method, path, pass string
+		status             int
+		body               string // what the body has in it
+	}{
+		{http.MethodGet, "/v1/info", "", http.StatusOK, `"libraries":["sounds"]`},
+		{http.MethodGet, "/v1/libraries/sounds/info", "", http.StatusOK, `"library":"sounds"`},
+		{http.MethodPost, "/v1/sync", "pass", http.StatusOK, `"files":["de_a.bsp"]`},
+		{http.MethodPost, "/csgosync", "pass", http.StatusGone, ""},
+		{http.MethodPost, "/v1/libraries/sounds/sync", "soundpass", http.StatusOK, `"files":["a.wav"]`},
+		{http.MethodPost, "/v1/libraries/sounds/sync", "pass", http.StatusUnauthorized, ""},
+		{http.MethodPost, "/v1/sync", "soundpass", http.StatusUnauthorized, ""},
+		{http.MethodGet, "/v1/maps/de_a.bsp", "pass", http.StatusOK, "map"},
+		{http.MethodGet, "/maps/de_a.bsp", "pass", http.StatusOK, "map"},
+		{http.MethodGet, "/v1/libraries/sounds/maps/a.wav", "soundpass", http.StatusOK, "wav"},
+		{http.MethodGet, "/v1/libraries/sounds/maps/de_a.bsp", "soundpass", http.StatusNotFound, ""},
+		{http.MethodGet, "/v1/maps/a.wav", "pass", http.StatusNotFound, ""},
+		// downloads need the password of what they're downloading from
+		{http.MethodGet, "/v1/maps/de_a.bsp", "", http.StatusUnauthorized, ""},
+		{http.MethodGet, "/maps/de_a.bsp", "", http.StatusUnauthorized, ""},
+		{http.MethodGet, "/v1/libraries/sounds/maps/a.wav", "", http.StatusUnauthorized, ""},
+		{http.MethodGet, "/v1/libraries/sounds/maps/a.wav", "pass", http.StatusUnauthorized, ""},
+		{http.MethodGet, "/v1/maps/de_a.bsp", "soundpass", http.StatusUnauthorized, ""},
+		// libraries don't have the paths from before /v1 and aren't anywhere else
+		{http.MethodGet, "/libraries/sounds/maps/a.wav", "soundpass", http.StatusNotFound, ""},
+		{http.MethodGet, "/v1/libraries/sounds/libraries/sounds/maps/a.wav", "soundpass", http.StatusNotFound, ""},
+		{http.MethodPost, "/v1/libraries/other/sync", "pass", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, strings.NewReader("{}"))
+		if test.pass != "" {
+			r.Header.Set("Pass", test.pass)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != test.status || !strings.Contains(w.Body.String(), test.body) {
+			t.Error("[", test.method, " ", test.path, "] got: ", w.Code, " ", w.Body.String(), " wanted: ", test.status, " ", test.body)
+		}
+	}
+
+	// the library keeps its own hash map
+	lib := cs.Libraries[0]
+	if lib.C.ManifestFile == cs.C.ManifestFile {
+		t.Fatal("library shares the manifest file: ", lib.C.ManifestFile)
+	}
+	for file, want := range map[string][]string{cs.C.ManifestFile: {"de_a.bsp"}, lib.C.ManifestFile: {"a.wav"}} {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Error("[", file, "] got: ", err)
+			continue
+		}
+		var m struct {
+			Files map[string]string `json:"files"`
+		}
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Error("[", file, "] got: ", err)
+		}
+		var got []string
+		for name := range m.Files {
+			got = append(got, name)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Error("[", file, "] got: ", got, " wanted: ", want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(cs.C.ManifestFile), "manifest-sounds.json")); err != nil {
+		t.Error("library manifest isn't next to the server's: ", err)
+	}
+}
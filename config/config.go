@@ -13,58 +13,500 @@ package config
 import (
 	"bufio"
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
+
+	"github.com/kthomas422/csgosync/internal/disk"
+	"github.com/kthomas422/csgosync/internal/ignore"
+	"github.com/kthomas422/csgosync/internal/ratelimit"
+	"github.com/kthomas422/csgosync/internal/twoway"
 )
 
+// PromptOutput is where prompts for user input are written
+var PromptOutput io.Writer = os.Stdout
+
 // Both the client and server will have these values in their config
 type baseConfig struct {
-	Pass    string // Password for accessing the api
-	MapPath string // Path to where the maps are stored
+	Pass      string   // Password for accessing the api
+	MapPath   string   // Path to where the maps are stored
+	RateBurst int64    // Most bytes that can be sent/received at once over the rate limits, defaults to 1 second worth
+	Include   []string // gitignore style patterns of the files to sync, empty is everything
+	Exclude   []string // gitignore style patterns of the files not to sync, .csgosyncignore adds to them
+	Zstd      string   // zstd program for zstd compressed map downloads, looked for if empty
 }
 
+// DefaultExclude is what isn't synced if EXCLUDE isn't set, editor backups and logs
+const DefaultExclude = "*.bak *.log"
+
 // Server configuration values
 type ServerConfig struct {
-	Port    string // Port to listen on
-	LogFile string // Where to put logs
+	Port            string              // Port to listen on
+	LogFile         string              // Where to put logs
+	RefreshInterval time.Duration       // How often to regenerate the hash map
+	RateLimit       int64               // Bytes per second the server sends in total, 0 is unlimited
+	ConnRateLimit   int64               // Bytes per second the server sends per connection, 0 is unlimited
+	FastDLPath      string              // Where to keep the bzip2 compressed FastDL mirror, empty is disabled
+	Bzip2           string              // bzip2 program used to compress the FastDL mirror
+	CompressCache   string              // Where to keep gzip and zstd compressed maps, empty disables compression
+	TrustedProxies  []*net.IPNet        // Proxies allowed to say who the client is with X-Forwarded-For/Forwarded
+	AllowIPs        []*net.IPNet        // Only these can connect, empty is everyone
+	DenyIPs         []*net.IPNet        // These can't connect
+	RequestRate     float64             // Requests per second per ip, 0 is unlimited
+	RequestBurst    int                 // Most requests an ip can make at once
+	MaxAuthFailures int                 // Failed logins from an ip before it's banned, 0 never bans
+	AuthFailWindow  time.Duration       // Failed logins older than this are forgotten
+	BanTime         time.Duration       // How long bans last
+	AdminPass       string              // Password for the admin endpoints, empty disables them
+	Metrics         bool                // Serve prometheus metrics at /metrics
+	MetricsToken    string              // Bearer token needed for /metrics, empty lets anyone scrape it
+	MinFreeSpace    int64               // Bytes that have to be free on the disk for /readyz to pass
+	TokensFile      string              // Where the api tokens are kept
+	ManifestFile    string              // Where the hash map and tombstones are kept between runs
+	MaxUploadSize   int64               // Biggest file that can be uploaded
+	UploadExts      []string            // Extensions (".bsp") of files that can be uploaded, "*" is anything
+	Groups          map[string][]string // Named lists of gitignore style patterns clients can subscribe to
+	Libraries       []LibraryConfig     // Other directories served at /v1/libraries/<name>/
 	*baseConfig
 }
 
+// LibraryConfig is a directory served next to MAP_PATH at /v1/libraries/<name>/ (sounds,
+// configs...) with its own hash map. Anything not set is the same as the server's.
+type LibraryConfig struct {
+	Name            string
+	MapPath         string
+	Include         []string
+	Exclude         []string
+	RefreshInterval time.Duration
+	Pass            string
+	TokensFile      string // the server's tokens work for the library too if it's the same file
+	ManifestFile    string
+}
+
+// libraryName is what library names can be, they go in urls
+var libraryName = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// Library returns the config the library is served with, the server's with the library's settings
+func (c *ServerConfig) Library(lib LibraryConfig) *ServerConfig {
+	lc := *c
+	base := *c.baseConfig
+	base.MapPath, base.Pass, base.Include, base.Exclude = lib.MapPath, lib.Pass, lib.Include, lib.Exclude
+	lc.baseConfig = &base
+	lc.RefreshInterval = lib.RefreshInterval
+	lc.TokensFile = lib.TokensFile
+	lc.ManifestFile = lib.ManifestFile
+	lc.FastDLPath = "" // game clients only download maps
+	if c.CompressCache != "" {
+		lc.CompressCache = c.CompressCache + "-" + lib.Name
+	}
+	lc.Groups = nil
+	lc.Libraries = nil
+	return &lc
+}
+
+// DefaultRefreshInterval is how often the server regenerates the hash map if REFRESH_INTERVAL isn't set
+const DefaultRefreshInterval = time.Hour * 24 * 7
+
+// DefaultMinFreeSpace is how much room has to be left on the disk for the server to be ready
+const DefaultMinFreeSpace = "100MB"
+
+// Defaults for uploads
+const (
+	DefaultMaxUploadSize = "1GB"
+	DefaultUploadExts    = ".bsp .nav .txt .res .jpg .png .vtf .vmt .mdl .vvd .vtx .phy .wav .mp3 .pcf"
+)
+
+// DefaultTokensFile is where the server keeps api tokens if TOKENS_FILE isn't set
+const DefaultTokensFile = "csgosyncd-tokens.json"
+
+// DefaultManifestFile is where the server keeps the hash map and tombstones if MANIFEST_FILE isn't set
+const DefaultManifestFile = "csgosyncd-manifest.json"
+
+// Defaults for banning ips that keep failing to log in
+const (
+	DefaultMaxAuthFailures = 10
+	DefaultAuthFailWindow  = time.Minute * 10
+	DefaultBanTime         = time.Hour
+)
+
 // Client configuration values
 type ClientConfig struct {
-	Uri string // Where the server is located
+	Uri        string                   // Where the server is located
+	Daemon     bool                     // Keep running and sync every interval
+	Interval   time.Duration            // How often to sync when running as a daemon
+	Events     bool                     // Listen for the server to say its files changed when running as a daemon
+	LogFile    string                   // Where to put logs when running as a daemon
+	RateLimit  int64                    // Bytes per second to download at, 0 is unlimited
+	Chunked    bool                     // Download files in chunks, only getting the chunks we don't have
+	ChunkPath  string                   // Where to keep chunks for chunked downloads
+	Token      string                   // Token with the upload scope for pushing files, PASSWORD if empty
+	TwoWay     bool                     // Upload files that changed here too
+	Conflicts  string                   // How two way syncs settle files that changed on both sides
+	Retired    string                   // What to do with files the server retired: "archive", "remove" or "keep"
+	Backups    bool                     // Keep the files a sync replaces in MAP_PATH/.csgosync/backup
+	BackupKeep int                      // Most syncs to keep backups of, 0 is unlimited
+	BackupAge  time.Duration            // How long to keep backups, 0 is forever
+	Groups     []string                 // Server's groups of files to sync, empty is every file
+	Libraries  map[string]ClientLibrary // Server's other libraries to sync
 	*baseConfig
 }
 
+// ClientLibrary is one of the server's libraries the client syncs
+type ClientLibrary struct {
+	MapPath string // Directory to sync it into
+	Pass    string // Password if it has its own, PASSWORD if empty
+}
+
+// Library returns the config for syncing the server's library into its directory, the URI still
+// has to be pointed at the library. GROUPS are the main library's so the whole library is synced.
+func (c *ClientConfig) Library(name string) *ClientConfig {
+	lc := *c
+	base := *c.baseConfig
+	base.MapPath = c.Libraries[name].MapPath
+	if pass := c.Libraries[name].Pass; pass != "" {
+		base.Pass = pass
+	}
+	lc.baseConfig = &base
+	lc.Groups = nil
+	lc.Libraries = nil
+	return &lc
+}
+
+// StateDir is the directory in MAP_PATH the client keeps its own files in, the hash map doesn't
+// look in directories so they're never synced
+const StateDir = ".csgosync"
+
+// What the client does with files the server retired (RETIRED_FILES)
+const (
+	RetiredArchive = "archive" // move them to MAP_PATH/.csgosync/retired
+	RetiredRemove  = "remove"  // delete them
+	RetiredKeep    = "keep"    // leave them alone
+)
+
+// Backup retention if BACKUP_KEEP and BACKUP_MAX_AGE aren't set
+const (
+	DefaultBackupKeep = 10
+	DefaultBackupAge  = time.Hour * 24 * 30
+)
+
+// DefaultSyncInterval is how often the client syncs as a daemon if SYNC_INTERVAL isn't set
+const DefaultSyncInterval = time.Hour
+
 // Returns a populated baseConfig structure
-func initConfig() *baseConfig {
-	return &baseConfig{
-		Pass:    viper.GetString("PASSWORD"),
-		MapPath: viper.GetString("MAP_PATH"),
+func initConfig() (*baseConfig, error) {
+	burst, err := getRate("RATE_BURST")
+	if err != nil {
+		return nil, err
+	}
+	viper.SetDefault("EXCLUDE", DefaultExclude)
+	c := &baseConfig{
+		Pass:      viper.GetString("PASSWORD"),
+		MapPath:   viper.GetString("MAP_PATH"),
+		RateBurst: burst,
+		Include:   getList("INCLUDE"),
+		Exclude:   getList("EXCLUDE"),
+		Zstd:      viper.GetString("ZSTD_PATH"),
 	}
+	if _, err := ignore.New(c.Include, c.Exclude); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
 // Returns a populated ServerConfig structure
-func InitServerConfig() *ServerConfig {
-	return &ServerConfig{
-		viper.GetString("PORT"),
-		viper.GetString("LOG_FILE"),
-		initConfig(),
+func InitServerConfig() (*ServerConfig, error) {
+	base, err := initConfig()
+	if err != nil {
+		return nil, err
+	}
+	viper.SetDefault("MAX_AUTH_FAILURES", DefaultMaxAuthFailures)
+	viper.SetDefault("MIN_FREE_SPACE", DefaultMinFreeSpace)
+	viper.SetDefault("TOKENS_FILE", DefaultTokensFile)
+	viper.SetDefault("MANIFEST_FILE", DefaultManifestFile)
+	viper.SetDefault("MAX_UPLOAD_SIZE", DefaultMaxUploadSize)
+	viper.SetDefault("UPLOAD_EXTENSIONS", DefaultUploadExts)
+	c := &ServerConfig{
+		Port:            viper.GetString("PORT"),
+		LogFile:         viper.GetString("LOG_FILE"),
+		RefreshInterval: viper.GetDuration("REFRESH_INTERVAL"),
+		FastDLPath:      viper.GetString("FASTDL_PATH"),
+		Bzip2:           viper.GetString("BZIP2_PATH"),
+		CompressCache:   viper.GetString("COMPRESS_CACHE_PATH"),
+		RequestRate:     viper.GetFloat64("REQUEST_RATE"),
+		RequestBurst:    viper.GetInt("REQUEST_BURST"),
+		MaxAuthFailures: viper.GetInt("MAX_AUTH_FAILURES"),
+		AuthFailWindow:  viper.GetDuration("AUTH_FAILURE_WINDOW"),
+		BanTime:         viper.GetDuration("BAN_TIME"),
+		AdminPass:       viper.GetString("ADMIN_PASSWORD"),
+		Metrics:         viper.GetBool("METRICS"),
+		MetricsToken:    viper.GetString("METRICS_TOKEN"),
+		TokensFile:      viper.GetString("TOKENS_FILE"),
+		ManifestFile:    viper.GetString("MANIFEST_FILE"),
+		baseConfig:      base,
+	}
+	if c.RefreshInterval <= 0 {
+		c.RefreshInterval = DefaultRefreshInterval
+	}
+	if c.AuthFailWindow <= 0 {
+		c.AuthFailWindow = DefaultAuthFailWindow
+	}
+	if c.BanTime <= 0 {
+		c.BanTime = DefaultBanTime
+	}
+	if c.RateLimit, err = getRate("RATE_LIMIT"); err != nil {
+		return nil, err
+	}
+	if c.ConnRateLimit, err = getRate("CONN_RATE_LIMIT"); err != nil {
+		return nil, err
+	}
+	if c.TrustedProxies, err = getCIDRs("TRUSTED_PROXIES"); err != nil {
+		return nil, err
+	}
+	if c.MinFreeSpace, err = getSize("MIN_FREE_SPACE"); err != nil {
+		return nil, err
 	}
+	if c.MaxUploadSize, err = getSize("MAX_UPLOAD_SIZE"); err != nil {
+		return nil, err
+	}
+	for _, ext := range getList("UPLOAD_EXTENSIONS") {
+		if ext != "*" && !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		c.UploadExts = append(c.UploadExts, strings.ToLower(ext))
+	}
+	if c.AllowIPs, err = getCIDRs("ALLOW_IPS"); err != nil {
+		return nil, err
+	}
+	if c.DenyIPs, err = getCIDRs("DENY_IPS"); err != nil {
+		return nil, err
+	}
+	if c.Groups, err = getGroups(); err != nil {
+		return nil, err
+	}
+	if c.Libraries, err = getLibraries(c); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
 // Returns a populated ClientConfig structure
-func InitClientConfig() *ClientConfig {
+func InitClientConfig() (*ClientConfig, error) {
+	base, err := initConfig()
+	if err != nil {
+		return nil, err
+	}
+	viper.SetDefault("WATCH_EVENTS", true)
+	viper.SetDefault("RETIRED_FILES", RetiredArchive)
+	viper.SetDefault("BACKUPS", true)
+	viper.SetDefault("BACKUP_KEEP", DefaultBackupKeep)
+	viper.SetDefault("BACKUP_MAX_AGE", DefaultBackupAge)
 	c := &ClientConfig{
-		viper.GetString("URI"),
-		initConfig(),
+		Uri:        viper.GetString("URI"),
+		Daemon:     viper.GetBool("DAEMON"),
+		Interval:   viper.GetDuration("SYNC_INTERVAL"),
+		Events:     viper.GetBool("WATCH_EVENTS"),
+		Chunked:    viper.GetBool("CHUNKED"),
+		ChunkPath:  viper.GetString("CHUNK_CACHE_PATH"),
+		LogFile:    viper.GetString("LOG_FILE"),
+		Token:      viper.GetString("UPLOAD_TOKEN"),
+		TwoWay:     viper.GetBool("TWO_WAY"),
+		Retired:    viper.GetString("RETIRED_FILES"),
+		Backups:    viper.GetBool("BACKUPS"),
+		BackupKeep: viper.GetInt("BACKUP_KEEP"),
+		BackupAge:  viper.GetDuration("BACKUP_MAX_AGE"),
+		Groups:     getList("GROUPS"),
+		Libraries:  make(map[string]ClientLibrary),
+		baseConfig: base,
+	}
+	if c.Interval <= 0 {
+		c.Interval = DefaultSyncInterval
+	}
+	if c.LogFile == "" {
+		c.LogFile = "stderr"
 	}
-	if !strings.HasPrefix(c.Uri, "http://") {
+	if c.ChunkPath == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			cache = os.TempDir()
+		}
+		c.ChunkPath = filepath.Join(cache, "csgosync", "chunks")
+	}
+	// left empty so the client can tell it wasn't set and prompt for it (or give up as a daemon)
+	if c.Uri != "" && !strings.HasPrefix(c.Uri, "http://") {
 		c.Uri = "http://" + c.Uri
 	}
-	return c
+	if c.RateLimit, err = getRate("RATE_LIMIT"); err != nil {
+		return nil, err
+	}
+	if c.Conflicts, err = twoway.ParsePolicy(viper.GetString("CONFLICT_POLICY")); err != nil {
+		return nil, err
+	}
+	switch c.Retired {
+	case RetiredArchive, RetiredRemove, RetiredKeep:
+	default:
+		return nil, fmt.Errorf("bad RETIRED_FILES %q, use %s, %s or %s", c.Retired, RetiredArchive, RetiredRemove, RetiredKeep)
+	}
+	// each library is the directory to sync it into or its own MAP_PATH and PASSWORD
+	for name, v := range viper.GetStringMap("LIBRARIES") {
+		var lib ClientLibrary
+		switch v := v.(type) {
+		case string:
+			lib.MapPath = v
+		case map[string]interface{}:
+			sub := viper.Sub("LIBRARIES." + name)
+			lib.MapPath, lib.Pass = sub.GetString("MAP_PATH"), sub.GetString("PASSWORD")
+		}
+		if lib.MapPath == "" {
+			return nil, fmt.Errorf("library %s needs a directory to sync into", name)
+		}
+		c.Libraries[strings.ToLower(name)] = lib
+	}
+	if c.BackupKeep < 0 || c.BackupAge < 0 {
+		return nil, fmt.Errorf("BACKUP_KEEP and BACKUP_MAX_AGE can't be negative")
+	}
+	return c, nil
+}
+
+// getGroups reads the groups from GROUPS and the file in GROUPS_FILE (yaml or json with a list of
+// patterns for each group), names are lower case
+func getGroups() (map[string][]string, error) {
+	groups := make(map[string][]string)
+	for name, patterns := range viper.GetStringMapStringSlice("GROUPS") {
+		groups[strings.ToLower(name)] = patterns
+	}
+	if file := viper.GetString("GROUPS_FILE"); file != "" {
+		v := viper.New()
+		v.SetConfigFile(file)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read GROUPS_FILE: %w", err)
+		}
+		for _, name := range v.AllKeys() {
+			groups[strings.ToLower(name)] = v.GetStringSlice(name)
+		}
+	}
+	for name, patterns := range groups {
+		if _, err := ignore.Compile(patterns); err != nil {
+			return nil, fmt.Errorf("bad pattern in group %s: %w", name, err)
+		}
+	}
+	return groups, nil
+}
+
+// getLibraries reads the libraries from LIBRARIES, a map of names to their settings
+func getLibraries(c *ServerConfig) ([]LibraryConfig, error) {
+	var libs []LibraryConfig
+	for name := range viper.GetStringMap("LIBRARIES") {
+		name = strings.ToLower(name)
+		if !libraryName.MatchString(name) {
+			return nil, fmt.Errorf("bad library name %q, use lower case letters, numbers, _ and -", name)
+		}
+		sub := viper.Sub("LIBRARIES." + name)
+		if sub == nil {
+			return nil, fmt.Errorf("library %s needs a MAP_PATH", name)
+		}
+		ext := filepath.Ext(c.ManifestFile)
+		lib := LibraryConfig{
+			Name:            name,
+			MapPath:         sub.GetString("MAP_PATH"),
+			Include:         c.Include,
+			Exclude:         c.Exclude,
+			RefreshInterval: c.RefreshInterval,
+			Pass:            c.Pass,
+			TokensFile:      c.TokensFile,
+			ManifestFile:    strings.TrimSuffix(c.ManifestFile, ext) + "-" + name + ext,
+		}
+		if lib.MapPath == "" {
+			return nil, fmt.Errorf("library %s needs a MAP_PATH", name)
+		}
+		if sub.IsSet("INCLUDE") {
+			lib.Include = splitList(sub.GetStringSlice("INCLUDE"))
+		}
+		if sub.IsSet("EXCLUDE") {
+			lib.Exclude = splitList(sub.GetStringSlice("EXCLUDE"))
+		}
+		if _, err := ignore.New(lib.Include, lib.Exclude); err != nil {
+			return nil, fmt.Errorf("library %s: %w", name, err)
+		}
+		if d := sub.GetDuration("REFRESH_INTERVAL"); d > 0 {
+			lib.RefreshInterval = d
+		}
+		if pass := sub.GetString("PASSWORD"); pass != "" {
+			lib.Pass = pass
+		}
+		if file := sub.GetString("TOKENS_FILE"); file != "" {
+			lib.TokensFile = file
+		}
+		if file := sub.GetString("MANIFEST_FILE"); file != "" {
+			lib.ManifestFile = file
+		}
+		libs = append(libs, lib)
+	}
+	sort.Slice(libs, func(i, j int) bool { return libs[i].Name < libs[j].Name })
+	return libs, nil
+}
+
+// getRate reads a number of bytes like "10MB" from the config
+func getRate(key string) (int64, error) {
+	rate, err := ratelimit.ParseRate(viper.GetString(key))
+	if err != nil {
+		return 0, fmt.Errorf("bad %s: %w", key, err)
+	}
+	return rate, nil
+}
+
+// getSize reads a size like "100MB" from the config
+func getSize(key string) (int64, error) {
+	size, err := disk.ParseSize(viper.GetString(key))
+	if err != nil {
+		return 0, fmt.Errorf("bad %s: %w", key, err)
+	}
+	return size, nil
+}
+
+// getList reads a list from the config, it can be a yaml list or separated by commas or spaces
+func getList(key string) []string {
+	return splitList(viper.GetStringSlice(key))
+}
+
+// splitList splits the items of a list from the config that are themselves lists
+func splitList(items []string) []string {
+	var list []string
+	for _, item := range items {
+		list = append(list, strings.FieldsFunc(item, func(r rune) bool { return r == ',' || r == ' ' })...)
+	}
+	return list
+}
+
+// getCIDRs reads a list of CIDRs like "10.0.0.0/8" from the config, a plain ip is just that ip
+func getCIDRs(key string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range getList(key) {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("bad %s: %q isn't an ip or cidr", key, s)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad %s: %w", key, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
 }
 
 // Prompts the user to enter the URI
@@ -88,7 +530,7 @@ func (c *baseConfig) GetPass() error {
 func Wait() {
 	_, err := getInput("done, press \"enter\" to continue")
 	if err != nil {
-		fmt.Println("error: ", err)
+		_, _ = fmt.Fprintln(PromptOutput, "error: ", err)
 	}
 }
 
@@ -100,7 +542,7 @@ func getInput(prompt string) (string, error) {
 	)
 	reader := bufio.NewReader(os.Stdin)
 
-	fmt.Print(prompt + " ")
+	_, _ = fmt.Fprint(PromptOutput, prompt+" ")
 	input, err = reader.ReadString('\n')
 	if err != nil {
 		return "", err
@@ -0,0 +1,231 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/config/config_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the config module for the csgo sync application.
+*/
+
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// setConfig replaces the config with the settings
+func setConfig(t *testing.T, settings map[string]interface{}) {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	for key, value := range settings {
+		viper.Set(key, value)
+	}
+}
+
+func TestServerLibraries(t *testing.T) {
+	tests := map[string]struct {
+		libraries map[string]interface{}
+		want      []LibraryConfig
+		err       bool
+	}{
+		"none": {},
+		"defaults": {
+			libraries: map[string]interface{}{"sounds": map[string]interface{}{"MAP_PATH": "/srv/sounds"}},
+			want: []LibraryConfig{{
+				Name:            "sounds",
+				MapPath:         "/srv/sounds",
+				Exclude:         []string{"*.part"},
+				RefreshInterval: DefaultRefreshInterval,
+				Pass:            "pass",
+				TokensFile:      DefaultTokensFile,
+				ManifestFile:    "csgosyncd-manifest-sounds.json",
+			}},
+		},
+		"overrides": {
+			libraries: map[string]interface{}{"Configs": map[string]interface{}{
+				"MAP_PATH":         "/srv/configs",
+				"PASSWORD":         "configpass",
+				"INCLUDE":          []string{"*.cfg"},
+				"EXCLUDE":          []string{},
+				"REFRESH_INTERVAL": "1h",
+				"TOKENS_FILE":      "configs-tokens.json",
+				"MANIFEST_FILE":    "configs.json",
+			}},
+			want: []LibraryConfig{{
+				Name:            "configs",
+				MapPath:         "/srv/configs",
+				Include:         []string{"*.cfg"},
+				RefreshInterval: time.Hour,
+				Pass:            "configpass",
+				TokensFile:      "configs-tokens.json",
+				ManifestFile:    "configs.json",
+			}},
+		},
+		"sorted": {
+			libraries: map[string]interface{}{
+				"b": map[string]interface{}{"MAP_PATH": "/srv/b"},
+				"a": map[string]interface{}{"MAP_PATH": "/srv/a"},
+			},
+		},
+		"no map path":    {libraries: map[string]interface{}{"sounds": map[string]interface{}{"PASSWORD": "x"}}, err: true},
+		"only a path":    {libraries: map[string]interface{}{"sounds": "/srv/sounds"}, err: true},
+		"bad name":       {libraries: map[string]interface{}{"my sounds": map[string]interface{}{"MAP_PATH": "/srv"}}, err: true},
+		"bad pattern":    {libraries: map[string]interface{}{"sounds": map[string]interface{}{"MAP_PATH": "/srv", "INCLUDE": []string{"["}}}, err: true},
+		"slash in name":  {libraries: map[string]interface{}{"a/b": map[string]interface{}{"MAP_PATH": "/srv"}}, err: true},
+		"dots in name":   {libraries: map[string]interface{}{"..": map[string]interface{}{"MAP_PATH": "/srv"}}, err: true},
+		"empty map path": {libraries: map[string]interface{}{"sounds": map[string]interface{}{"MAP_PATH": ""}}, err: true},
+	}
+	for name, test := range tests {
+		setConfig(t, map[string]interface{}{
+			"MAP_PATH":  "/srv/maps",
+			"PASSWORD":  "pass",
+			"EXCLUDE":   []string{"*.part"},
+			"LIBRARIES": test.libraries,
+		})
+		c, err := InitServerConfig()
+		if test.err {
+			if err == nil {
+				t.Error("[", name, "] expected an error, got: ", c.Libraries)
+			}
+			continue
+		}
+		if err != nil {
+			t.Error("[", name, "] got: ", err)
+			continue
+		}
+		if name == "sorted" {
+			if len(c.Libraries) != 2 || c.Libraries[0].Name != "a" || c.Libraries[1].Name != "b" {
+				t.Error("[", name, "] got: ", c.Libraries)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(c.Libraries, test.want) {
+			t.Error("[", name, "] got: ", c.Libraries, " wanted: ", test.want)
+		}
+	}
+}
+
+func TestServerLibraryConfig(t *testing.T) {
+	setConfig(t, map[string]interface{}{
+		"MAP_PATH":            "/srv/maps",
+		"PASSWORD":            "pass",
+		"FASTDL_PATH":         "/srv/fastdl",
+		"COMPRESS_CACHE_PATH": "/var/cache/csgosync",
+		"GROUPS":              map[string]interface{}{"aim": []string{"aim_*"}},
+		"LIBRARIES":           map[string]interface{}{"sounds": map[string]interface{}{"MAP_PATH": "/srv/sounds", "PASSWORD": "soundpass"}},
+	})
+	c, err := InitServerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lc := c.Library(c.Libraries[0])
+	if lc.MapPath != "/srv/sounds" || lc.Pass != "soundpass" || lc.ManifestFile != "csgosyncd-manifest-sounds.json" {
+		t.Error("got map path: ", lc.MapPath, " pass: ", lc.Pass, " manifest: ", lc.ManifestFile)
+	}
+	if lc.FastDLPath != "" || lc.CompressCache != "/var/cache/csgosync-sounds" || lc.Groups != nil || lc.Libraries != nil {
+		t.Error("got fastdl: ", lc.FastDLPath, " cache: ", lc.CompressCache, " groups: ", lc.Groups, " libraries: ", lc.Libraries)
+	}
+	if c.MapPath != "/srv/maps" || c.Pass != "pass" || len(c.Groups) != 1 {
+		t.Error("server's config changed, got map path: ", c.MapPath, " pass: ", c.Pass, " groups: ", c.Groups)
+	}
+}
+
+func TestClientLibraries(t *testing.T) {
+	tests := map[string]struct {
+		libraries map[string]interface{}
+		want      map[string]ClientLibrary
+		err       bool
+	}{
+		"none": {want: map[string]ClientLibrary{}},
+		"only a path": {
+			libraries: map[string]interface{}{"Sounds": "/games/sounds"},
+			want:      map[string]ClientLibrary{"sounds": {MapPath: "/games/sounds"}},
+		},
+		"own password": {
+			libraries: map[string]interface{}{"configs": map[string]interface{}{"MAP_PATH": "/games/cfg", "PASSWORD": "cfgpass"}},
+			want:      map[string]ClientLibrary{"configs": {MapPath: "/games/cfg", Pass: "cfgpass"}},
+		},
+		"no map path": {libraries: map[string]interface{}{"configs": map[string]interface{}{"PASSWORD": "cfgpass"}}, err: true},
+		"empty path":  {libraries: map[string]interface{}{"sounds": ""}, err: true},
+	}
+	for name, test := range tests {
+		setConfig(t, map[string]interface{}{
+			"URI":       "localhost:8080",
+			"MAP_PATH":  "/games/maps",
+			"PASSWORD":  "pass",
+			"LIBRARIES": test.libraries,
+		})
+		c, err := InitClientConfig()
+		if test.err {
+			if err == nil {
+				t.Error("[", name, "] expected an error, got: ", c.Libraries)
+			}
+			continue
+		}
+		if err != nil {
+			t.Error("[", name, "] got: ", err)
+			continue
+		}
+		if !reflect.DeepEqual(c.Libraries, test.want) {
+			t.Error("[", name, "] got: ", c.Libraries, " wanted: ", test.want)
+		}
+	}
+}
+
+func TestClientLibraryConfig(t *testing.T) {
+	setConfig(t, map[string]interface{}{
+		"URI":      "localhost:8080",
+		"MAP_PATH": "/games/maps",
+		"PASSWORD": "pass",
+		"GROUPS":   []string{"aim", "surf"},
+		"LIBRARIES": map[string]interface{}{
+			"sounds":  "/games/sounds",
+			"configs": map[string]interface{}{"MAP_PATH": "/games/cfg", "PASSWORD": "cfgpass"},
+		},
+	})
+	c, err := InitClientConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]struct{ mapPath, pass string }{
+		"sounds":  {"/games/sounds", "pass"},
+		"configs": {"/games/cfg", "cfgpass"},
+	}
+	for name, want := range tests {
+		lc := c.Library(name)
+		if lc.MapPath != want.mapPath || lc.Pass != want.pass {
+			t.Error("[", name, "] got map path: ", lc.MapPath, " pass: ", lc.Pass, " wanted: ", want.mapPath, " ", want.pass)
+		}
+		// the groups are the main library's, a library has none so asking for them fails the sync
+		if lc.Groups != nil || lc.Libraries != nil {
+			t.Error("[", name, "] got groups: ", lc.Groups, " libraries: ", lc.Libraries)
+		}
+		if lc.Uri != c.Uri || lc.Interval != c.Interval {
+			t.Error("[", name, "] got uri: ", lc.Uri, " interval: ", lc.Interval)
+		}
+	}
+	if c.MapPath != "/games/maps" || c.Pass != "pass" || len(c.Groups) != 2 || len(c.Libraries) != 2 {
+		t.Error("client's config changed, got map path: ", c.MapPath, " pass: ", c.Pass, " groups: ", c.Groups)
+	}
+}
+
+func TestClientUri(t *testing.T) {
+	tests := map[string]string{
+		"":                      "",
+		"localhost:8080":        "http://localhost:8080",
+		"http://localhost:8080": "http://localhost:8080",
+	}
+	for uri, want := range tests {
+		setConfig(t, map[string]interface{}{"URI": uri})
+		c, err := InitClientConfig()
+		if err != nil || c.Uri != want {
+			t.Error("[", uri, "] got: ", c, err, " wanted: ", want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/backup/backup.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains keeping the client's files that a sync replaced so they can be restored.
+	Each sync's backups go in their own folder named by when it started.
+*/
+
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// idFormat is how backup folders are named, it sorts oldest first
+const idFormat = "20060102-150405"
+
+// ErrNotFound is returned when restoring a backup or file that isn't there
+var ErrNotFound = errors.New("no such backup")
+
+// Store keeps replaced files in dir
+type Store struct {
+	dir    string
+	mapDir string
+	keep   int           // most backups to keep, 0 is unlimited
+	maxAge time.Duration // backups older than this are deleted, 0 keeps them forever
+
+	mu  sync.Mutex
+	run string // id of the backup files are going into
+	now func() time.Time
+}
+
+// Backup is the files one sync replaced
+type Backup struct {
+	ID    string    `json:"id"`
+	Time  time.Time `json:"time"`
+	Files []string  `json:"files"`
+}
+
+// New returns a store keeping backups of files in mapDir in dir
+func New(dir, mapDir string, keep int, maxAge time.Duration) *Store {
+	return &Store{dir: dir, mapDir: mapDir, keep: keep, maxAge: maxAge, now: time.Now}
+}
+
+// Start puts the files saved from now on in a new backup
+func (s *Store) Start() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.run = ""
+}
+
+// Save moves file out of the way into the current backup, it returns a func that puts it back
+// if replacing it fails. Files that don't exist are skipped.
+func (s *Store) Save(file string) (undo func() error, err error) {
+	nothing := func() error { return nil }
+	if s == nil {
+		return nothing, nil
+	}
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nothing, nil
+	}
+	s.mu.Lock()
+	if s.run == "" {
+		// never mix with an earlier backup from the same second
+		id := s.now().Format(idFormat)
+		s.run = id
+		for n := 2; exists(filepath.Join(s.dir, s.run)); n++ {
+			s.run = fmt.Sprintf("%s-%d", id, n)
+		}
+	}
+	dir := filepath.Join(s.dir, s.run)
+	s.mu.Unlock()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup: %w", err)
+	}
+	dst := filepath.Join(dir, filepath.Base(file))
+	if err := os.Rename(file, dst); err != nil {
+		return nil, fmt.Errorf("failed to back up %s: %w", file, err)
+	}
+	return func() error { return os.Rename(dst, file) }, nil
+}
+
+// List returns the backups, oldest first
+func (s *Store) List() ([]Backup, error) {
+	entries, err := ioutil.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	var backups []Backup
+	for _, entry := range entries {
+		if !entry.IsDir() || len(entry.Name()) < len(idFormat) {
+			continue // not ours
+		}
+		t, err := time.ParseInLocation(idFormat, entry.Name()[:len(idFormat)], time.Local)
+		if err != nil {
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list backup: %w", err)
+		}
+		b := Backup{ID: entry.Name(), Time: t}
+		for _, file := range files {
+			if file.Mode().IsRegular() {
+				b.Files = append(b.Files, file.Name())
+			}
+		}
+		backups = append(backups, b)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].ID < backups[j].ID })
+	return backups, nil
+}
+
+// Restore moves files (every file if none) from the backup with the id back into the map
+// directory. The copies they replace are backed up first so nothing is lost. It returns the
+// files that were restored.
+func (s *Store) Restore(id string, files ...string) ([]string, error) {
+	backups, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	var backup *Backup
+	for i := range backups {
+		if backups[i].ID == id {
+			backup = &backups[i]
+		}
+	}
+	if backup == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if len(files) == 0 {
+		files = backup.Files
+	}
+	have := make(map[string]bool, len(backup.Files))
+	for _, file := range backup.Files {
+		have[file] = true
+	}
+	for _, file := range files {
+		if !have[file] {
+			return nil, fmt.Errorf("%w: %s isn't in backup %s", ErrNotFound, file, id)
+		}
+	}
+
+	s.Start()
+	var restored []string
+	for _, file := range files {
+		dst := filepath.Join(s.mapDir, file)
+		if _, err := s.Save(dst); err != nil {
+			return restored, err
+		}
+		if err := os.Rename(filepath.Join(s.dir, id, file), dst); err != nil {
+			return restored, fmt.Errorf("failed to restore %s: %w", file, err)
+		}
+		restored = append(restored, file)
+	}
+	_ = os.Remove(filepath.Join(s.dir, id)) // only works once it's empty
+	return restored, nil
+}
+
+// Prune deletes the oldest backups past the limit and the ones that are too old
+func (s *Store) Prune() error {
+	if s == nil {
+		return nil
+	}
+	backups, err := s.List()
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	for i, b := range backups {
+		tooMany := s.keep > 0 && len(backups)-i > s.keep
+		tooOld := s.maxAge > 0 && now.Sub(b.Time) > s.maxAge
+		if tooMany || tooOld {
+			if err := os.RemoveAll(filepath.Join(s.dir, b.ID)); err != nil {
+				return fmt.Errorf("failed to delete old backup: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
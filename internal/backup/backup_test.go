@@ -0,0 +1,153 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/backup/backup_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the backup module for the csgo sync application.
+*/
+
+package backup
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newStore returns a store in a temp dir with a clock that moves when told to
+func newStore(t *testing.T, keep int, maxAge time.Duration) (*Store, string, *time.Time) {
+	mapDir := t.TempDir()
+	now := time.Date(2020, 11, 30, 15, 45, 0, 0, time.Local)
+	s := New(filepath.Join(mapDir, ".csgosync", "backup"), mapDir, keep, maxAge)
+	s.now = func() time.Time { return now }
+	return s, mapDir, &now
+}
+
+func write(t *testing.T, file, contents string) {
+	if err := ioutil.WriteFile(file, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func read(file string) string {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "<" + err.Error() + ">"
+	}
+	return string(b)
+}
+
+func TestSaveAndRestore(t *testing.T) {
+	s, mapDir, now := newStore(t, 0, 0)
+	a, b := filepath.Join(mapDir, "a.bsp"), filepath.Join(mapDir, "b.bsp")
+	write(t, a, "a-mine")
+	write(t, b, "b-mine")
+
+	s.Start()
+	for _, file := range []string{a, b, filepath.Join(mapDir, "new.bsp")} {
+		if _, err := s.Save(file); err != nil {
+			t.Fatal("failed to save: ", err)
+		}
+	}
+	write(t, a, "a-server")
+	write(t, b, "b-server")
+
+	backups, err := s.List()
+	if err != nil || len(backups) != 1 {
+		t.Fatal("got backups: ", backups, err)
+	}
+	if backups[0].ID != "20201130-154500" || !reflect.DeepEqual(backups[0].Files, []string{"a.bsp", "b.bsp"}) {
+		t.Error("got backup: ", backups[0])
+	}
+
+	// restoring backs up what it replaces in a backup of its own
+	*now = now.Add(time.Minute)
+	restored, err := s.Restore("20201130-154500", "a.bsp")
+	if err != nil || !reflect.DeepEqual(restored, []string{"a.bsp"}) {
+		t.Fatal("restore got: ", restored, err)
+	}
+	if got := read(a); got != "a-mine" {
+		t.Error("a.bsp got: ", got)
+	}
+	if got := read(filepath.Join(s.dir, "20201130-154600", "a.bsp")); got != "a-server" {
+		t.Error("replaced a.bsp got: ", got)
+	}
+	if _, err := s.Restore("20201130-154500", "a.bsp"); !errors.Is(err, ErrNotFound) {
+		t.Error("restoring it again got: ", err)
+	}
+	if _, err := s.Restore("20200101-000000"); !errors.Is(err, ErrNotFound) {
+		t.Error("restoring a missing backup got: ", err)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	s, mapDir, _ := newStore(t, 0, 0)
+	a := filepath.Join(mapDir, "a.bsp")
+	write(t, a, "a-mine")
+	undo, err := s.Save(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(a); !os.IsNotExist(err) {
+		t.Error("a.bsp is still there: ", err)
+	}
+	if err := undo(); err != nil || read(a) != "a-mine" {
+		t.Error("undo got: ", read(a), err)
+	}
+}
+
+func TestSameSecond(t *testing.T) {
+	s, mapDir, _ := newStore(t, 0, 0)
+	a := filepath.Join(mapDir, "a.bsp")
+	for _, contents := range []string{"first", "second"} {
+		write(t, a, contents)
+		s.Start()
+		if _, err := s.Save(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups, _ := s.List()
+	if len(backups) != 2 || backups[1].ID != "20201130-154500-2" {
+		t.Fatal("got backups: ", backups)
+	}
+	if read(filepath.Join(s.dir, backups[0].ID, "a.bsp")) != "first" {
+		t.Error("first backup was overwritten")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	s, mapDir, now := newStore(t, 2, time.Hour*12)
+	a := filepath.Join(mapDir, "a.bsp")
+	for i := 0; i < 4; i++ {
+		write(t, a, "a")
+		s.Start()
+		if _, err := s.Save(a); err != nil {
+			t.Fatal(err)
+		}
+		*now = now.Add(time.Hour * 10)
+	}
+	if err := s.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	backups, _ := s.List()
+	var ids []string
+	for _, b := range backups {
+		ids = append(ids, b.ID)
+	}
+	// the oldest two are past the limit and the third is too old
+	if !reflect.DeepEqual(ids, []string{"20201201-214500"}) {
+		t.Error("got: ", ids)
+	}
+
+	// a nil store backs nothing up
+	var none *Store
+	if undo, err := none.Save(a); err != nil || undo() != nil {
+		t.Error("nil store got: ", err)
+	}
+}
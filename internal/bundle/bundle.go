@@ -0,0 +1,125 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/bundle/bundle.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains writing and safely extracting tar bundles of many files for the csgo sync application.
+*/
+
+package bundle
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Write writes the files from dir into w as a tar
+func Write(w io.Writer, dir string, files []string) error {
+	tw := tar.NewWriter(w)
+	for _, file := range files {
+		if err := addFile(tw, dir, file); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func addFile(tw *tar.Writer, dir, file string) error {
+	f, err := os.Open(filepath.Join(dir, file))
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", file, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", file, err)
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     file,
+		Size:     info.Size(),
+		Mode:     0644,
+		ModTime:  info.ModTime(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write header for %s: %w", file, err)
+	}
+	// the size is in the header already so exactly that many bytes have to follow
+	if _, err = io.CopyN(tw, f, info.Size()); err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	return nil
+}
+
+// SafeName reports if the name is a plain file name, no directories, no "..", nothing absolute
+func SafeName(name string) bool {
+	return name != "" && name != "." && name != ".." &&
+		!strings.ContainsAny(name, `/\:`) && filepath.Base(name) == name && !filepath.IsAbs(name)
+}
+
+// Extract reads the tar from r and writes every file to <dir>/<name>.tmp, calling done with the
+// name and the tmp file so it can be checked and moved into place. Only regular files in want
+// with safe names are accepted, anything else stops the extraction with an error. It returns the
+// files that were extracted and done didn't fail on.
+func Extract(r io.Reader, dir string, want map[string]bool, done func(name, tmp string) error) ([]string, error) {
+	var (
+		extracted []string
+		seen      = make(map[string]bool)
+		tr        = tar.NewReader(r)
+	)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return extracted, nil
+		}
+		if err != nil {
+			return extracted, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		if !SafeName(hdr.Name) {
+			return extracted, fmt.Errorf("unsafe file name in bundle: %q", hdr.Name)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return extracted, fmt.Errorf("%s in bundle isn't a regular file", hdr.Name)
+		}
+		if !want[hdr.Name] || seen[hdr.Name] {
+			return extracted, fmt.Errorf("unexpected file in bundle: %s", hdr.Name)
+		}
+		seen[hdr.Name] = true
+
+		tmp := filepath.Join(dir, hdr.Name) + ".tmp"
+		if err = writeFile(tmp, tr, hdr.Size); err != nil {
+			return extracted, err
+		}
+		if err = done(hdr.Name, tmp); err != nil {
+			continue // done cleans up after itself, the file gets downloaded on its own
+		}
+		extracted = append(extracted, hdr.Name)
+	}
+}
+
+// writeFile copies exactly size bytes into the file
+func writeFile(path string, r io.Reader, size int64) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	n, err := io.Copy(f, r)
+	if err == nil && n != size {
+		err = errors.New("file in bundle was cut short")
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("failed to extract %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
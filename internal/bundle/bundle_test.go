@@ -0,0 +1,108 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/bundle/bundle_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the bundle module for the csgo sync application.
+*/
+
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// move is a done func that moves the tmp file into place
+func move(name, tmp string) error {
+	return os.Rename(tmp, tmp[:len(tmp)-len(".tmp")])
+}
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	files := []string{"t1.txt", "t2.txt", "t3.txt"}
+	if err := Write(&buf, "../../test", files); err != nil {
+		t.Fatal("failed to write bundle: ", err)
+	}
+	dir := t.TempDir()
+	got, err := Extract(&buf, dir, map[string]bool{"t1.txt": true, "t2.txt": true, "t3.txt": true}, move)
+	if err != nil {
+		t.Fatal("failed to extract bundle: ", err)
+	}
+	if len(got) != len(files) {
+		t.Fatal("extracted ", len(got), " files, wanted ", len(files))
+	}
+	for _, file := range files {
+		want, _ := ioutil.ReadFile(filepath.Join("../../test", file))
+		have, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil || !bytes.Equal(want, have) {
+			t.Error("[", file, "] contents differ: ", err)
+		}
+	}
+}
+
+// evilBundle makes a tar with one entry
+func evilBundle(t *testing.T, hdr *tar.Header, body string) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	hdr.Size = int64(len(body))
+	if hdr.Typeflag != tar.TypeReg {
+		hdr.Size = 0
+		body = ""
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestRejectsUnsafeEntries(t *testing.T) {
+	tests := []*tar.Header{
+		{Typeflag: tar.TypeReg, Name: "../escape.bsp"},
+		{Typeflag: tar.TypeReg, Name: "/etc/passwd"},
+		{Typeflag: tar.TypeReg, Name: "sub/dir.bsp"},
+		{Typeflag: tar.TypeReg, Name: `..\escape.bsp`},
+		{Typeflag: tar.TypeReg, Name: "C:evil.bsp"},
+		{Typeflag: tar.TypeReg, Name: "unasked.bsp"},
+		{Typeflag: tar.TypeSymlink, Name: "link.bsp", Linkname: "/etc/passwd"},
+		{Typeflag: tar.TypeLink, Name: "hard.bsp", Linkname: "../x"},
+	}
+	want := map[string]bool{"link.bsp": true, "hard.bsp": true, "../escape.bsp": true, "/etc/passwd": true}
+	for _, hdr := range tests {
+		dir := t.TempDir()
+		name := hdr.Name
+		got, err := Extract(evilBundle(t, hdr, "bad"), dir, want, move)
+		if err == nil || len(got) != 0 {
+			t.Error("[", name, "] should have been rejected")
+		}
+		entries, _ := ioutil.ReadDir(dir)
+		if len(entries) != 0 {
+			t.Error("[", name, "] wrote files: ", len(entries))
+		}
+	}
+}
+
+func TestSafeName(t *testing.T) {
+	for _, name := range []string{"de_dust2.bsp", "surf_x.nav", ".hidden"} {
+		if !SafeName(name) {
+			t.Error(name, " should be safe")
+		}
+	}
+	for _, name := range []string{"", ".", "..", "a/b", `a\b`, "/abs", "c:x"} {
+		if SafeName(name) {
+			t.Error(name, " should be unsafe")
+		}
+	}
+}
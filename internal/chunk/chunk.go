@@ -0,0 +1,166 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/chunk/chunk.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains content defined chunking of files and the chunk store for the csgo sync application.
+
+	Chunk boundaries are picked with a gear rolling hash, so they depend on the bytes around them
+	and not their offset. Inserting or changing a few bytes only changes the chunks around them,
+	the rest of the file (and any file sharing the same content) has the same chunks.
+*/
+
+package chunk
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+const (
+	MinSize = 16 * 1024  // smallest chunk, except the last one
+	AvgSize = 64 * 1024  // chunks average about this
+	MaxSize = 256 * 1024 // biggest chunk
+
+	mask = AvgSize - 1 // a boundary is where the hash has this many low zero bits
+)
+
+// gear is the table of random numbers for the rolling hash. It must be the same everywhere so
+// it's made from a fixed seed instead of math/rand which could change between go versions.
+var gear [256]uint64
+
+func init() {
+	seed := uint64(0x6373676f73796e63) // "csgosync"
+	for i := range gear {
+		// splitmix64
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// Split cuts the reader into chunks and calls fn with every chunk and its bytes. The bytes are
+// only good until fn returns.
+func Split(r io.Reader, fn func(c models.Chunk, data []byte) error) error {
+	var (
+		br  = bufio.NewReaderSize(r, MaxSize)
+		buf = make([]byte, 0, MaxSize)
+		h   uint64
+	)
+	emit := func() error {
+		sum := sha1.Sum(buf)
+		err := fn(models.Chunk{Hash: hex.EncodeToString(sum[:]), Size: int64(len(buf))}, buf)
+		buf, h = buf[:0], 0
+		return err
+	}
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			if len(buf) > 0 {
+				return emit()
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		buf = append(buf, b)
+		h = h<<1 + gear[b]
+		if (len(buf) >= MinSize && h&mask == 0) || len(buf) >= MaxSize {
+			if err = emit(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// List returns the chunks of the reader
+func List(r io.Reader) ([]models.Chunk, error) {
+	var chunks []models.Chunk
+	err := Split(r, func(c models.Chunk, _ []byte) error {
+		chunks = append(chunks, c)
+		return nil
+	})
+	return chunks, err
+}
+
+// Hash returns the name of a chunk with the bytes
+func Hash(data []byte) string {
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Store keeps chunks on disk named by their hash
+type Store struct {
+	dir string
+}
+
+// NewStore returns a store that keeps the chunks in dir
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("couldn't create chunk store: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// path returns where the chunk goes, split into directories by the first 2 characters so there
+// aren't too many files in one
+func (s *Store) path(hash string) string {
+	if len(hash) < 2 {
+		return filepath.Join(s.dir, hash)
+	}
+	return filepath.Join(s.dir, hash[:2], hash)
+}
+
+// Has reports if the store has the chunk
+func (s *Store) Has(c models.Chunk) bool {
+	info, err := os.Stat(s.path(c.Hash))
+	return err == nil && info.Size() == c.Size
+}
+
+// Put adds the chunk to the store, the bytes have to match the hash
+func (s *Store) Put(hash string, data []byte) error {
+	if got := Hash(data); got != hash {
+		return fmt.Errorf("chunk hash mismatch: got %s, wanted %s", got, hash)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path(hash)), 0755); err != nil {
+		return fmt.Errorf("couldn't create chunk directory: %w", err)
+	}
+	tmp := s.path(hash) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("couldn't write chunk: %w", err)
+	}
+	return os.Rename(tmp, s.path(hash))
+}
+
+// AddFile puts every chunk of the file in the store
+func (s *Store) AddFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return Split(f, func(c models.Chunk, data []byte) error {
+		if s.Has(c) {
+			return nil
+		}
+		return s.Put(c.Hash, data)
+	})
+}
+
+// Open returns the chunk's bytes
+func (s *Store) Open(hash string) (*os.File, error) {
+	return os.Open(s.path(hash))
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/chunk/chunk_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the chunk module for the csgo sync application.
+*/
+
+package chunk
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+func randomBytes(n int, seed int64) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+func TestSplitJoins(t *testing.T) {
+	data := randomBytes(3<<20, 1)
+	var joined []byte
+	err := Split(bytes.NewReader(data), func(c models.Chunk, b []byte) error {
+		if c.Size != int64(len(b)) || c.Hash != Hash(b) {
+			t.Error("chunk doesn't match its bytes")
+		}
+		if len(b) > MaxSize {
+			t.Error("chunk too big: ", len(b))
+		}
+		joined = append(joined, b...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal("split failed: ", err)
+	}
+	if !bytes.Equal(joined, data) {
+		t.Fatal("chunks don't make the file")
+	}
+}
+
+func TestInsertKeepsMostChunks(t *testing.T) {
+	old := randomBytes(4<<20, 2)
+	new := append(append(append([]byte{}, old[:1<<20]...), []byte("a few new bytes")...), old[1<<20:]...)
+	oldChunks, err := List(bytes.NewReader(old))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newChunks, err := List(bytes.NewReader(new))
+	if err != nil {
+		t.Fatal(err)
+	}
+	have := make(map[string]bool)
+	for _, c := range oldChunks {
+		have[c.Hash] = true
+	}
+	missing := 0
+	for _, c := range newChunks {
+		if !have[c.Hash] {
+			missing++
+		}
+	}
+	// only the chunk with the insert (and maybe its neighbour) should be new
+	if missing > 2 {
+		t.Error("too many new chunks after a small insert: ", missing, " of ", len(newChunks))
+	}
+}
+
+func TestStore(t *testing.T) {
+	s, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("some chunk")
+	c := models.Chunk{Hash: Hash(data), Size: int64(len(data))}
+	if s.Has(c) {
+		t.Fatal("empty store has chunk")
+	}
+	if err = s.Put(Hash([]byte("other")), data); err == nil {
+		t.Error("put with the wrong hash should fail")
+	}
+	if err = s.Put(c.Hash, data); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Has(c) {
+		t.Fatal("store doesn't have the chunk it was given")
+	}
+	f, err := s.Open(c.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, _ := ioutil.ReadAll(f)
+	if !bytes.Equal(got, data) {
+		t.Error("chunk bytes changed")
+	}
+}
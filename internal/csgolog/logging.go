@@ -13,18 +13,23 @@ package csgolog
 import (
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/kthomas422/csgosync/config"
 
 	logger "github.com/kthomas422/json-logger"
 )
 
+// recentSize is how many access log entries are kept in memory for the dashboard
+const recentSize = 200
+
 // Wrapper for the logging file to close later and the logging package struct
 type CsgoLogger struct {
-	file io.WriteCloser
+	file   io.WriteCloser
+	recent *recentLog // last access log entries, newest last
 	*logger.Logger
 }
 
@@ -34,11 +39,13 @@ func InitLogger(logPath string) (*CsgoLogger, error) {
 	case "stderr":
 		return &CsgoLogger{
 			file:   os.Stderr,
+			recent: newRecentLog(),
 			Logger: logger.NewLogger(os.Stderr),
 		}, nil
 	case "stdout":
 		return &CsgoLogger{
 			file:   os.Stdout,
+			recent: newRecentLog(),
 			Logger: logger.NewLogger(os.Stdout),
 		}, nil
 	default:
@@ -48,6 +55,7 @@ func InitLogger(logPath string) (*CsgoLogger, error) {
 		}
 		return &CsgoLogger{
 			file:   file,
+			recent: newRecentLog(),
 			Logger: logger.NewLogger(file),
 		}, nil
 	}
@@ -61,13 +69,75 @@ func (cl CsgoLogger) Close() error {
 	return cl.file.Close()
 }
 
-// WebRequest takes in a web request and makes a log entry for it
-func (cl CsgoLogger) WebRequest(request *http.Request) {
-	_ = cl.Info(logger.ServerRequestLog{
-		Origin: request.Host,
-		URI:    request.RequestURI,
-		Header: request.Header,
-	})
+// AccessLog is the access log entry for a request the server answered
+type AccessLog struct {
+	RequestID string  `json:"request_id"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Route     string  `json:"route,omitempty"` // route that answered it, see httpserver.Route
+	Status    int     `json:"status"`
+	Bytes     int64   `json:"bytes"`      // bytes of body sent
+	LatencyMs float64 `json:"latency_ms"` // time from getting the request to finishing the response
+	User      string  `json:"user,omitempty"`
+	IP        string  `json:"ip"`
+	UserAgent string  `json:"user_agent,omitempty"`
+}
+
+// RecentAccess is an access log entry kept in memory
+type RecentAccess struct {
+	Time time.Time `json:"time"`
+	AccessLog
+}
+
+// Access logs a request the server answered
+func (cl CsgoLogger) Access(entry AccessLog) {
+	cl.recent.add(RecentAccess{Time: time.Now(), AccessLog: entry})
+	if err := cl.Info(entry); err != nil {
+		panic(fmt.Errorf("failed to write to logger: %w", err))
+	}
+}
+
+// Recent returns the last access log entries, newest first
+func (cl CsgoLogger) Recent() []RecentAccess {
+	return cl.recent.list()
+}
+
+// recentLog is a ring of the last access log entries
+type recentLog struct {
+	mu      sync.Mutex
+	entries []RecentAccess
+	next    int // where the next entry goes once it's full
+}
+
+func newRecentLog() *recentLog {
+	return &recentLog{entries: make([]RecentAccess, 0, recentSize)}
+}
+
+func (rl *recentLog) add(entry RecentAccess) {
+	if rl == nil {
+		return
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if len(rl.entries) < recentSize {
+		rl.entries = append(rl.entries, entry)
+		return
+	}
+	rl.entries[rl.next] = entry
+	rl.next = (rl.next + 1) % recentSize
+}
+
+func (rl *recentLog) list() []RecentAccess {
+	if rl == nil {
+		return nil
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	list := make([]RecentAccess, 0, len(rl.entries))
+	for i := len(rl.entries) - 1; i >= 0; i-- {
+		list = append(list, rl.entries[(rl.next+i)%len(rl.entries)])
+	}
+	return list
 }
 
 // Config takes in the server config and logs it
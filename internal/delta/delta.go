@@ -0,0 +1,358 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/delta/delta.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the rsync style block delta transfer for the csgo sync application.
+
+	The client sends the signature (rolling and strong checksum) of every block of its old copy.
+	The server slides a window over its copy looking for those blocks and sends back a stream of
+	operations: either "copy these blocks from your old copy" or "here are some literal bytes".
+*/
+
+package delta
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+const (
+	MinBlockSize = 2 * 1024   // smallest block size, anything smaller makes the signature too big
+	MaxBlockSize = 128 * 1024 // biggest block size, anything bigger won't find many matches
+
+	opBlocks  byte = 'B' // followed by uvarint first block, uvarint count
+	opLiteral byte = 'L' // followed by uvarint length and that many bytes
+	opEnd     byte = 'E'
+
+	readSize = 1 << 20 // how much of the new file to read at a time
+	mod      = 1 << 16 // the rolling checksum halves are mod 2^16
+)
+
+// BlockSize returns the block size for a file of the size, the square root like rsync does
+func BlockSize(size int64) int {
+	bs := int(math.Sqrt(float64(size)))
+	switch {
+	case bs < MinBlockSize:
+		return MinBlockSize
+	case bs > MaxBlockSize:
+		return MaxBlockSize
+	}
+	return bs &^ 1023 // round down to a kilobyte
+}
+
+// rolling is the rsync rolling checksum of a window
+type rolling struct {
+	a, b uint32
+	n    uint32 // window length
+}
+
+func newRolling(window []byte) rolling {
+	r := rolling{n: uint32(len(window))}
+	for i, c := range window {
+		r.a += uint32(c)
+		r.b += uint32(len(window)-i) * uint32(c)
+	}
+	r.a %= mod
+	r.b %= mod
+	return r
+}
+
+// roll slides the window one byte, dropping out and adding in
+func (r *rolling) roll(out, in byte) {
+	r.a = (r.a - uint32(out) + uint32(in)) % mod
+	r.b = (r.b - r.n*uint32(out) + r.a) % mod
+}
+
+func (r rolling) sum() uint32 {
+	return r.a | r.b<<16
+}
+
+func strongSum(block []byte) string {
+	sum := md5.Sum(block)
+	return hex.EncodeToString(sum[:])
+}
+
+// Signature returns the signature of every block of the file
+func Signature(r io.Reader, blockSize int) ([]models.BlockSignature, error) {
+	var (
+		sigs []models.BlockSignature
+		buf  = make([]byte, blockSize)
+	)
+	br := bufio.NewReaderSize(r, readSize)
+	for {
+		n, err := io.ReadFull(br, buf)
+		if n > 0 {
+			sigs = append(sigs, models.BlockSignature{
+				Weak:   newRolling(buf[:n]).sum(),
+				Strong: strongSum(buf[:n]),
+			})
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return sigs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Op is one step of rebuilding the file, either Count blocks starting at Block from the old copy
+// or Length literal bytes starting at Offset of the new file
+type Op struct {
+	Block, Count   int
+	Offset, Length int64
+}
+
+// IsLiteral reports if the op is literal bytes from the new file
+func (o Op) IsLiteral() bool {
+	return o.Length > 0
+}
+
+// Delta is the list of ops that turns the old copy into the new file
+type Delta struct {
+	Ops     []Op
+	Literal int64 // bytes that have to be sent
+	Size    int64 // size of the new file
+}
+
+// Compute finds the blocks of the old copy (described by req) in the new file and returns the ops
+// to rebuild the new file. The new file is read in pieces so it doesn't have to fit in memory.
+func Compute(newFile io.Reader, req models.DeltaRequest) (*Delta, error) {
+	bs := req.BlockSize
+	if bs < 1 || len(req.Blocks) == 0 {
+		return nil, errors.New("no blocks to match")
+	}
+	lastLen := int(req.Size - int64(len(req.Blocks)-1)*int64(bs)) // length of the old copy's last block
+	table := make(map[uint32][]int, len(req.Blocks))
+	for i, sig := range req.Blocks {
+		table[sig.Weak] = append(table[sig.Weak], i)
+	}
+
+	var (
+		d       = &Delta{}
+		win     = newWindow(newFile)
+		off     int64 // offset of the window in the new file
+		litFrom int64 // where the pending literal bytes start
+		sum     rolling
+		fresh   = true // the checksum needs to be computed from scratch
+	)
+	addLiteral := func(to int64) {
+		if to > litFrom {
+			d.Ops = append(d.Ops, Op{Offset: litFrom, Length: to - litFrom})
+			d.Literal += to - litFrom
+		}
+	}
+	addBlock := func(i int) {
+		if n := len(d.Ops); n > 0 && !d.Ops[n-1].IsLiteral() && d.Ops[n-1].Block+d.Ops[n-1].Count == i {
+			d.Ops[n-1].Count++
+			return
+		}
+		d.Ops = append(d.Ops, Op{Block: i, Count: 1})
+	}
+	// find returns the old block the window matches, -1 if none. Only the last block can be short.
+	find := func(weak uint32, window []byte) int {
+		idxs, ok := table[weak]
+		if !ok {
+			return -1
+		}
+		strong := strongSum(window)
+		for _, i := range idxs {
+			if req.Blocks[i].Strong == strong && (i < len(req.Blocks)-1 || len(window) == lastLen) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for {
+		window, err := win.at(off, bs)
+		if err != nil {
+			return nil, err
+		}
+		if len(window) < bs {
+			// tail of the file, it can only match the old copy's (short) last block
+			if len(window) > 0 && len(window) == lastLen {
+				if i := find(newRolling(window).sum(), window); i >= 0 {
+					addLiteral(off)
+					addBlock(i)
+					litFrom = off + int64(len(window))
+				}
+			}
+			d.Size = off + int64(len(window))
+			addLiteral(d.Size)
+			return d, nil
+		}
+		if fresh {
+			sum = newRolling(window)
+			fresh = false
+		}
+		if i := find(sum.sum(), window); i >= 0 {
+			addLiteral(off)
+			addBlock(i)
+			off += int64(bs)
+			litFrom = off
+			fresh = true
+			continue
+		}
+		// no match, slide the window one byte (reading more can overwrite window)
+		out := window[0]
+		next, err := win.at(off+1, bs)
+		if err != nil {
+			return nil, err
+		}
+		if len(next) < bs {
+			off++
+			fresh = true // the tail gets checked on its own
+			continue
+		}
+		sum.roll(out, next[bs-1])
+		off++
+	}
+}
+
+// window gives access to a sliding part of a reader without reading it all into memory
+type window struct {
+	r     io.Reader
+	buf   []byte
+	start int64 // offset of buf[0] in the file
+	eof   bool
+}
+
+func newWindow(r io.Reader) *window {
+	return &window{r: r}
+}
+
+// at returns up to n bytes at offset off, less only at the end of the file. Offsets must not
+// go backwards.
+func (w *window) at(off int64, n int) ([]byte, error) {
+	if off < w.start {
+		return nil, errors.New("window can't go backwards")
+	}
+	for !w.eof && off+int64(n) > w.start+int64(len(w.buf)) {
+		// drop what's behind the offset and read more
+		drop := int(off - w.start)
+		if drop > len(w.buf) {
+			drop = len(w.buf)
+		}
+		w.buf = append(w.buf[:0], w.buf[drop:]...)
+		w.start += int64(drop)
+		more := make([]byte, readSize)
+		m, err := io.ReadFull(w.r, more)
+		w.buf = append(w.buf, more[:m]...)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			w.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	from := off - w.start
+	if from > int64(len(w.buf)) {
+		return nil, nil
+	}
+	to := from + int64(n)
+	if to > int64(len(w.buf)) {
+		to = int64(len(w.buf))
+	}
+	return w.buf[from:to], nil
+}
+
+// Write writes the ops to w, reading the literal bytes from the new file
+func Write(w io.Writer, newFile io.ReaderAt, d *Delta) error {
+	bw := bufio.NewWriter(w)
+	varint := make([]byte, binary.MaxVarintLen64)
+	putUvarint := func(v uint64) error {
+		_, err := bw.Write(varint[:binary.PutUvarint(varint, v)])
+		return err
+	}
+	for _, op := range d.Ops {
+		if !op.IsLiteral() {
+			if err := bw.WriteByte(opBlocks); err != nil {
+				return err
+			}
+			if err := putUvarint(uint64(op.Block)); err != nil {
+				return err
+			}
+			if err := putUvarint(uint64(op.Count)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := bw.WriteByte(opLiteral); err != nil {
+			return err
+		}
+		if err := putUvarint(uint64(op.Length)); err != nil {
+			return err
+		}
+		if _, err := io.Copy(bw, io.NewSectionReader(newFile, op.Offset, op.Length)); err != nil {
+			return fmt.Errorf("failed to read literal bytes: %w", err)
+		}
+	}
+	if err := bw.WriteByte(opEnd); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Apply rebuilds the new file into out from the old copy and the ops read from r. It returns the
+// number of bytes written.
+func Apply(old io.ReaderAt, oldSize int64, blockSize int, r io.Reader, out io.Writer) (int64, error) {
+	var (
+		written int64
+		br      = bufio.NewReader(r)
+	)
+	for {
+		op, err := br.ReadByte()
+		if err != nil {
+			return written, fmt.Errorf("delta ended early: %w", err)
+		}
+		switch op {
+		case opEnd:
+			return written, nil
+		case opBlocks:
+			first, err := binary.ReadUvarint(br)
+			if err != nil {
+				return written, fmt.Errorf("bad block op: %w", err)
+			}
+			count, err := binary.ReadUvarint(br)
+			if err != nil {
+				return written, fmt.Errorf("bad block op: %w", err)
+			}
+			from := int64(first) * int64(blockSize)
+			length := int64(count) * int64(blockSize)
+			if from+length > oldSize {
+				length = oldSize - from // last block can be short
+			}
+			if from < 0 || from >= oldSize || length <= 0 {
+				return written, fmt.Errorf("block %d is outside of the old file", first)
+			}
+			n, err := io.Copy(out, io.NewSectionReader(old, from, length))
+			written += n
+			if err != nil {
+				return written, fmt.Errorf("failed to copy blocks: %w", err)
+			}
+		case opLiteral:
+			length, err := binary.ReadUvarint(br)
+			if err != nil {
+				return written, fmt.Errorf("bad literal op: %w", err)
+			}
+			n, err := io.CopyN(out, br, int64(length))
+			written += n
+			if err != nil {
+				return written, fmt.Errorf("failed to copy literal bytes: %w", err)
+			}
+		default:
+			return written, fmt.Errorf("unknown delta op: %q", op)
+		}
+	}
+}
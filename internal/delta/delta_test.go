@@ -0,0 +1,116 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/delta/delta_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the delta module for the csgo sync application.
+*/
+
+package delta
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+// roundTrip makes the delta from old to new, applies it to old and checks the result is new
+func roundTrip(t *testing.T, old, new []byte, blockSize int) *Delta {
+	sigs, err := Signature(bytes.NewReader(old), blockSize)
+	if err != nil {
+		t.Fatal("failed to make signature: ", err)
+	}
+	d, err := Compute(bytes.NewReader(new), models.DeltaRequest{
+		BlockSize: blockSize,
+		Size:      int64(len(old)),
+		Blocks:    sigs,
+	})
+	if err != nil {
+		t.Fatal("failed to compute delta: ", err)
+	}
+	if d.Size != int64(len(new)) {
+		t.Error("delta size got: ", d.Size, " wanted: ", len(new))
+	}
+	var stream, rebuilt bytes.Buffer
+	if err = Write(&stream, bytes.NewReader(new), d); err != nil {
+		t.Fatal("failed to write delta: ", err)
+	}
+	n, err := Apply(bytes.NewReader(old), int64(len(old)), blockSize, &stream, &rebuilt)
+	if err != nil {
+		t.Fatal("failed to apply delta: ", err)
+	}
+	if n != int64(len(new)) || !bytes.Equal(rebuilt.Bytes(), new) {
+		t.Fatal("rebuilt file doesn't match")
+	}
+	return d
+}
+
+func randomBytes(n int, seed int64) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+func TestRollingMatchesFresh(t *testing.T) {
+	data := randomBytes(5000, 1)
+	const n = 700
+	r := newRolling(data[:n])
+	for i := 1; i+n <= len(data); i++ {
+		r.roll(data[i-1], data[i+n-1])
+		if r.sum() != newRolling(data[i:i+n]).sum() {
+			t.Fatal("rolled checksum differs at ", i)
+		}
+	}
+}
+
+func TestUnchanged(t *testing.T) {
+	old := randomBytes(MinBlockSize*10+123, 2)
+	d := roundTrip(t, old, old, MinBlockSize)
+	if d.Literal != 0 {
+		t.Error("unchanged file sent literal bytes: ", d.Literal)
+	}
+}
+
+func TestInsertAndChange(t *testing.T) {
+	old := randomBytes(MinBlockSize*50, 3)
+	// insert some bytes in the middle (shifts everything after) and change some at the end
+	new := append([]byte{}, old[:MinBlockSize*20+17]...)
+	new = append(new, randomBytes(100, 4)...)
+	new = append(new, old[MinBlockSize*20+17:]...)
+	copy(new[len(new)-MinBlockSize*3:], randomBytes(MinBlockSize, 5))
+	d := roundTrip(t, old, new, MinBlockSize)
+	if d.Literal > MinBlockSize*4 {
+		t.Error("too many literal bytes: ", d.Literal)
+	}
+}
+
+func TestShortLastBlocks(t *testing.T) {
+	old := randomBytes(MinBlockSize*3+10, 6)
+	roundTrip(t, old, old[:MinBlockSize*2+5], MinBlockSize)
+	roundTrip(t, old, append(append([]byte{}, old...), 1, 2, 3), MinBlockSize)
+	roundTrip(t, old[:10], old, MinBlockSize)
+}
+
+func TestCompletelyDifferent(t *testing.T) {
+	old := randomBytes(MinBlockSize*8, 7)
+	new := randomBytes(MinBlockSize*8, 8)
+	if d := roundTrip(t, old, new, MinBlockSize); d.Literal != int64(len(new)) {
+		t.Error("expected everything to be literal, got: ", d.Literal)
+	}
+}
+
+func TestBlockSize(t *testing.T) {
+	if bs := BlockSize(100); bs != MinBlockSize {
+		t.Error("small file block size: ", bs)
+	}
+	if bs := BlockSize(1 << 40); bs != MaxBlockSize {
+		t.Error("huge file block size: ", bs)
+	}
+	if bs := BlockSize(150 << 20); bs%1024 != 0 || bs < MinBlockSize || bs > MaxBlockSize {
+		t.Error("150MB block size: ", bs)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/disk/disk.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains finding out how much room is left on a disk.
+*/
+
+package disk
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupported is returned by Space on systems it doesn't know how to ask
+var ErrUnsupported = errors.New("disk space not supported on this system")
+
+// Usage is how big the disk holding a path is and how much of it we can still write to
+type Usage struct {
+	Free  uint64 // bytes available to us (not counting space reserved for root)
+	Total uint64
+}
+
+// ParseSize parses a number of bytes like "100MB", "1.5GiB" or "1048576". KB/MB/GB/TB are powers
+// of 1000 and KiB/MiB/GiB/TiB are powers of 1024. Empty is 0.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	units := []struct {
+		suffix string
+		mult   int64
+	}{ // longest suffixes first so "KiB" isn't mistaken for "B"
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"KB", 1000}, {"MB", 1000 * 1000}, {"GB", 1000 * 1000 * 1000}, {"TB", 1000 * 1000 * 1000 * 1000},
+		{"K", 1000}, {"M", 1000 * 1000}, {"G", 1000 * 1000 * 1000}, {"T", 1000 * 1000 * 1000 * 1000},
+		{"B", 1},
+	}
+	mult := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(strings.ToUpper(s), strings.ToUpper(u.suffix)) {
+			s = strings.TrimSpace(s[:len(s)-len(u.suffix)])
+			mult = u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return int64(n * float64(mult)), nil
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !freebsd && !windows
+// +build !linux,!darwin,!freebsd,!windows
+
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/disk/disk_other.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the fallback for systems we can't get disk space on.
+*/
+
+package disk
+
+// Space returns ErrUnsupported
+func Space(path string) (Usage, error) {
+	return Usage{}, ErrUnsupported
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/disk/disk_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the disk module for the csgo sync application.
+*/
+
+package disk
+
+import "testing"
+
+func TestSpace(t *testing.T) {
+	u, err := Space(t.TempDir())
+	if err == ErrUnsupported {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal("failed to get disk space: ", err)
+	}
+	if u.Total == 0 || u.Free > u.Total {
+		t.Error("got free: ", u.Free, " total: ", u.Total)
+	}
+	if _, err := Space("/does/not/exist"); err == nil {
+		t.Error("no error for a path that doesn't exist")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"":        0,
+		"0":       0,
+		"1048576": 1048576,
+		"100MB":   100000000,
+		"100mb":   100000000,
+		"1.5GiB":  3 << 29,
+		"2 TB":    2000000000000,
+		"512 KiB": 512 << 10,
+		"100B":    100,
+		" 64KiB ": 64 << 10,
+	}
+	for in, want := range tests {
+		if got, err := ParseSize(in); err != nil || got != want {
+			t.Error("[", in, "] got: ", got, err, " wanted: ", want)
+		}
+	}
+	for _, in := range []string{"big", "-5MB", "MB", "10MB/s"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Error("[", in, "] expected an error")
+		}
+	}
+}
@@ -0,0 +1,28 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/disk/disk_unix.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains getting disk space on linux and the bsds.
+*/
+
+package disk
+
+import "syscall"
+
+// Space returns the usage of the disk the path is on
+func Space(path string) (Usage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return Usage{}, err
+	}
+	return Usage{
+		Free:  uint64(st.Bavail) * uint64(st.Bsize),
+		Total: uint64(st.Blocks) * uint64(st.Bsize),
+	}, nil
+}
@@ -0,0 +1,40 @@
+//go:build windows
+// +build windows
+
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/disk/disk_windows.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains getting disk space on winturds.
+*/
+
+package disk
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var getDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// Space returns the usage of the disk the path is on
+func Space(path string) (Usage, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return Usage{}, err
+	}
+	var u Usage
+	ok, _, err := getDiskFreeSpaceEx.Call(
+		uintptr(unsafe.Pointer(p)),
+		uintptr(unsafe.Pointer(&u.Free)),
+		uintptr(unsafe.Pointer(&u.Total)),
+		0,
+	)
+	if ok == 0 {
+		return Usage{}, err
+	}
+	return u, nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/fastdl/fastdl.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the bzip2 compressed FastDL mirror of the map directory for the csgo sync application.
+*/
+
+package fastdl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	Dir       = "maps"                  // FastDL serves maps from <sv_downloadurl>/maps/<map>.bsp.bz2
+	stateFile = ".csgosync-fastdl.json" // hashes of the files the mirror was made from
+)
+
+// Mirror keeps a directory of bzip2 compressed copies of the map directory that source engine
+// game clients can download through sv_downloadurl.
+type Mirror struct {
+	src   string // map directory
+	dst   string // root of the mirror, the files go in dst/maps
+	bzip2 string // path to the bzip2 program
+}
+
+// Status is what happened the last time the mirror was synced
+type Status struct {
+	Compressed []string      // files that were (re)compressed
+	UpToDate   int           // files that were already compressed
+	Removed    []string      // files that aren't on the server anymore
+	Errs       []error       // files that failed
+	Elapsed    time.Duration // how long it took
+}
+
+func (s Status) String() string {
+	return fmt.Sprintf("fastdl mirror: %d compressed, %d up to date, %d removed, %d failed in %v",
+		len(s.Compressed), s.UpToDate, len(s.Removed), len(s.Errs), s.Elapsed)
+}
+
+// NewMirror returns a mirror of src in dst. bzip2 is the program used to compress the files
+// since the standard library can only decompress them.
+func NewMirror(src, dst, bzip2 string) (*Mirror, error) {
+	if bzip2 == "" {
+		bzip2 = "bzip2"
+	}
+	path, err := exec.LookPath(bzip2)
+	if err != nil {
+		return nil, fmt.Errorf("can't find bzip2 program: %w", err)
+	}
+	if err = os.MkdirAll(filepath.Join(dst, Dir), 0755); err != nil {
+		return nil, fmt.Errorf("couldn't create fastdl directory: %w", err)
+	}
+	return &Mirror{src: src, dst: dst, bzip2: path}, nil
+}
+
+// Files returns the directory to serve as <sv_downloadurl>/maps
+func (m *Mirror) Files() string {
+	return filepath.Join(m.dst, Dir)
+}
+
+// Sync compresses every file whose hash changed since it was last compressed and removes the
+// compressed files that aren't in the list anymore. files is file name -> hash.
+func (m *Mirror) Sync(files map[string]string) Status {
+	var (
+		status Status
+		start  = time.Now()
+	)
+	state, err := m.loadState()
+	if err != nil {
+		// start over, everything gets recompressed
+		status.Errs = append(status.Errs, err)
+		state = make(map[string]string)
+	}
+
+	for file, hash := range files {
+		if state[file] == hash && m.exists(file) {
+			status.UpToDate++
+			continue
+		}
+		delete(state, file) // if it fails don't say the old copy is up to date
+		if err = m.compress(file); err != nil {
+			status.Errs = append(status.Errs, err)
+			continue
+		}
+		state[file] = hash
+		status.Compressed = append(status.Compressed, file)
+	}
+
+	// remove files the server doesn't have anymore
+	entries, err := ioutil.ReadDir(filepath.Join(m.dst, Dir))
+	if err != nil {
+		status.Errs = append(status.Errs, fmt.Errorf("couldn't read fastdl directory: %w", err))
+	}
+	for _, entry := range entries {
+		file := strings.TrimSuffix(entry.Name(), ".bz2")
+		if _, ok := files[file]; ok || !entry.Mode().IsRegular() {
+			continue
+		}
+		if err = os.Remove(filepath.Join(m.dst, Dir, entry.Name())); err != nil {
+			status.Errs = append(status.Errs, fmt.Errorf("couldn't remove %s: %w", entry.Name(), err))
+			continue
+		}
+		delete(state, file)
+		status.Removed = append(status.Removed, file)
+	}
+
+	if err = m.saveState(state); err != nil {
+		status.Errs = append(status.Errs, err)
+	}
+	status.Elapsed = time.Since(start)
+	return status
+}
+
+// path returns where the compressed copy of the file goes
+func (m *Mirror) path(file string) string {
+	return filepath.Join(m.dst, Dir, file+".bz2")
+}
+
+func (m *Mirror) exists(file string) bool {
+	info, err := os.Stat(m.path(file))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// compress writes the compressed copy to a tmp file and renames it into place so game clients
+// never get half a file
+func (m *Mirror) compress(file string) error {
+	in, err := os.Open(filepath.Join(m.src, file))
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", file, err)
+	}
+	defer in.Close()
+	tmp := m.path(file) + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmp, err)
+	}
+
+	cmd := exec.Command(m.bzip2, "-c", "-9")
+	cmd.Stdin = in
+	cmd.Stdout = out
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to compress %s: %w %s", file, err, strings.TrimSpace(stderr.String()))
+	}
+	if err = os.Rename(tmp, m.path(file)); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to rename %s: %w", tmp, err)
+	}
+	return nil
+}
+
+func (m *Mirror) loadState() (map[string]string, error) {
+	state := make(map[string]string)
+	b, err := ioutil.ReadFile(filepath.Join(m.dst, stateFile))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read fastdl state: %w", err)
+	}
+	if err = json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("couldn't parse fastdl state: %w", err)
+	}
+	return state, nil
+}
+
+func (m *Mirror) saveState(state map[string]string) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("couldn't marshal fastdl state: %w", err)
+	}
+	tmp := filepath.Join(m.dst, stateFile+".tmp")
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("couldn't write fastdl state: %w", err)
+	}
+	return os.Rename(tmp, filepath.Join(m.dst, stateFile))
+}
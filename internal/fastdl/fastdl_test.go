@@ -0,0 +1,110 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/fastdl/fastdl_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the fastdl mirror.
+*/
+
+package fastdl
+
+import (
+	"compress/bzip2"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// newTestMirror returns a mirror of a map directory with the files in it
+func newTestMirror(t *testing.T, files map[string]string) (*Mirror, string) {
+	t.Helper()
+	if _, err := exec.LookPath("bzip2"); err != nil {
+		t.Skip("no bzip2 program: ", err)
+	}
+	src := t.TempDir()
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := NewMirror(src, t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, src
+}
+
+// decompress returns what the mirror has for the file
+func decompress(t *testing.T, m *Mirror, file string) string {
+	t.Helper()
+	f, err := os.Open(filepath.Join(m.Files(), file+".bz2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(bzip2.NewReader(f))
+	if err != nil {
+		t.Fatal("[", file, "] not bzip2: ", err)
+	}
+	return string(b)
+}
+
+func TestSync(t *testing.T) {
+	m, src := newTestMirror(t, map[string]string{"de_a.bsp": "aaaa", "de_b.bsp": "bbbb"})
+	status := m.Sync(map[string]string{"de_a.bsp": "a0", "de_b.bsp": "b0"})
+	sort.Strings(status.Compressed)
+	if len(status.Errs) > 0 || !reflect.DeepEqual(status.Compressed, []string{"de_a.bsp", "de_b.bsp"}) {
+		t.Fatal("first sync got: ", status)
+	}
+	// maps/<file>.bz2 like sv_downloadurl wants
+	if got := decompress(t, m, "de_a.bsp"); got != "aaaa" {
+		t.Error("de_a.bsp got: ", got)
+	}
+	if m.Files() != filepath.Join(m.dst, "maps") {
+		t.Error("files got: ", m.Files())
+	}
+
+	// only the file whose hash changed is compressed again
+	if err := ioutil.WriteFile(filepath.Join(src, "de_b.bsp"), []byte("bbbb2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	status = m.Sync(map[string]string{"de_a.bsp": "a0", "de_b.bsp": "b1"})
+	if len(status.Errs) > 0 || status.UpToDate != 1 || !reflect.DeepEqual(status.Compressed, []string{"de_b.bsp"}) {
+		t.Error("second sync got: ", status)
+	}
+	if got := decompress(t, m, "de_b.bsp"); got != "bbbb2" {
+		t.Error("de_b.bsp got: ", got)
+	}
+	status = m.Sync(map[string]string{"de_a.bsp": "a0", "de_b.bsp": "b1"})
+	if status.UpToDate != 2 || len(status.Compressed) != 0 {
+		t.Error("unchanged sync got: ", status)
+	}
+
+	// deleted from the map directory, so it goes from the mirror too
+	status = m.Sync(map[string]string{"de_a.bsp": "a0"})
+	if len(status.Errs) > 0 || !reflect.DeepEqual(status.Removed, []string{"de_b.bsp"}) {
+		t.Error("removing sync got: ", status)
+	}
+	if _, err := os.Stat(filepath.Join(m.Files(), "de_b.bsp.bz2")); !os.IsNotExist(err) {
+		t.Error("de_b.bsp.bz2 is still there: ", err)
+	}
+}
+
+func TestSyncMissingCopy(t *testing.T) {
+	// someone deleted the compressed copy, the state saying it's up to date isn't enough
+	m, _ := newTestMirror(t, map[string]string{"de_a.bsp": "aaaa"})
+	m.Sync(map[string]string{"de_a.bsp": "a0"})
+	if err := os.Remove(filepath.Join(m.Files(), "de_a.bsp.bz2")); err != nil {
+		t.Fatal(err)
+	}
+	status := m.Sync(map[string]string{"de_a.bsp": "a0"})
+	if !reflect.DeepEqual(status.Compressed, []string{"de_a.bsp"}) {
+		t.Error("got: ", status)
+	}
+}
@@ -11,9 +11,12 @@
 package filelist_test
 
 import (
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
 	"github.com/kthomas422/csgosync/internal/filelist"
+	"github.com/kthomas422/csgosync/internal/ignore"
 )
 
 var (
@@ -43,7 +46,7 @@ var (
 )
 
 func TestGenerateMap(t *testing.T) {
-	laMap, err := filelist.GenerateMap("test")
+	laMap, err := filelist.GenerateMap("test", nil)
 	if err != nil {
 		t.Fatal("couldn't get hash map")
 	}
@@ -54,6 +57,23 @@ func TestGenerateMap(t *testing.T) {
 	}
 }
 
+func TestGenerateMapIgnored(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"de_x.bsp", "de_x.bsp.tmp", "de_x.bsp.bak", ignore.File} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := ignore.Load(dir, nil, []string{"*.bak"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, errs := filelist.GenerateMap(dir, m)
+	if len(errs) > 0 || len(files) != 1 || files["de_x.bsp"] == "" {
+		t.Error("got: ", files, errs)
+	}
+}
+
 func TestComparemaps(t *testing.T) {
 	delta := filelist.CompareMaps(testMap, clientMap)
 	if len(delta) != len(deltaMap) {
@@ -19,8 +19,13 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+
+	"github.com/kthomas422/csgosync/internal/ignore"
 )
 
+// Algorithm is the name of the hash HashFile computes
+const Algorithm = "sha1"
+
 // loadFiles loads the list of files in the directory
 func loadFiles(dir string) (files []string, err error) {
 	if len(dir) < 1 {
@@ -44,61 +49,64 @@ func loadFiles(dir string) (files []string, err error) {
 
 // hashFiles takes a list of files and computes the hashes of the files
 func hashFiles(files []string) ([]string, []error) {
-	const bufSize = 16777216 // 16.7MB
 	var (
-		hasher  = sha1.New()
-		hashes  = make([]string, len(files))
-		f       *os.File
-		err     error
-		fileErr error // file specific error
-		errs    []error
+		hashes = make([]string, len(files))
+		errs   []error
 	)
-	// iterate over files and hash them
-	// TODO: this needs a lot of cleaning up
 	for i, file := range files {
-		f, err = os.Open(file)
+		hash, err := HashFile(file)
 		if err != nil {
-			errs = append(errs, fmt.Errorf("failed to open file: %s: %w", file, err))
-			if f != nil {
-				if err = f.Close(); err != nil {
-					errs = append(errs, fmt.Errorf("failed to close file: %s, %w", file, err))
-				}
-			}
+			errs = append(errs, err)
 			continue
 		}
+		hashes[i] = hash
+	}
+	return hashes, errs
+}
+
+// HashFile computes the hash of a single file, it's how the hash map hashes every file so
+// downloads can be checked against it
+func HashFile(file string) (string, error) {
+	const bufSize = 16777216 // 16.7MB
+	hasher := sha1.New()
+	f, err := os.Open(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %s: %w", file, err)
+	}
+	defer f.Close()
 
-		// consume the file in chunks (was way more fun to read the whole file at once but will
-		// fill up the ram on a micro aws instance).
-		buf := make([]byte, bufSize)
-		for fileErr != io.EOF {
-			_, fileErr = f.Read(buf)
-			if fileErr != nil && fileErr != io.EOF {
-				errs = append(errs, fmt.Errorf("error reading file: %s: %w", file, fileErr))
-				hasher.Reset()
-				continue
-			}
-			_, err = hasher.Write(buf)
-			if err != nil {
-				errs = append(errs, fmt.Errorf("could not put bytes in hasher: %s: %w", file, err))
-			}
+	// consume the file in chunks (was way more fun to read the whole file at once but will
+	// fill up the ram on a micro aws instance). Only the bytes read go in the hasher so the
+	// hash is the same as sha1sum's.
+	buf := make([]byte, bufSize)
+	for {
+		n, readErr := f.Read(buf)
+		if _, err := hasher.Write(buf[:n]); err != nil {
+			return "", fmt.Errorf("could not put bytes in hasher: %s: %w", file, err)
 		}
-		if err = f.Close(); err != nil {
-			errs = append(errs, fmt.Errorf("error closing file: %s: %w ", file, err))
+		if readErr == io.EOF {
+			break
+		} else if readErr != nil {
+			return "", fmt.Errorf("error reading file: %s: %w", file, readErr)
 		}
-		hashes[i] = hex.EncodeToString(hasher.Sum(nil))
-		hasher.Reset() // reset the hasher for the next file
 	}
-
-	return hashes, errs
+	return hex.EncodeToString(hasher.Sum(nil)), nil
 }
 
-// GenerateMap makes a map with the list of files from the directory and the file's hash
-func GenerateMap(dir string) (map[string]string, []error) {
+// GenerateMap makes a map with the list of files from the directory and the file's hash, files
+// the matcher ignores are left out
+func GenerateMap(dir string, m *ignore.Matcher) (map[string]string, []error) {
 	var (
 		maps = make(map[string]string)
 		errs []error
 	)
-	files, err := loadFiles(dir)
+	all, err := loadFiles(dir)
+	var files []string
+	for _, file := range all {
+		if !m.Ignored(filepath.Base(file)) {
+			files = append(files, file)
+		}
+	}
 	if len(files) == 0 {
 		return maps, nil // return empty map since no files
 	}
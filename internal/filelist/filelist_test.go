@@ -10,7 +10,14 @@
 
 package filelist
 
-import "testing"
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
 
 var (
 	testFiles = []string{
@@ -19,6 +26,7 @@ var (
 		"../../test/t3.txt",
 	}
 
+	// sha1sum test/*
 	testHashes = []string{
 		"22596363b3de40b06f981fb85d82312e8c0ed511",
 		"648a6a6ffffdaa0badb23b8baf90b6168dd16b3a",
@@ -52,3 +60,34 @@ func TestHashFiles(t *testing.T) {
 		}
 	}
 }
+
+func TestHashFile(t *testing.T) {
+	// every file on its own has to come out the same as with the others, in any order
+	for i := len(testFiles) - 1; i >= 0; i-- {
+		if hash, err := HashFile(testFiles[i]); err != nil || hash != testHashes[i] {
+			t.Error("[", testFiles[i], "] got: ", hash, err, " wanted: ", testHashes[i])
+		}
+	}
+
+	// bigger than the read buffer so it takes more than one read
+	dir := t.TempDir()
+	big := bytes.Repeat([]byte("de_dust2"), 16777216/8+1000)
+	sum := sha1.Sum(big)
+	tests := []struct {
+		name string
+		data []byte
+		hash string
+	}{
+		{"empty", nil, "da39a3ee5e6b4b0d3255bfef95601890afd80709"},
+		{"big", big, hex.EncodeToString(sum[:])},
+	}
+	for _, test := range tests {
+		file := filepath.Join(dir, test.name)
+		if err := ioutil.WriteFile(file, test.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if hash, err := HashFile(file); err != nil || hash != test.hash {
+			t.Error("[", test.name, "] got: ", hash, err, " wanted: ", test.hash)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/firewall/firewall.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the ip allow/deny lists, per ip request limits and bans for the server.
+*/
+
+package firewall
+
+import (
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+const sweepInterval = time.Minute // how often forgotten ips are cleaned out
+
+// Verdict is what the firewall decided about a request
+type Verdict int
+
+const (
+	Pass    Verdict = iota // let it through
+	Denied                 // not in the allow list or in the deny list
+	Banned                 // too many failed logins
+	Limited                // too many requests
+)
+
+// Config is how the firewall is set up
+type Config struct {
+	Allow         []*net.IPNet  // only these can connect, empty is everyone
+	Deny          []*net.IPNet  // these can't connect even if they're in Allow
+	Rate          float64       // requests per second per ip, 0 is unlimited
+	Burst         int           // most requests an ip can make at once, defaults to a second worth
+	MaxFailures   int           // failed logins before an ip is banned, 0 never bans
+	FailureWindow time.Duration // failed logins older than this are forgotten
+	BanTime       time.Duration // how long bans last
+}
+
+// Firewall decides which requests get through
+type Firewall struct {
+	c Config
+
+	mu        sync.Mutex
+	limits    map[string]*tokens  // request limit of every ip that made a request recently
+	offenders map[string]*offense // ips that failed to log in recently or are banned
+	lastSweep time.Time
+	now       func() time.Time // for tests
+}
+
+// tokens is a request rate limit, a request takes a token and they refill at the rate
+type tokens struct {
+	n    float64
+	last time.Time
+}
+
+// offense is the failed logins of an ip
+type offense struct {
+	failures int
+	first    time.Time // first failure in the window
+	until    time.Time // banned until
+}
+
+// New creates a firewall
+func New(c Config) *Firewall {
+	if c.Burst <= 0 {
+		c.Burst = int(math.Ceil(c.Rate))
+	}
+	return &Firewall{
+		c:         c,
+		limits:    make(map[string]*tokens),
+		offenders: make(map[string]*offense),
+		now:       time.Now,
+	}
+}
+
+// Check decides if a request from the ip gets through, if it doesn't and retrying later could
+// help it also says how long to wait
+func (f *Firewall) Check(ip net.IP) (Verdict, time.Duration) {
+	if ip == nil || contains(f.c.Deny, ip) || (len(f.c.Allow) > 0 && !contains(f.c.Allow, ip)) {
+		return Denied, 0
+	}
+	key := ip.String()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+	f.sweep(now)
+
+	if o, ok := f.offenders[key]; ok && now.Before(o.until) {
+		return Banned, o.until.Sub(now)
+	}
+	if f.c.Rate <= 0 {
+		return Pass, 0
+	}
+	t, ok := f.limits[key]
+	if !ok {
+		t = &tokens{n: float64(f.c.Burst), last: now}
+		f.limits[key] = t
+	}
+	t.refill(now, f.c.Rate, f.c.Burst)
+	if t.n < 1 {
+		return Limited, time.Duration((1 - t.n) / f.c.Rate * float64(time.Second))
+	}
+	t.n--
+	return Pass, 0
+}
+
+// Failure records a failed login from the ip, it returns true if that got the ip banned
+func (f *Firewall) Failure(ip net.IP) bool {
+	if f.c.MaxFailures <= 0 || ip == nil {
+		return false
+	}
+	key := ip.String()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+	o, ok := f.offenders[key]
+	if !ok || now.Sub(o.first) > f.c.FailureWindow {
+		o = &offense{first: now, until: o.untilOrZero()}
+		f.offenders[key] = o
+	}
+	o.failures++
+	if o.failures < f.c.MaxFailures {
+		return false
+	}
+	o.failures = 0
+	o.first = now
+	o.until = now.Add(f.c.BanTime)
+	return true
+}
+
+// Unban lifts the ban on the ip and forgets its failed logins, it returns false if it wasn't banned
+func (f *Firewall) Unban(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	key := ip.String()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	o, ok := f.offenders[key]
+	delete(f.offenders, key)
+	return ok && f.now().Before(o.until)
+}
+
+// Status returns how the firewall is set up and who is banned
+func (f *Firewall) Status() models.FirewallStatus {
+	status := models.FirewallStatus{
+		Allow:         cidrs(f.c.Allow),
+		Deny:          cidrs(f.c.Deny),
+		RequestRate:   f.c.Rate,
+		RequestBurst:  f.c.Burst,
+		MaxFailures:   f.c.MaxFailures,
+		FailureWindow: f.c.FailureWindow.String(),
+		BanTime:       f.c.BanTime.String(),
+		Bans:          []models.Ban{},
+		Failures:      make(map[string]int),
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+	for ip, o := range f.offenders {
+		if now.Before(o.until) {
+			status.Bans = append(status.Bans, models.Ban{IP: ip, Until: o.until})
+		}
+		if o.failures > 0 && now.Sub(o.first) <= f.c.FailureWindow {
+			status.Failures[ip] = o.failures
+		}
+	}
+	sort.Slice(status.Bans, func(i, j int) bool { return status.Bans[i].Until.Before(status.Bans[j].Until) })
+	return status
+}
+
+// sweep forgets ips that have a full bucket of requests and no failures or bans that matter.
+// Must hold the lock.
+func (f *Firewall) sweep(now time.Time) {
+	if now.Sub(f.lastSweep) < sweepInterval {
+		return
+	}
+	f.lastSweep = now
+	for ip, t := range f.limits {
+		t.refill(now, f.c.Rate, f.c.Burst)
+		if t.n >= float64(f.c.Burst) {
+			delete(f.limits, ip)
+		}
+	}
+	for ip, o := range f.offenders {
+		if !now.Before(o.until) && now.Sub(o.first) > f.c.FailureWindow {
+			delete(f.offenders, ip)
+		}
+	}
+}
+
+// refill adds the tokens earned since the last request
+func (t *tokens) refill(now time.Time, rate float64, burst int) {
+	t.n = math.Min(float64(burst), t.n+now.Sub(t.last).Seconds()*rate)
+	t.last = now
+}
+
+// untilOrZero keeps a ban going when the failure window starts over
+func (o *offense) untilOrZero() time.Time {
+	if o == nil {
+		return time.Time{}
+	}
+	return o.until
+}
+
+// contains returns whether the ip is in any of the networks
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func cidrs(nets []*net.IPNet) []string {
+	s := make([]string, len(nets))
+	for i, n := range nets {
+		s[i] = n.String()
+	}
+	return s
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/firewall/firewall_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the firewall module for the csgo sync application.
+*/
+
+package firewall
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func cidr(t *testing.T, s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// clock is a time that only moves when told to
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func TestAllowDeny(t *testing.T) {
+	f := New(Config{
+		Allow: []*net.IPNet{cidr(t, "10.0.0.0/8"), cidr(t, "2001:db8::/32")},
+		Deny:  []*net.IPNet{cidr(t, "10.6.6.0/24")},
+	})
+	var tests = []struct {
+		ip   string
+		want Verdict
+	}{
+		{"10.1.2.3", Pass},
+		{"2001:db8::1", Pass},
+		{"192.168.1.1", Denied},
+		{"10.6.6.6", Denied},
+	}
+	for _, test := range tests {
+		if got, _ := f.Check(net.ParseIP(test.ip)); got != test.want {
+			t.Error("[", test.ip, "] got: ", got, " wanted: ", test.want)
+		}
+	}
+	if got, _ := New(Config{}).Check(net.ParseIP("192.168.1.1")); got != Pass {
+		t.Error("empty allow list should allow everyone, got: ", got)
+	}
+}
+
+func TestRequestLimit(t *testing.T) {
+	c := &clock{t: time.Unix(1000, 0)}
+	f := New(Config{Rate: 2, Burst: 3})
+	f.now = c.now
+	a, b := net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")
+	for i := 0; i < 3; i++ {
+		if got, _ := f.Check(a); got != Pass {
+			t.Fatal("request ", i, " got: ", got, " wanted: ", Pass)
+		}
+	}
+	got, wait := f.Check(a)
+	if got != Limited || wait <= 0 || wait > time.Second/2 {
+		t.Error("over the burst got: ", got, " wait: ", wait)
+	}
+	if got, _ := f.Check(b); got != Pass {
+		t.Error("other ip got: ", got, " wanted: ", Pass)
+	}
+	c.t = c.t.Add(time.Second / 2)
+	if got, _ := f.Check(a); got != Pass {
+		t.Error("after refill got: ", got, " wanted: ", Pass)
+	}
+}
+
+func TestBans(t *testing.T) {
+	c := &clock{t: time.Unix(1000, 0)}
+	f := New(Config{MaxFailures: 3, FailureWindow: time.Minute, BanTime: time.Hour})
+	f.now = c.now
+	ip := net.ParseIP("192.0.2.1")
+
+	// failures outside the window are forgotten
+	f.Failure(ip)
+	f.Failure(ip)
+	c.t = c.t.Add(2 * time.Minute)
+	if f.Failure(ip) {
+		t.Fatal("banned for failures outside the window")
+	}
+	if f.Failure(ip) || !f.Failure(ip) {
+		t.Fatal("not banned after 3 failures in the window")
+	}
+	if got, wait := f.Check(ip); got != Banned || wait != time.Hour {
+		t.Error("banned ip got: ", got, " wait: ", wait)
+	}
+	if s := f.Status(); len(s.Bans) != 1 || s.Bans[0].IP != "192.0.2.1" {
+		t.Error("status bans got: ", s.Bans)
+	}
+
+	c.t = c.t.Add(time.Hour)
+	if got, _ := f.Check(ip); got != Pass {
+		t.Error("after the ban got: ", got, " wanted: ", Pass)
+	}
+
+	f.Failure(ip)
+	f.Failure(ip)
+	f.Failure(ip)
+	if !f.Unban(ip) {
+		t.Error("unban of a banned ip returned false")
+	}
+	if got, _ := f.Check(ip); got != Pass {
+		t.Error("after unban got: ", got, " wanted: ", Pass)
+	}
+}
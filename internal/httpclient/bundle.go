@@ -0,0 +1,122 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpclient/bundle.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the client side of downloading many small files at once as a tar.
+*/
+
+package httpclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+
+	"github.com/kthomas422/csgosync/internal/bundle"
+	"github.com/kthomas422/csgosync/internal/models"
+	"github.com/kthomas422/csgosync/internal/output"
+	"github.com/kthomas422/csgosync/internal/ratelimit"
+)
+
+const (
+	bundleMaxFileSize = 1 << 20  // files smaller than this are downloaded in bundles
+	bundleMaxFiles    = 1000     // most files in one bundle
+	bundleMaxSize     = 64 << 20 // most bytes in one bundle
+)
+
+// bundles splits the small files the server sent hashes and sizes for into bundles, the rest
+// are returned to be downloaded on their own
+func bundles(resp *models.FileResponse) (batches [][]string, single []string) {
+	var (
+		batch []string
+		size  int64
+	)
+	for _, file := range resp.Files {
+		fileSize, ok := resp.Sizes[file]
+		if !ok || !supports(models.FeatureBundle) || resp.Hashes[file] == "" || fileSize >= bundleMaxFileSize || !bundle.SafeName(file) {
+			single = append(single, file)
+			continue
+		}
+		if len(batch) == bundleMaxFiles || size+fileSize > bundleMaxSize {
+			batches = append(batches, batch)
+			batch, size = nil, 0
+		}
+		batch = append(batch, file)
+		size += fileSize
+	}
+	if len(batch) > 1 {
+		batches = append(batches, batch)
+	} else {
+		single = append(single, batch...) // not worth a bundle
+	}
+	return batches, single
+}
+
+// downloadBundle downloads the files as one gzipped tar and extracts them into mapDir, checking
+// every file's hash. It returns the files that were put in place and their sizes, whatever isn't
+// in there has to be downloaded on its own.
+func downloadBundle(uri, pass, mapDir string, files []string, hashes map[string]string, out *output.Output) (map[string]int64, error) {
+	done := make(map[string]int64)
+	jsonBody, err := json.Marshal(models.BundleRequest{Files: files, Compress: "gzip"})
+	if err != nil {
+		return done, fmt.Errorf("failed to create request body: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint(uri, "/bundle"), bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return done, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Add("pass", pass)
+	resp, err := httpClient.client.Do(req)
+	if err != nil {
+		return done, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return done, statusError(resp)
+	}
+
+	var body io.Reader = ratelimit.Reader(resp.Body, httpClient.limit)
+	if resp.Header.Get("Content-Type") == "application/gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return done, fmt.Errorf("failed to decompress bundle: %w", err)
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	want := make(map[string]bool, len(files))
+	for _, file := range files {
+		want[file] = true
+	}
+	_, err = bundle.Extract(body, mapDir, want, func(name, tmp string) error {
+		out.Emit(models.Event{Type: models.EventFileStart, File: name})
+		if err := install(tmp, filepath.Join(mapDir, name), hashes[name]); err != nil {
+			out.Printf("file: %s from bundle failed: %v\n", name, err)
+			return err
+		}
+		if n, err := fileSize(filepath.Join(mapDir, name)); err == nil {
+			done[name] = n
+		}
+		return nil
+	})
+	return done, err
+}
+
+// sortedFiles returns the files in the map in order
+func sortedFiles(m map[string]int64) []string {
+	files := make([]string, 0, len(m))
+	for file := range m {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpclient/chunks.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the client side of chunked downloads using the local chunk store.
+*/
+
+package httpclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/kthomas422/csgosync/internal/chunk"
+	"github.com/kthomas422/csgosync/internal/concurrency"
+	"github.com/kthomas422/csgosync/internal/models"
+	"github.com/kthomas422/csgosync/internal/output"
+	"github.com/kthomas422/csgosync/internal/ratelimit"
+)
+
+// SetChunkStore turns on chunked downloads, keeping the chunks in dir
+func SetChunkStore(dir string) error {
+	store, err := chunk.NewStore(dir)
+	if err != nil {
+		return err
+	}
+	httpClient.chunks = store
+	return nil
+}
+
+// downloadChunks gets the chunked manifest of the file, downloads only the chunks that aren't in
+// the chunk store and puts them together into tmp
+func downloadChunks(uri, pass, file, dst, tmp string, concOH *concurrency.OverHead, out *output.Output) (int64, error) {
+	var l models.ChunkList
+	concOH.HttpSem <- concurrency.Token{} // "take token"
+	err := getJson(endpoint(uri, "/chunks/")+file, pass, &l)
+	<-concOH.HttpSem
+	if err != nil {
+		return 0, fmt.Errorf("failed to get chunk list: %w", err)
+	}
+
+	// the old copy probably has most of the chunks
+	if _, err = os.Stat(dst); err == nil {
+		if err = httpClient.chunks.AddFile(dst); err != nil {
+			out.Printf("file: %s couldn't add old copy to chunk store: %v\n", file, err)
+		}
+	}
+
+	var missing []models.Chunk
+	need := make(map[string]bool)
+	for _, c := range l.Chunks {
+		if !httpClient.chunks.Has(c) && !need[c.Hash] {
+			need[c.Hash] = true
+			missing = append(missing, c)
+		}
+	}
+	out.Emit(models.Event{Type: models.EventFileStart, File: file, Total: l.Size})
+	out.Printf("file: %s needs %d of %d chunks\n", file, len(missing), len(l.Chunks))
+
+	var fetched int64
+	for _, c := range missing {
+		concOH.HttpSem <- concurrency.Token{}
+		err = fetchChunk(uri, pass, c)
+		<-concOH.HttpSem
+		if err != nil {
+			return 0, err
+		}
+		fetched += c.Size
+		out.Emit(models.Event{Type: models.EventFileProgress, File: file, Bytes: fetched})
+	}
+
+	// put the file together
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create file: %w", err)
+	}
+	var n int64
+	for _, c := range l.Chunks {
+		var in *os.File
+		if in, err = httpClient.chunks.Open(c.Hash); err != nil {
+			break
+		}
+		var m int64
+		m, err = io.Copy(f, in)
+		n += m
+		_ = in.Close()
+		if err != nil {
+			break
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return n, fmt.Errorf("failed to put chunks together: %w", err)
+	}
+	return n, nil
+}
+
+// fetchChunk downloads a chunk into the chunk store
+func fetchChunk(uri, pass string, c models.Chunk) error {
+	req, err := http.NewRequest(http.MethodGet, endpoint(uri, "/chunk/")+c.Hash, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Add("pass", pass)
+	resp, err := httpClient.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download chunk: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download chunk %s: %w", c.Hash, statusError(resp))
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(ratelimit.Reader(resp.Body, httpClient.limit), chunk.MaxSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to download chunk: %w", err)
+	}
+	return httpClient.chunks.Put(c.Hash, data)
+}
+
+// getJson gets the uri and unmarshals the response into v
+func getJson(uri, pass string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Add("pass", pass)
+	resp, err := httpClient.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	respContents, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+	if err = json.Unmarshal(respContents, v); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
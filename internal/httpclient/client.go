@@ -12,6 +12,7 @@ package httpclient
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -19,22 +20,34 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
+	"github.com/kthomas422/csgosync/internal/backup"
+	"github.com/kthomas422/csgosync/internal/chunk"
 	"github.com/kthomas422/csgosync/internal/concurrency"
+	"github.com/kthomas422/csgosync/internal/filelist"
+	"github.com/kthomas422/csgosync/internal/output"
+	"github.com/kthomas422/csgosync/internal/ratelimit"
+	"github.com/kthomas422/csgosync/internal/zstd"
 
 	"github.com/kthomas422/csgosync/internal/models"
 )
 
 const (
-	timeOut                = 3600 // 1 hour to finish downloads, may need to increase?
-	maxConcurrentDownloads = 64   // Limit download to 64 files at a time
-	maxOpenFiles           = 64   // Limit to 64 files open at once
+	timeOut                = 3600            // 1 hour to finish downloads, may need to increase?
+	maxConcurrentDownloads = 64              // Limit download to 64 files at a time
+	maxOpenFiles           = 64              // Limit to 64 files open at once
+	progressInterval       = time.Second / 4 // How often to emit download progress
 )
 
 // Wrapper for builtin http client
 var httpClient struct {
-	client *http.Client
+	client  *http.Client
+	limit   *ratelimit.Bucket // download bandwidth shared by all downloads, nil is unlimited
+	chunks  *chunk.Store      // chunks from earlier downloads, nil if chunked downloads are off
+	backups *backup.Store     // where replaced files go, nil if backups are off
+	zstd    string            // zstd program to decompress downloads with, empty if it isn't installed
 }
 
 // Create http client on startup
@@ -44,7 +57,28 @@ func init() {
 	}
 }
 
-// SendServerHashes sends the server the hashmap and returns a list of files that were missing or different.
+// SetZstd finds the zstd program (looked for if path is empty) so maps can be downloaded zstd
+// compressed, they're gzipped if it isn't installed
+func SetZstd(path string) error {
+	program, err := zstd.Program(path)
+	if err != nil {
+		return err
+	}
+	httpClient.zstd = program
+	return nil
+}
+
+// SetRateLimit limits the download bandwidth of all downloads combined to rate bytes per second
+func SetRateLimit(rate, burst int64) {
+	httpClient.limit = ratelimit.NewBucket(rate, burst)
+}
+
+// SetBackups keeps the files downloads replace in store
+func SetBackups(store *backup.Store) {
+	httpClient.backups = store
+}
+
+// SendServerHashes sends the server at uri the hashmap and returns a list of files that were missing or different.
 func SendServerHashes(uri, pass string, body models.FileHashMap) (*models.FileResponse, error) {
 	var filesResp = new(models.FileResponse)
 
@@ -53,7 +87,7 @@ func SendServerHashes(uri, pass string, body models.FileHashMap) (*models.FileRe
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request body: %w", err)
 	}
-	req, err := http.NewRequest(http.MethodPost, uri, bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequest(http.MethodPost, endpoint(uri, "/sync"), bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -72,7 +106,7 @@ func SendServerHashes(uri, pass string, body models.FileHashMap) (*models.FileRe
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 	if resp.StatusCode != http.StatusOK {
-		return filesResp, fmt.Errorf("bad http status: %s", resp.Status)
+		return filesResp, parseError(resp, respContents)
 	}
 	err = json.Unmarshal(respContents, &filesResp)
 	if err != nil {
@@ -82,80 +116,234 @@ func SendServerHashes(uri, pass string, body models.FileHashMap) (*models.FileRe
 	return filesResp, nil
 }
 
-// Downloads the files from the server that we need
-func DownloadFiles(uri, pass, mapDir string, files []string) {
+// DownloadFiles downloads the files from the server that we need and returns the totals. If the
+// server sent the hashes of the files the downloads are checked against them and small files are
+// downloaded in bundles.
+func DownloadFiles(uri, pass, mapDir string, files *models.FileResponse, out *output.Output) models.Summary {
 	var (
-		concOH = concurrency.InitOH(maxConcurrentDownloads, maxOpenFiles)
+		concOH  = concurrency.InitOH(maxConcurrentDownloads, maxOpenFiles)
+		mu      sync.Mutex // protects summary
+		summary = models.Summary{Needed: len(files.Files)}
 	)
-	for _, file := range files {
+	httpClient.backups.Start() // everything this sync replaces goes in one backup
+	record := func(file string, n int64, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		summary.Bytes += n
+		if err != nil {
+			summary.Failed++
+			summary.FailedFiles = append(summary.FailedFiles, file)
+			out.Emit(models.Event{Type: models.EventFileFailed, File: file, Bytes: n, Error: err.Error()})
+			return
+		}
+		summary.Downloaded++
+		out.Emit(models.Event{Type: models.EventFileDone, File: file, Bytes: n})
+	}
+	download := func(file string) {
 		concOH.Wg.Add(1)
-		go downloadFile(uri, file, mapDir, concOH)
+		go func() {
+			defer concOH.Wg.Done() // Signal that download is done
+			n, err := downloadFile(uri, pass, file, files.Hashes[file], mapDir, concOH, out)
+			record(file, n, err)
+		}()
+	}
+
+	batches, single := bundles(files)
+	for _, file := range single {
+		download(file)
+	}
+	// bundles go one at a time while the big files download, anything that didn't make it out
+	// of a bundle gets downloaded on its own
+	for _, batch := range batches {
+		done, err := downloadBundle(uri, pass, mapDir, batch, files.Hashes, out)
+		if err != nil {
+			out.Printf("bundle of %d files failed, downloading them one at a time: %v\n", len(batch), err)
+		}
+		for _, file := range sortedFiles(done) {
+			record(file, done[file], nil)
+		}
+		for _, file := range batch {
+			if _, ok := done[file]; !ok {
+				download(file)
+			}
+		}
 	}
 	concOH.Wg.Wait()
+	if err := httpClient.backups.Prune(); err != nil {
+		out.Printf("failed to clean up old backups: %v\n", err)
+	}
+	return summary
 }
 
-// download the file from the url onto local drive with same name
-// TODO: find a pretty way to print progress bar
-// TODO: cleanup the 10000000 error branches
-func downloadFile(uri, file, mapDir string, concOH *concurrency.OverHead) {
-	defer concOH.Wg.Done() // Signal that download is done
+// download the file from the url onto local drive with same name, returns the number of bytes written.
+// With chunked downloads on only the chunks we don't have are downloaded, otherwise if we have an
+// old copy of the file only the blocks that changed are downloaded.
+func downloadFile(uri, pass, file, hash, mapDir string, concOH *concurrency.OverHead, out *output.Output) (int64, error) {
+	var (
+		dst = filepath.Join(mapDir, file)
+		tmp = dst + ".tmp"
+	)
+	concOH.FileSem <- concurrency.Token{}
+	defer func() { <-concOH.FileSem }() // release token
+
+	// only bother with chunks or a delta if we can check the rebuilt file
+	n, err := int64(0), errNoDelta
+	if hash != "" && httpClient.chunks != nil && supports(models.FeatureChunks) {
+		n, err = downloadChunks(uri, pass, file, dst, tmp, concOH, out)
+		if err != nil {
+			out.Printf("file: %s chunked download failed, downloading the whole file: %v\n", file, err)
+		}
+	} else if hash != "" && supports(models.FeatureDelta) {
+		concOH.HttpSem <- concurrency.Token{} // "take token"
+		n, err = downloadDelta(uri, pass, file, dst, tmp, out)
+		<-concOH.HttpSem
+		if err != nil && err != errNoDelta {
+			out.Printf("file: %s delta failed, downloading the whole file: %v\n", file, err)
+		}
+	}
+	if err != nil {
+		n, err = downloadFull(uri, pass, file, tmp, concOH, out)
+	}
+	if err != nil {
+		return n, err
+	}
+	return n, install(tmp, dst, hash)
+}
+
+// downloadFull downloads the whole file into tmp. The server compresses the file with zstd or gzip
+// if it can, it's decompressed on the way to the disk.
+func downloadFull(uri, pass, file, tmp string, concOH *concurrency.OverHead, out *output.Output) (int64, error) {
+	req, err := http.NewRequest(http.MethodGet, endpoint(uri, "/maps/")+file, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Add("pass", pass)
+	// setting this ourselves means the transport leaves the body compressed for us to handle
+	if httpClient.zstd != "" {
+		req.Header.Set("Accept-Encoding", "zstd, gzip")
+	} else {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
 
 	// get data
 	concOH.HttpSem <- concurrency.Token{} // "take token"
-	resp, err := httpClient.client.Get(uri + "/maps/" + file)
+	resp, err := httpClient.client.Do(req)
 	<-concOH.HttpSem
 	if err != nil {
-		fmt.Printf("failed to download file: %v\n", err)
-		return
+		return 0, fmt.Errorf("failed to download file: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			out.Printf("unable to close server response body: %v\n", err)
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return 0, statusError(resp)
+	}
+	total := resp.ContentLength // size on the wire, -1 if the server didn't say (compressed)
+	if total < 0 {
+		total = 0
 	}
+	out.Emit(models.Event{Type: models.EventFileStart, File: file, Total: total})
 
 	// create tmp file
-	concOH.FileSem <- concurrency.Token{}
-	out, err := os.Create(filepath.Join(mapDir, file) + ".tmp")
+	f, err := os.Create(tmp)
 	if err != nil {
-		<-concOH.FileSem // release token
-		fmt.Printf("failed to created file: %s, error: %v\n", file, err)
-		if out != nil {
-			err = out.Close()
-			if err != nil {
-				fmt.Printf("failed to close file: %v", err)
-			}
-		}
-		return
+		return 0, fmt.Errorf("failed to create file: %w", err)
 	}
 
 	// Copy the file from the server into our tmp file
-	if _, err = io.Copy(out, resp.Body); err != nil {
-		<-concOH.FileSem // release token
-		fmt.Printf("failed to write to file: %s, error: %v\n", file, err)
-		err = out.Close()
+	var body io.Reader = &progressReader{
+		r:     ratelimit.Reader(resp.Body, httpClient.limit),
+		file:  file,
+		total: total,
+		out:   out,
+	}
+	switch resp.Header.Get("Content-Encoding") {
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(tmp)
+			return 0, fmt.Errorf("failed to decompress: %w", err)
+		}
+		defer gz.Close()
+		body = gz
+	case "zstd":
+		zr, err := zstd.NewReader(httpClient.zstd, body)
 		if err != nil {
-			fmt.Printf("failed to close file: %s, error: %v\n", file, err)
+			_ = f.Close()
+			_ = os.Remove(tmp)
+			return 0, fmt.Errorf("failed to decompress: %w", err)
 		}
-		err = resp.Body.Close()
+		defer zr.Close()
+		body = zr
+	}
+	n, err := io.Copy(f, body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return n, fmt.Errorf("failed to write to file: %w", err)
+	}
+	return n, nil
+}
+
+// install checks the downloaded tmp file against the server's hash (if we have it) and moves it
+// to its real name, backing up the copy it replaces
+func install(tmp, dst, hash string) error {
+	// make sure we got what the server has before replacing anything
+	if hash != "" {
+		got, err := filelist.HashFile(tmp)
 		if err != nil {
-			fmt.Printf("unable to close server response body: %v\n", err)
+			_ = os.Remove(tmp)
+			return err
+		}
+		if got != hash {
+			_ = os.Remove(tmp)
+			return fmt.Errorf("hash mismatch: got %s, wanted %s", got, hash)
 		}
-		return
 	}
-	err = resp.Body.Close()
+
+	undo, err := httpClient.backups.Save(dst)
 	if err != nil {
-		fmt.Printf("unable to close server response body: %v\n", err)
+		_ = os.Remove(tmp)
+		return err
 	}
+	// wrote to tmp file in case it failed... now rename to the "real" name
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = undo()
+		return fmt.Errorf("failed to rename tmp file: %w", err)
+	}
+	return nil
+}
 
-	err = out.Close()
+// fileSize returns the size of the file
+func fileSize(file string) (int64, error) {
+	info, err := os.Stat(file)
 	if err != nil {
-		<-concOH.FileSem // release token
-		fmt.Printf("failed to close file: %s error: %v", file, err)
+		return 0, err
 	}
+	return info.Size(), nil
+}
 
-	// wrote to tmp file in case it failed... now rename to the "real" name
-	if err = os.Rename(
-		filepath.Join(mapDir, file)+".tmp", filepath.Join(mapDir, file)); err != nil {
-		<-concOH.FileSem // release token
-		fmt.Println("failed to remove tmp file")
-		return
-	}
-	<-concOH.FileSem // release token
-	fmt.Printf("file: %s downloaded\n", file)
+// progressReader emits progress events as the file is read from the server
+type progressReader struct {
+	r     io.Reader
+	file  string
+	total int64
+	read  int64
+	last  time.Time // last time a progress event was emitted
+	out   *output.Output
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	if time.Since(p.last) >= progressInterval || (err == io.EOF && p.read > 0) {
+		p.last = time.Now()
+		p.out.Emit(models.Event{Type: models.EventFileProgress, File: p.file, Bytes: p.read, Total: p.total})
+	}
+	return n, err
 }
@@ -0,0 +1,115 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpclient/client_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing downloading maps from the server.
+*/
+
+package httpclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kthomas422/csgosync/internal/concurrency"
+	"github.com/kthomas422/csgosync/internal/output"
+	"github.com/kthomas422/csgosync/internal/zstd"
+)
+
+func TestDownloadEncodings(t *testing.T) {
+	setV1(t, false)
+	program, err := zstd.Program("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := httpClient.zstd
+	httpClient.zstd = program
+	defer func() { httpClient.zstd = old }()
+
+	data := strings.Repeat("de_dust2 ", 10000)
+	sum := sha1.Sum([]byte(data))
+	hash := hex.EncodeToString(sum[:])
+	var gz, zst bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	_, _ = gw.Write([]byte(data))
+	_ = gw.Close()
+	if program != "" {
+		if err := zstd.Compress(program, &zst, strings.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the server sends the body the test says with the test's Content-Encoding
+	var (
+		encoding, accepted, pass string
+		body                     []byte
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepted = r.Header.Get("Accept-Encoding")
+		pass = r.Header.Get("Pass")
+		if encoding != "" {
+			w.Header().Set("Content-Encoding", encoding)
+		}
+		_, _ = w.Write(body)
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name, encoding string
+		body           []byte
+		hash           string
+		ok             bool
+	}{
+		{"identity", "", []byte(data), hash, true},
+		{"gzip", "gzip", gz.Bytes(), hash, true},
+		{"zstd", "zstd", zst.Bytes(), hash, true},
+		{"bad gzip", "gzip", []byte("not gzip"), hash, false},
+		{"bad zstd", "zstd", []byte("not zstd"), hash, false},
+		{"cut off zstd", "zstd", zst.Bytes()[:zst.Len()/2], hash, false},
+		{"wrong hash", "gzip", gz.Bytes(), strings.Repeat("0", 40), false},
+	}
+	out, err := output.New(output.Text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		if test.encoding == "zstd" && program == "" {
+			continue
+		}
+		encoding, body = test.encoding, test.body
+		dir := t.TempDir()
+		n, err := downloadFile(ts.URL, "pass", "de_a.bsp", test.hash, dir, concurrency.InitOH(1, 1), out)
+		b, rerr := ioutil.ReadFile(filepath.Join(dir, "de_a.bsp"))
+		if test.ok && (err != nil || n != int64(len(data)) || string(b) != data) {
+			t.Error("[", test.name, "] got: ", n, " bytes ", err, rerr)
+		}
+		if !test.ok && (err == nil || !os.IsNotExist(rerr)) {
+			t.Error("[", test.name, "] expected an error and no file, got: ", err, rerr)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "de_a.bsp.tmp")); !os.IsNotExist(err) {
+			t.Error("[", test.name, "] tmp file left: ", err)
+		}
+	}
+	want := "gzip"
+	if program != "" {
+		want = "zstd, gzip"
+	}
+	if accepted != want {
+		t.Error("got Accept-Encoding: ", accepted, " wanted: ", want)
+	}
+	if pass != "pass" {
+		t.Error("got Pass: ", pass)
+	}
+}
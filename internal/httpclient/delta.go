@@ -0,0 +1,90 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpclient/delta.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the client side of block delta downloads.
+*/
+
+package httpclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/kthomas422/csgosync/internal/delta"
+	"github.com/kthomas422/csgosync/internal/models"
+	"github.com/kthomas422/csgosync/internal/output"
+	"github.com/kthomas422/csgosync/internal/ratelimit"
+)
+
+// Files smaller than this are just downloaded, the signature isn't worth it
+const minDeltaSize = 1 << 20
+
+// errNoDelta means there's no delta to download, the whole file has to be downloaded
+var errNoDelta = errors.New("no delta")
+
+// downloadDelta sends the signature of our old copy of the file to the server and rebuilds the
+// new file into tmp from the delta it sends back. Returns errNoDelta if we don't have an old copy
+// worth sending or the server says a delta wouldn't save much.
+func downloadDelta(uri, pass, file, dst, tmp string, out *output.Output) (int64, error) {
+	old, err := os.Open(dst)
+	if err != nil {
+		return 0, errNoDelta
+	}
+	defer old.Close()
+	info, err := old.Stat()
+	if err != nil || info.Size() < minDeltaSize {
+		return 0, errNoDelta
+	}
+
+	bs := delta.BlockSize(info.Size())
+	sigs, err := delta.Signature(old, bs)
+	if err != nil {
+		return 0, fmt.Errorf("failed to make signature: %w", err)
+	}
+	jsonBody, err := json.Marshal(models.DeltaRequest{BlockSize: bs, Size: info.Size(), Blocks: sigs})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request body: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint(uri, "/delta/")+file, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Add("pass", pass)
+	resp, err := httpClient.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent, http.StatusNotFound: // not worth it or an old server
+		return 0, errNoDelta
+	default:
+		return 0, statusError(resp)
+	}
+	out.Emit(models.Event{Type: models.EventFileStart, File: file})
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create file: %w", err)
+	}
+	body := &progressReader{r: ratelimit.Reader(resp.Body, httpClient.limit), file: file, out: out}
+	n, err := delta.Apply(old, info.Size(), bs, body, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return n, fmt.Errorf("failed to apply delta: %w", err)
+	}
+	out.Printf("file: %s rebuilt from %d bytes of delta\n", file, body.read)
+	return n, nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpclient/errors.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains turning the server's error responses into errors.
+*/
+
+package httpclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+const maxErrorSize = 64 * 1024 // most of an error response we'll read
+
+// StatusError is returned when the server answers with an error status
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Err        *models.Error // what the server said went wrong, nil if it didn't say (older servers)
+}
+
+func (e *StatusError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("bad http status: %s", e.Status)
+	}
+	return fmt.Sprintf("server returned %s: %v", e.Status, e.Err)
+}
+
+func (e *StatusError) Unwrap() error {
+	if e.Err == nil {
+		return nil
+	}
+	return e.Err
+}
+
+// statusError reads the error the server sent back in resp
+func statusError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorSize))
+	return parseError(resp, body)
+}
+
+// parseError makes an error out of the response and the body the server sent with it
+func parseError(resp *http.Response, body []byte) error {
+	serr := &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	var e models.Error
+	if json.Unmarshal(body, &e) == nil && e.Code != "" {
+		serr.Err = &e
+	}
+	return serr
+}
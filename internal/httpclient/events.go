@@ -0,0 +1,98 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpclient/events.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the client for the server's event stream.
+*/
+
+package httpclient
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+// ErrNoEvents is returned when the server is too old to have an event stream
+var ErrNoEvents = errors.New("server doesn't support events")
+
+// The event stream stays open so it can't use the client with a timeout
+var streamClient = &http.Client{}
+
+// Subscribe connects to the event stream of the server at uri and sends the generation of the server's
+// files on gens every time it changes. It returns when the stream is closed or stop is closed.
+func Subscribe(uri, pass string, gens chan<- uint64, stop <-chan struct{}) error {
+	req, err := http.NewRequest(http.MethodGet, endpoint(uri, "/events"), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Add("pass", pass)
+	req.Header.Add("Accept", "text/event-stream")
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNoEvents
+	}
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+
+	// close the body when told to stop so the scanner returns
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			resp.Body.Close()
+		case <-done:
+		}
+	}()
+
+	// events are "field: value" lines ended by a blank line
+	var event, data string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if event == "manifest" {
+				var m models.ManifestEvent
+				if err = json.Unmarshal([]byte(data), &m); err != nil {
+					return fmt.Errorf("failed to unmarshal event: %w", err)
+				}
+				select {
+				case gens <- m.Generation:
+				case <-stop:
+					return nil
+				}
+			}
+			event, data = "", ""
+		case strings.HasPrefix(line, ":"): // comment (heartbeat)
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+	select {
+	case <-stop:
+		return nil
+	default:
+	}
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read events: %w", err)
+	}
+	return errors.New("server closed the event stream")
+}
@@ -0,0 +1,32 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpclient/groups.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains getting the groups of files the server has.
+*/
+
+package httpclient
+
+import (
+	"errors"
+
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+// ErrNoGroups is returned when the server doesn't have groups of files
+var ErrNoGroups = errors.New("server doesn't have groups, it needs to be updated")
+
+// Groups returns the groups of files the server has, Negotiate has to have been called first
+func Groups(uri, pass string) ([]models.Group, error) {
+	if !supports(models.FeatureGroups) {
+		return nil, ErrNoGroups
+	}
+	var list models.GroupList
+	if err := getJson(endpoint(uri, "/groups"), pass, &list); err != nil {
+		return nil, err
+	}
+	return list.Groups, nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpclient/info.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains finding out what the server supports and which api to talk to it with.
+*/
+
+package httpclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/kthomas422/csgosync/internal/filelist"
+	"github.com/kthomas422/csgosync/internal/models"
+	"github.com/kthomas422/csgosync/internal/version"
+)
+
+// ErrIncompatible is returned when the server and client can't understand each other
+var ErrIncompatible = errors.New("incompatible server")
+
+// ErrNoLibrary is returned when the server doesn't have the library
+var ErrNoLibrary = errors.New("server doesn't have the library")
+
+// libraryPath is where the server's libraries are, a library's uri already has the /v1 in it
+const libraryPath = "/v1/libraries/"
+
+// Library returns the uri to use instead of the server's to sync one of its libraries
+func Library(uri, name string) string {
+	return strings.TrimSuffix(uri, "/") + libraryPath + url.PathEscape(name)
+}
+
+// isLibrary reports if the uri is a library's, its path ends in /v1/libraries/<name>. A server
+// behind a proxy at a path that only has /v1/libraries/ in it somewhere isn't one.
+func isLibrary(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	dir, name := path.Split(u.Path)
+	return name != "" && strings.HasSuffix(dir, libraryPath)
+}
+
+// What we know about the server, set by Negotiate. Until then it's treated like a server from
+// before /v1 which only has the hash map and whole file downloads.
+var server struct {
+	sync.RWMutex
+	v1       bool
+	features map[string]bool
+}
+
+// Negotiate asks the server what it supports (GET /v1/info) and makes the rest of the requests
+// use that. A server that doesn't speak our protocol, hash or auth returns ErrIncompatible, so
+// do servers from before /v1 since they hash files the old way.
+func Negotiate(uri string) (*models.Info, error) {
+	info, err := getInfo(uri)
+	if err != nil {
+		return nil, err
+	}
+	server.Lock()
+	defer server.Unlock()
+	server.v1 = info != nil
+	server.features = make(map[string]bool)
+	if info == nil {
+		return nil, fmt.Errorf("%w: server is older than the /v1 api and hashes files differently, update it",
+			ErrIncompatible)
+	}
+
+	switch {
+	case !containsInt(info.Protocols, version.Protocol):
+		return info, fmt.Errorf("%w: server %s speaks protocol %v and this client speaks %d, update whichever is older",
+			ErrIncompatible, info.Version, info.Protocols, version.Protocol)
+	case !contains(info.HashAlgorithms, filelist.Algorithm):
+		return info, fmt.Errorf("%w: server hashes with %v and this client only knows %s",
+			ErrIncompatible, info.HashAlgorithms, filelist.Algorithm)
+	case !contains(info.Auth, models.AuthPass):
+		return info, fmt.Errorf("%w: server authenticates with %v and this client only knows %s",
+			ErrIncompatible, info.Auth, models.AuthPass)
+	}
+	for _, feature := range info.Features {
+		server.features[feature] = true
+	}
+	return info, nil
+}
+
+// getInfo gets the server's info, nil if the server is too old to have any
+func getInfo(uri string) (*models.Info, error) {
+	infoURI := uri + "/v1/info"
+	if isLibrary(uri) {
+		infoURI = uri + "/info"
+	}
+	resp, err := httpClient.client.Get(infoURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && isLibrary(uri) {
+		return nil, fmt.Errorf("%w: %s", ErrNoLibrary, uri)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	var info models.Info
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal server info: %w", err)
+	}
+	return &info, nil
+}
+
+// endpoint returns the url of route ("/sync", "/maps/"...) on the server for the api it speaks
+func endpoint(uri, route string) string {
+	server.RLock()
+	defer server.RUnlock()
+	if isLibrary(uri) {
+		return uri + route
+	}
+	if server.v1 {
+		return uri + "/v1" + route
+	}
+	if route == "/sync" {
+		return uri + "/csgosync"
+	}
+	return uri + route
+}
+
+// Supports returns whether the server has the optional feature, Negotiate has to be called first
+func Supports(feature string) bool {
+	return supports(feature)
+}
+
+// supports returns whether the server has the optional feature
+func supports(feature string) bool {
+	server.RLock()
+	defer server.RUnlock()
+	return server.features[feature]
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(list []int, i int) bool {
+	for _, item := range list {
+		if item == i {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpclient/info_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing finding out what the server supports.
+*/
+
+package httpclient
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kthomas422/csgosync/internal/filelist"
+	"github.com/kthomas422/csgosync/internal/models"
+	"github.com/kthomas422/csgosync/internal/version"
+)
+
+// setV1 makes the requests use the /v1 api or not until the test is done
+func setV1(t *testing.T, v1 bool) {
+	server.Lock()
+	old := server.v1
+	server.v1 = v1
+	server.Unlock()
+	t.Cleanup(func() {
+		server.Lock()
+		server.v1 = old
+		server.Unlock()
+	})
+}
+
+func TestLibrary(t *testing.T) {
+	tests := map[[2]string]string{
+		{"http://localhost:8080", "sounds"}:  "http://localhost:8080/v1/libraries/sounds",
+		{"http://localhost:8080/", "sounds"}: "http://localhost:8080/v1/libraries/sounds",
+		{"http://host/csgo", "my-cfgs"}:      "http://host/csgo/v1/libraries/my-cfgs",
+		{"http://localhost:8080", "a b"}:     "http://localhost:8080/v1/libraries/a%20b",
+	}
+	for in, want := range tests {
+		if got := Library(in[0], in[1]); got != want {
+			t.Error("[", in, "] got: ", got, " wanted: ", want)
+		}
+		if !isLibrary(Library(in[0], in[1])) {
+			t.Error("[", in, "] isn't a library")
+		}
+	}
+}
+
+func TestIsLibrary(t *testing.T) {
+	tests := map[string]bool{
+		"http://localhost:8080/v1/libraries/sounds":       true,
+		"http://host/csgo/v1/libraries/sounds":            true,
+		"http://localhost:8080":                           false,
+		"http://localhost:8080/":                          false,
+		"http://localhost:8080/v1/libraries/":             false,
+		"http://localhost:8080/v1/libraries":              false,
+		"http://localhost:8080/v1/libraries/sounds/maps":  false,
+		"http://host/v1/libraries/csgo/":                  false,
+		"http://localhost:8080/?next=/v1/libraries/x":     false,
+		"http://localhost:8080/#/v1/libraries/x":          false,
+		"http://localhost:8080/other/v1/libraries-x/y":    false,
+		"http://localhost:8080/v1/libraries/sounds?x=1":   true,
+		"http://localhost:8080/v1/libraries/my%20sounds":  true,
+		"http://localhost:8080/proxy/v1/libraries/sounds": true,
+		"://bad": false,
+	}
+	for uri, want := range tests {
+		if got := isLibrary(uri); got != want {
+			t.Error("[", uri, "] got: ", got, " wanted: ", want)
+		}
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	lib := Library("http://localhost:8080", "sounds")
+	tests := map[bool]map[[2]string]string{
+		true: {
+			{"http://localhost:8080", "/sync"}:  "http://localhost:8080/v1/sync",
+			{"http://localhost:8080", "/maps/"}: "http://localhost:8080/v1/maps/",
+			{lib, "/sync"}:                      "http://localhost:8080/v1/libraries/sounds/sync",
+			{lib, "/maps/"}:                     "http://localhost:8080/v1/libraries/sounds/maps/",
+			{lib, "/groups"}:                    "http://localhost:8080/v1/libraries/sounds/groups",
+		},
+		false: {
+			{"http://localhost:8080", "/sync"}:  "http://localhost:8080/csgosync",
+			{"http://localhost:8080", "/maps/"}: "http://localhost:8080/maps/",
+			{lib, "/sync"}:                      "http://localhost:8080/v1/libraries/sounds/sync",
+			{lib, "/maps/"}:                     "http://localhost:8080/v1/libraries/sounds/maps/",
+		},
+	}
+	for v1, routes := range tests {
+		setV1(t, v1)
+		for in, want := range routes {
+			if got := endpoint(in[0], in[1]); got != want {
+				t.Error("[ v1 ", v1, " ", in, "] got: ", got, " wanted: ", want)
+			}
+		}
+	}
+}
+
+func TestNegotiateLibrary(t *testing.T) {
+	setV1(t, false)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/libraries/sounds/info", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(models.Info{
+			Protocols:      []int{version.Protocol},
+			HashAlgorithms: []string{filelist.Algorithm},
+			Auth:           []string{models.AuthPass},
+			Library:        "sounds",
+		})
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	info, err := Negotiate(Library(ts.URL, "sounds"))
+	if err != nil || info.Library != "sounds" {
+		t.Error("[ sounds ] got: ", info, err)
+	}
+	if _, err := Negotiate(Library(ts.URL, "missing")); !errors.Is(err, ErrNoLibrary) {
+		t.Error("[ missing ] got: ", err, " wanted: ", ErrNoLibrary)
+	}
+	// the server itself doesn't have /v1/info so it's from before /v1
+	if _, err := Negotiate(ts.URL); !errors.Is(err, ErrIncompatible) {
+		t.Error("[ server ] got: ", err, " wanted: ", ErrIncompatible)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpclient/upload.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains uploading files to the server.
+*/
+
+package httpclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/kthomas422/csgosync/internal/filelist"
+	"github.com/kthomas422/csgosync/internal/models"
+	"github.com/kthomas422/csgosync/internal/output"
+	"github.com/kthomas422/csgosync/internal/ratelimit"
+)
+
+// ErrNoUploads is returned when the server doesn't take uploads
+var ErrNoUploads = errors.New("server doesn't take uploads, it needs to be updated")
+
+// Upload sends the file to the server (PUT /v1/files/<name>) with a token that has the upload
+// scope, Negotiate has to have been called first. The server checks it against our hash before
+// adding it to its maps.
+func Upload(uri, token, file string, out *output.Output) (*models.Uploaded, error) {
+	if !supports(models.FeatureUpload) {
+		return nil, ErrNoUploads
+	}
+	name := filepath.Base(file)
+	hash, err := filelist.HashFile(file)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	out.Emit(models.Event{Type: models.EventFileStart, File: name, Total: info.Size()})
+	body := &progressReader{
+		r:     ratelimit.Reader(f, httpClient.limit),
+		file:  name,
+		total: info.Size(),
+		out:   out,
+	}
+	req, err := http.NewRequest(http.MethodPut, endpoint(uri, "/files/")+name, ioutil.NopCloser(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("pass", token)
+	req.Header.Set("X-Hash", hash)
+	resp, err := httpClient.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, statusError(resp)
+	}
+	var uploaded models.Uploaded
+	if err := json.NewDecoder(resp.Body).Decode(&uploaded); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return &uploaded, nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/access.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the request ids and access log of the http server.
+*/
+
+package httpserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/kthomas422/csgosync/internal/csgolog"
+)
+
+const maxRequestIDLen = 128 // longer incoming request ids get replaced
+
+type requestKey struct{}
+
+// requestInfo follows a request through the handlers so the access log knows who it was
+type requestInfo struct {
+	id    string
+	ip    net.IP // the client's ip, worked out once so logs and limits all use the same one
+	user  string // who authenticated, empty if nobody
+	route string // the route that answered it for metrics, see Route
+	file  string // the map it downloaded if any
+	rec   *statusRecorder
+}
+
+// AccessLog gives every request an id (or keeps the X-Request-Id a proxy gave it), sends the id
+// back in the X-Request-Id header and logs one access log entry when the request is done. It also
+// works out the client's ip so it has to wrap every other handler.
+func (cs *CsgoSync) AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		info := &requestInfo{
+			id:  r.Header.Get("X-Request-Id"),
+			ip:  clientIP(r, cs.C.TrustedProxies),
+			rec: rec,
+		}
+		if !validRequestID(info.id) {
+			info.id = newRequestID()
+		}
+		w.Header().Set("X-Request-Id", info.id)
+		r = r.WithContext(context.WithValue(r.Context(), requestKey{}, info))
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK // nothing written, net/http sends 200
+		}
+		took := time.Since(start)
+		cs.Metrics.request(info.route, r.Method, rec.status, took, info.file, rec.written())
+		cs.L.Access(csgolog.AccessLog{
+			RequestID: info.id,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Route:     info.route,
+			Status:    rec.status,
+			Bytes:     rec.written(),
+			LatencyMs: float64(took) / float64(time.Millisecond),
+			User:      info.user,
+			IP:        GetRequestIp(r),
+			UserAgent: r.UserAgent(),
+		})
+	})
+}
+
+// Route names the route of the handler so requests to it are counted together in the metrics,
+// the access log still has the whole path
+func Route(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info, ok := r.Context().Value(requestKey{}).(*requestInfo); ok {
+			info.route = name
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestID returns the id of the request
+func requestID(r *http.Request) string {
+	if info, ok := r.Context().Value(requestKey{}).(*requestInfo); ok {
+		return info.id
+	}
+	return r.Header.Get("X-Request-Id")
+}
+
+// requestIP returns the ip of the client that made the request
+func requestIP(r *http.Request) net.IP {
+	if info, ok := r.Context().Value(requestKey{}).(*requestInfo); ok {
+		return info.ip
+	}
+	return parseAddr(r.RemoteAddr)
+}
+
+// setUser records who the request authenticated as for the access log
+func setUser(r *http.Request, user string) {
+	if info, ok := r.Context().Value(requestKey{}).(*requestInfo); ok {
+		info.user = user
+	}
+}
+
+// setFile records which map the request downloads for the metrics, only call it once the name is
+// known to be in the hash map so clients can't make up label values
+func setFile(r *http.Request, file string) {
+	if info, ok := r.Context().Value(requestKey{}).(*requestInfo); ok {
+		info.file = file
+	}
+}
+
+// validRequestID keeps whatever a client sends from ending up in our logs and headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID makes a random request id
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder remembers the status and size of the response for the access log
+type statusRecorder struct {
+	bytes int64 // first so it's aligned for atomic, the dashboard reads it during downloads
+	http.ResponseWriter
+	status int
+}
+
+// written returns the bytes of body written so far
+func (sr *statusRecorder) written() int64 {
+	return atomic.LoadInt64(&sr.bytes)
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(b)
+	atomic.AddInt64(&sr.bytes, int64(n))
+	return n, err
+}
+
+// Flush keeps the event stream working
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
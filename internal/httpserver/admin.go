@@ -0,0 +1,323 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/admin.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the handlers for administering the server.
+*/
+
+package httpserver
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kthomas422/csgosync/internal/models"
+	"github.com/kthomas422/csgosync/internal/tokens"
+	"github.com/kthomas422/csgosync/internal/version"
+)
+
+// make sure the user is an admin, if not tells them and returns false. Without an admin
+// password there are no admin endpoints. The password can be sent in the pass header or with
+// basic auth (any user name) so browsers can log in to the dashboard.
+func (cs *CsgoSync) authorizedAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if cs.C.AdminPass == "" {
+		cs.notFound(w, r)
+		return false
+	}
+	pass := r.Header.Get("Pass")
+	_, basicPass, basic := r.BasicAuth()
+	if pass == "" && basic {
+		pass = basicPass
+	}
+	// compared in constant time so how long it takes doesn't give away how much was right
+	if subtle.ConstantTimeCompare([]byte(pass), []byte(cs.C.AdminPass)) != 1 {
+		if pass != "" {
+			cs.L.Simple(fmt.Sprintf("unauthorized: bad admin pass from %s", GetRequestIp(r)))
+			cs.authFailed(r)
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="csgosyncd admin", charset="UTF-8"`)
+		cs.unauthorized(w, r)
+		return false
+	}
+	setUser(r, "admin")
+
+	// browsers send basic auth with any request to us, even ones other sites make them send. Other
+	// sites can't add headers without asking first (and we never say yes) so changes need one.
+	if basic && r.Method != http.MethodGet && r.Method != http.MethodHead && r.Header.Get("X-Requested-With") == "" {
+		cs.writeError(w, r, http.StatusForbidden, models.ErrCodeForbidden, "Missing X-Requested-With header")
+		return false
+	}
+	return true
+}
+
+// AdminFirewall sends how the firewall is set up and who is banned (GET /admin/firewall)
+func (cs *CsgoSync) AdminFirewall(w http.ResponseWriter, r *http.Request) {
+	if !cs.authorizedAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		cs.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	var status models.FirewallStatus
+	if cs.Firewall != nil {
+		status = cs.Firewall.Status()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		cs.L.Err("failed to write back to client: ", err)
+	}
+}
+
+// AdminBans lifts the ban on an ip (DELETE /admin/bans/<ip>)
+func (cs *CsgoSync) AdminBans(w http.ResponseWriter, r *http.Request) {
+	if !cs.authorizedAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodDelete {
+		cs.methodNotAllowed(w, r, http.MethodDelete)
+		return
+	}
+	ip := net.ParseIP(strings.TrimPrefix(r.URL.Path, "/admin/bans/"))
+	if ip == nil || cs.Firewall == nil || !cs.Firewall.Unban(ip) {
+		cs.notFound(w, r)
+		return
+	}
+	cs.L.Simple(fmt.Sprintf("admin from %s unbanned %s", GetRequestIp(r), ip))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tokenScopes are the scopes tokens can be given
+var tokenScopes = []string{models.ScopeSync, models.ScopeUpload}
+
+// syncsShown is how many recent syncs the dashboard shows
+const syncsShown = 50
+
+// adminStatus gathers everything the dashboard shows
+func (cs *CsgoSync) adminStatus() models.AdminStatus {
+	gen, _ := cs.Manifest.Generation()
+	status := models.AdminStatus{
+		Version:    version.Version,
+		Uptime:     time.Since(started).Seconds(),
+		Generation: gen,
+		Updated:    cs.Manifest.Updated().UTC(),
+		Files:      []models.ManifestFile{},
+		Retired:    cs.Manifest.Tombstones(),
+		Syncs:      []models.AccessEntry{},
+		Transfers:  cs.transfers.list(),
+		Refreshes:  cs.history.list(),
+		Tokens:     []models.Token{},
+	}
+	for name, hash := range cs.Manifest.Files() {
+		file := models.ManifestFile{Name: name, Hash: hash}
+		if info, err := os.Stat(filepath.Join(cs.C.MapPath, name)); err == nil {
+			file.Size, file.Modified = info.Size(), info.ModTime().UTC()
+		}
+		status.Files = append(status.Files, file)
+	}
+	sort.Slice(status.Files, func(i, j int) bool { return status.Files[i].Name < status.Files[j].Name })
+
+	for _, entry := range cs.L.Recent() {
+		library, ok := syncRoute(entry.Route)
+		if !ok {
+			continue
+		}
+		status.Syncs = append(status.Syncs, models.AccessEntry{
+			Time:      entry.Time.UTC(),
+			RequestID: entry.RequestID,
+			IP:        entry.IP,
+			User:      entry.User,
+			Library:   library,
+			Status:    entry.Status,
+			UserAgent: entry.UserAgent,
+		})
+		if len(status.Syncs) == syncsShown {
+			break
+		}
+	}
+	if cs.Firewall != nil {
+		status.Firewall = cs.Firewall.Status()
+	}
+	if cs.Tokens != nil {
+		status.Tokens = cs.Tokens.List()
+	}
+	return status
+}
+
+// syncRoute reports if the route is a hash map request (/v1/sync or /v1/libraries/<name>/sync) and
+// which library it's for
+func syncRoute(route string) (library string, ok bool) {
+	if route == "/v1/sync" {
+		return "", true
+	}
+	if !strings.HasPrefix(route, "/v1"+LibraryPrefix) || !strings.HasSuffix(route, "/sync") {
+		return "", false
+	}
+	library = strings.TrimSuffix(strings.TrimPrefix(route, "/v1"+LibraryPrefix), "/sync")
+	return library, library != "" && !strings.Contains(library, "/")
+}
+
+// writeJSON sends v as json with the status
+func (cs *CsgoSync) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		cs.L.Err("failed to write back to client: ", err)
+	}
+}
+
+// AdminStatus sends everything the dashboard shows (GET /admin/status)
+func (cs *CsgoSync) AdminStatus(w http.ResponseWriter, r *http.Request) {
+	if !cs.authorizedAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		cs.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	cs.writeJSON(w, http.StatusOK, cs.adminStatus())
+}
+
+// AdminRescan regenerates the hash map now instead of waiting for the refresh interval
+// (POST /admin/rescan)
+func (cs *CsgoSync) AdminRescan(w http.ResponseWriter, r *http.Request) {
+	if !cs.authorizedAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		cs.methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	cs.L.Simple(fmt.Sprintf("admin from %s started a rescan", GetRequestIp(r)))
+	go func() {
+		for _, err := range cs.Refresh() {
+			cs.L.Err("failed getting hashmap", err)
+		}
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// AdminTokens lists the api tokens (GET /admin/tokens) or creates one (POST /admin/tokens)
+func (cs *CsgoSync) AdminTokens(w http.ResponseWriter, r *http.Request) {
+	if !cs.authorizedAdmin(w, r) {
+		return
+	}
+	if cs.Tokens == nil {
+		cs.notFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		cs.writeJSON(w, http.StatusOK, cs.Tokens.List())
+	case http.MethodPost:
+		var req models.NewToken
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+			cs.writeError(w, r, http.StatusBadRequest, models.ErrCodeBadRequest, "Bad token request: "+err.Error())
+			return
+		}
+		if len(req.Scopes) == 0 {
+			req.Scopes = []string{models.ScopeSync}
+		}
+		for _, scope := range req.Scopes {
+			if !containsString(tokenScopes, scope) {
+				cs.writeError(w, r, http.StatusBadRequest, models.ErrCodeBadRequest, "Unknown scope: "+scope)
+				return
+			}
+		}
+		secret, token, err := cs.Tokens.Create(req.Name, req.Scopes)
+		if err == tokens.ErrNoName {
+			cs.writeError(w, r, http.StatusBadRequest, models.ErrCodeBadRequest, "Tokens need a name")
+			return
+		} else if err != nil {
+			cs.L.Err("failed to create token: ", err)
+			cs.internalError(w, r)
+			return
+		}
+		cs.L.Simple(fmt.Sprintf("admin from %s created token %s (%s)", GetRequestIp(r), token.ID, token.Name))
+		cs.writeJSON(w, http.StatusCreated, models.CreatedToken{Token: token, Secret: secret})
+	default:
+		cs.methodNotAllowed(w, r, http.MethodGet+", "+http.MethodPost)
+	}
+}
+
+// AdminToken revokes an api token (DELETE /admin/tokens/<id>)
+func (cs *CsgoSync) AdminToken(w http.ResponseWriter, r *http.Request) {
+	if !cs.authorizedAdmin(w, r) {
+		return
+	}
+	if cs.Tokens == nil {
+		cs.notFound(w, r)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		cs.methodNotAllowed(w, r, http.MethodDelete)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/admin/tokens/")
+	ok, err := cs.Tokens.Revoke(id)
+	if err != nil {
+		cs.L.Err("failed to revoke token: ", err)
+		cs.internalError(w, r)
+		return
+	} else if !ok {
+		cs.notFound(w, r)
+		return
+	}
+	cs.L.Simple(fmt.Sprintf("admin from %s revoked token %s", GetRequestIp(r), id))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminRetire deletes a file from the map directory and the hash map, clients are told it was
+// retired (DELETE /admin/files/<file>)
+func (cs *CsgoSync) AdminRetire(w http.ResponseWriter, r *http.Request) {
+	if !cs.authorizedAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodDelete {
+		cs.methodNotAllowed(w, r, http.MethodDelete)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/admin/files/")
+
+	cs.refreshMu.Lock()
+	defer cs.refreshMu.Unlock()
+	old := cs.Manifest.Files()
+	if _, ok := old[name]; !ok {
+		cs.notFound(w, r)
+		return
+	}
+	if err := os.Remove(filepath.Join(cs.C.MapPath, name)); err != nil && !os.IsNotExist(err) {
+		cs.L.Err("failed to retire file: ", err)
+		cs.internalError(w, r)
+		return
+	}
+	files := make(map[string]string, len(old))
+	for file, hash := range old {
+		if file != name {
+			files[file] = hash
+		}
+	}
+	_, gen := cs.publish(files)
+	cs.L.Simple(fmt.Sprintf("admin from %s retired %s (generation: %d)", GetRequestIp(r), name, gen))
+	cs.writeJSON(w, http.StatusOK, cs.Manifest.Tombstones()[name])
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/admin_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the admin endpoints.
+*/
+
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSyncRoute(t *testing.T) {
+	tests := []struct {
+		route   string
+		library string
+		ok      bool
+	}{
+		{"/v1/sync", "", true},
+		{"/v1/libraries/sounds/sync", "sounds", true},
+		{"/v1/libraries//sync", "", false},
+		{"/v1/libraries/sounds/maps/", "", false},
+		{"/csgosync", "", false}, // clients from before /v1 can't sync anymore
+		{"/v1/maps/", "", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		if library, ok := syncRoute(test.route); library != test.library || ok != test.ok {
+			t.Error("[", test.route, "] got: ", library, ok, " wanted: ", test.library, test.ok)
+		}
+	}
+}
+
+func TestAdminStatusSyncs(t *testing.T) {
+	cs := newTestServer(t, map[string]string{"de_a.bsp": "a"}, nil)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for route, path := range map[string]string{
+		"/v1/sync":                  "/v1/sync",
+		"/v1/libraries/sounds/sync": "/v1/libraries/sounds/sync",
+		"/v1/maps/":                 "/v1/maps/de_a.bsp",
+	} {
+		cs.AccessLog(Route(route, ok)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+	}
+	syncs := cs.adminStatus().Syncs
+	libraries := map[string]bool{}
+	for _, s := range syncs {
+		libraries[s.Library] = true
+	}
+	if len(syncs) != 2 || !libraries[""] || !libraries["sounds"] {
+		t.Error("got: ", syncs)
+	}
+}
+
+func TestAuthorizedAdmin(t *testing.T) {
+	cs := newTestServer(t, map[string]string{"de_a.bsp": "a"}, map[string]interface{}{"ADMIN_PASSWORD": "admin"})
+	tests := []struct {
+		pass string
+		want int
+	}{
+		{"admin", http.StatusOK},
+		{"", http.StatusUnauthorized},
+		{"adm", http.StatusUnauthorized},
+		{"admin2", http.StatusUnauthorized},
+		{"nimda", http.StatusUnauthorized},
+		{testPass, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/v1/admin/status", nil)
+		if test.pass != "" {
+			r.Header.Set("Pass", test.pass)
+		}
+		w := httptest.NewRecorder()
+		cs.AdminStatus(w, r)
+		if w.Code != test.want {
+			t.Error("[", test.pass, "] got: ", w.Code, " wanted: ", test.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/bundle.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the handler for downloading many files at once as a tar.
+*/
+
+package httpserver
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/kthomas422/csgosync/internal/bundle"
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+const (
+	maxBundleFiles   = 10000   // most files in one bundle
+	maxBundleReqSize = 4 << 20 // biggest list of files we'll read
+)
+
+// Bundle takes a list of files (POST /bundle) and streams them back as a tar, gzipped if asked
+func (cs *CsgoSync) Bundle(w http.ResponseWriter, r *http.Request) {
+	if !cs.authorized(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		cs.methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+
+	var req models.BundleRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBundleReqSize)).Decode(&req)
+	if err == nil && len(req.Files) > maxBundleFiles {
+		err = fmt.Errorf("too many files: %d", len(req.Files))
+	}
+	if err == nil && req.Compress != "" && req.Compress != "gzip" {
+		err = fmt.Errorf("unknown compression: %s", req.Compress)
+	}
+	if err != nil {
+		cs.L.Err("bad bundle request: ", err)
+		cs.writeError(w, r, http.StatusUnprocessableEntity, models.ErrCodeBadRequest, "Error parsing JSON: "+err.Error())
+		return
+	}
+
+	// only files in the hash map, that also keeps them from asking for ../../etc/passwd
+	serverFiles := cs.Manifest.Files()
+	for _, file := range req.Files {
+		if _, ok := serverFiles[file]; !ok {
+			cs.writeError(w, r, http.StatusNotFound, models.ErrCodeNotFound, "Not found: "+file)
+			return
+		}
+	}
+
+	defer cs.transferring(r, fmt.Sprintf("bundle of %d files", len(req.Files)))()
+	var out io.Writer = w
+	if req.Compress == "gzip" {
+		w.Header().Set("Content-Type", "application/gzip")
+		gz := gzip.NewWriter(w)
+		defer func() {
+			if err := gz.Close(); err != nil {
+				cs.L.Err("failed to finish bundle: ", err)
+			}
+		}()
+		out = gz
+	} else {
+		w.Header().Set("Content-Type", "application/x-tar")
+	}
+	w.WriteHeader(http.StatusOK)
+	// once the tar has started the status can't change, a bad bundle fails on the client
+	if err = bundle.Write(out, cs.C.MapPath, req.Files); err != nil {
+		cs.L.Err("failed to write bundle: ", err)
+		return
+	}
+	cs.L.Simple(fmt.Sprintf("ip: %v sent bundle of %d files", GetRequestIp(r), len(req.Files)))
+}
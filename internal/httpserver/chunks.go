@@ -0,0 +1,182 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/chunks.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the handlers for the chunked manifest and serving chunks by hash.
+*/
+
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/kthomas422/csgosync/internal/chunk"
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+// chunkIndex remembers the chunks of every file, they're only worked out the first time a client
+// asks for them
+type chunkIndex struct {
+	mu    sync.Mutex
+	lists map[string]*models.ChunkList // file hash -> chunks
+	where map[string]chunkLocation     // chunk hash -> where to read it from
+}
+
+// chunkLocation is where a chunk can be read from
+type chunkLocation struct {
+	file   string
+	offset int64
+	size   int64
+}
+
+// chunkIndex returns the index, creating it the first time
+func (cs *CsgoSync) chunkIndex() *chunkIndex {
+	cs.chunksOnce.Do(func() {
+		cs.chunks = &chunkIndex{
+			lists: make(map[string]*models.ChunkList),
+			where: make(map[string]chunkLocation),
+		}
+	})
+	return cs.chunks
+}
+
+// list returns the chunks of the file, splitting it if it hasn't been yet
+func (ci *chunkIndex) list(dir, name, hash string) (*models.ChunkList, error) {
+	ci.mu.Lock()
+	if l, ok := ci.lists[hash]; ok && l.File == name {
+		ci.mu.Unlock()
+		return l, nil
+	}
+	ci.mu.Unlock()
+
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open map: %w", err)
+	}
+	defer f.Close()
+	l := &models.ChunkList{File: name, Hash: hash}
+	where := make(map[string]chunkLocation)
+	err = chunk.Split(f, func(c models.Chunk, _ []byte) error {
+		where[c.Hash] = chunkLocation{file: name, offset: l.Size, size: c.Size}
+		l.Chunks = append(l.Chunks, c)
+		l.Size += c.Size
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to split %s: %w", name, err)
+	}
+
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	ci.lists[hash] = l
+	for h, loc := range where {
+		ci.where[h] = loc
+	}
+	return l, nil
+}
+
+// prune forgets the files that aren't in the list anymore (file name -> hash)
+func (ci *chunkIndex) prune(files map[string]string) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	for hash, l := range ci.lists {
+		if files[l.File] != hash {
+			delete(ci.lists, hash)
+		}
+	}
+	for hash, loc := range ci.where {
+		if l, ok := ci.lists[files[loc.file]]; !ok || l.File != loc.file {
+			delete(ci.where, hash)
+		}
+	}
+}
+
+// read returns the bytes of the chunk, nil if we don't know where it is or the file changed
+func (ci *chunkIndex) read(dir, hash string) ([]byte, error) {
+	ci.mu.Lock()
+	loc, ok := ci.where[hash]
+	ci.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	f, err := os.Open(filepath.Join(dir, loc.file))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open map: %w", err)
+	}
+	defer f.Close()
+	data := make([]byte, loc.size)
+	if _, err = f.ReadAt(data, loc.offset); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read chunk: %w", err)
+	}
+	if chunk.Hash(data) != hash {
+		// file changed since it was split, the next refresh sorts it out
+		ci.mu.Lock()
+		delete(ci.where, hash)
+		ci.mu.Unlock()
+		return nil, nil
+	}
+	return data, nil
+}
+
+// Chunks sends the chunked manifest of a file (GET /chunks/<file>)
+func (cs *CsgoSync) Chunks(w http.ResponseWriter, r *http.Request) {
+	if !cs.authorized(w, r) {
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/chunks/")
+	hash, ok := cs.Manifest.Files()[name]
+	if !ok || r.Method != http.MethodGet {
+		cs.notFound(w, r)
+		return
+	}
+	l, err := cs.chunkIndex().list(cs.C.MapPath, name, hash)
+	if err != nil {
+		cs.L.Err("failed to chunk map: ", err)
+		cs.internalError(w, r)
+		return
+	}
+	jsonBody, err := json.Marshal(l)
+	if err != nil {
+		cs.L.Err("can't marshal json ", err)
+		cs.internalError(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(jsonBody); err != nil {
+		cs.L.Err("failed to write back to client: ", err)
+	}
+}
+
+// Chunk sends the bytes of a chunk by its hash (GET /chunk/<hash>). Only chunks of files that
+// somebody got the chunked manifest of can be found.
+func (cs *CsgoSync) Chunk(w http.ResponseWriter, r *http.Request) {
+	if !cs.authorized(w, r) {
+		return
+	}
+	data, err := cs.chunkIndex().read(cs.C.MapPath, strings.TrimPrefix(r.URL.Path, "/chunk/"))
+	if err != nil {
+		cs.L.Err("failed to read chunk: ", err)
+		cs.internalError(w, r)
+		return
+	}
+	if data == nil || r.Method != http.MethodGet {
+		cs.notFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(data); err != nil {
+		cs.L.Err("failed to write back to client: ", err)
+	}
+}
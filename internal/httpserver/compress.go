@@ -0,0 +1,320 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/compress.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the gzip and zstd compression of map downloads and the on disk cache of compressed maps.
+*/
+
+package httpserver
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kthomas422/csgosync/internal/models"
+	"github.com/kthomas422/csgosync/internal/zstd"
+)
+
+// Files smaller than this aren't worth compressing
+const minCompressSize = 1024
+
+// Content-Encodings maps can be sent with and the extension of their copies in the cache
+var encodings = map[string]string{"zstd": ".zst", "gzip": ".gz"}
+
+// CompressCache keeps compressed copies of the maps on disk, named by hash, so a map is only
+// compressed once no matter how many players download it. Maps are gzipped and, if the zstd
+// program is installed, compressed with zstd too.
+type CompressCache struct {
+	dir      string
+	zstd     string // path to the zstd program, empty if it isn't installed
+	mu       sync.Mutex
+	inflight map[string]chan struct{} // hashes being compressed right now, closed when they're done
+}
+
+// NewCompressCache returns a cache that keeps the compressed maps in dir. zstd is the zstd program,
+// it's looked for if empty and maps are only gzipped if it isn't found.
+func NewCompressCache(dir, zstdPath string) (*CompressCache, error) {
+	program, err := zstd.Program(zstdPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("couldn't create compression cache: %w", err)
+	}
+	return &CompressCache{dir: dir, zstd: program, inflight: make(map[string]chan struct{})}, nil
+}
+
+// Encodings returns the Content-Encodings maps are compressed with, the one we'd rather send first
+func (cc *CompressCache) Encodings() []string {
+	if cc.zstd != "" {
+		return []string{"zstd", "gzip"}
+	}
+	return []string{"gzip"}
+}
+
+// path returns where the copy of the file with the hash compressed with the encoding goes
+func (cc *CompressCache) path(hash, encoding string) string {
+	return filepath.Join(cc.dir, hash+encodings[encoding])
+}
+
+// open returns the copy of the file with the hash compressed with the first of the encodings that
+// is in the cache and smaller than the file, nil if there isn't one
+func (cc *CompressCache) open(src, hash string, accepted []string) (*os.File, os.FileInfo, string) {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return nil, nil, ""
+	}
+	for _, encoding := range accepted {
+		f, err := os.Open(cc.path(hash, encoding))
+		if err != nil {
+			continue
+		}
+		info, err := f.Stat()
+		if err != nil || info.Size() >= srcInfo.Size() {
+			_ = f.Close()
+			continue
+		}
+		return f, info, encoding
+	}
+	return nil, nil, ""
+}
+
+// cached reports if the file with the hash has been compressed with every encoding
+func (cc *CompressCache) cached(hash string) bool {
+	for _, encoding := range cc.Encodings() {
+		if _, err := os.Stat(cc.path(hash, encoding)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Compress compresses the file into the cache unless it's already there. It blocks until the file
+// is compressed, if it's already being done it waits for that instead (and whoever is doing it
+// gets the error if it fails).
+func (cc *CompressCache) Compress(src, hash string) error {
+	cc.mu.Lock()
+	if done, ok := cc.inflight[hash]; ok {
+		cc.mu.Unlock()
+		<-done
+		return nil
+	}
+	if cc.cached(hash) {
+		cc.mu.Unlock()
+		return nil
+	}
+	done := make(chan struct{})
+	cc.inflight[hash] = done
+	cc.mu.Unlock()
+	defer func() {
+		cc.mu.Lock()
+		delete(cc.inflight, hash)
+		cc.mu.Unlock()
+		close(done)
+	}()
+
+	for _, encoding := range cc.Encodings() {
+		if _, err := os.Stat(cc.path(hash, encoding)); err == nil {
+			continue
+		}
+		if err := cc.compress(src, hash, encoding); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compress writes the compressed copy to a tmp file and renames it into place so downloads never
+// get half a file
+func (cc *CompressCache) compress(src, hash, encoding string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+	tmp := cc.path(hash, encoding) + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmp, err)
+	}
+	if encoding == "zstd" {
+		err = zstd.Compress(cc.zstd, out, in)
+	} else {
+		gz := gzip.NewWriter(out)
+		_, err = io.Copy(gz, in)
+		if gerr := gz.Close(); err == nil {
+			err = gerr
+		}
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to %s %s: %w", encoding, src, err)
+	}
+	return os.Rename(tmp, cc.path(hash, encoding))
+}
+
+// Prune removes the compressed files that aren't in the list of files (file name -> hash). Files
+// being compressed right now are left alone, their .tmp is still being written.
+func (cc *CompressCache) Prune(files map[string]string) []error {
+	var errs []error
+	keep := make(map[string]bool, len(files))
+	for _, hash := range files {
+		for _, ext := range encodings {
+			keep[hash+ext] = true
+		}
+	}
+	entries, err := ioutil.ReadDir(cc.dir)
+	if err != nil {
+		return []error{fmt.Errorf("couldn't read compression cache: %w", err)}
+	}
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	for _, entry := range entries {
+		if keep[entry.Name()] || !entry.Mode().IsRegular() {
+			continue
+		}
+		if _, ok := cc.inflight[strings.SplitN(entry.Name(), ".", 2)[0]]; ok {
+			continue
+		}
+		if err = os.Remove(filepath.Join(cc.dir, entry.Name())); err != nil {
+			errs = append(errs, fmt.Errorf("couldn't remove %s: %w", entry.Name(), err))
+		}
+	}
+	return errs
+}
+
+// Warm compresses every file that isn't in the cache yet and removes the ones that are gone
+func (cc *CompressCache) Warm(dir string, files map[string]string) []error {
+	errs := cc.Prune(files)
+	for file, hash := range files {
+		if info, err := os.Stat(filepath.Join(dir, file)); err != nil || info.Size() < minCompressSize {
+			continue
+		}
+		if err := cc.Compress(filepath.Join(dir, file), hash); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Maps serves the map files, if the client accepts zstd or gzip and the file is in the compression
+// cache it gets the compressed copy (zstd if it takes both)
+func (cs *CsgoSync) Maps() http.Handler {
+	files := http.StripPrefix("/maps/", http.FileServer(http.Dir(cs.C.MapPath)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cs.authorized(w, r) {
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		name := strings.TrimPrefix(r.URL.Path, "/maps/")
+		hash, ok := cs.Manifest.Files()[name]
+		if !ok {
+			cs.notFound(w, r)
+			return
+		}
+		setFile(r, name)
+		defer cs.transferring(r, name)()
+		w = &fileErrorWriter{ResponseWriter: w, cs: cs, r: r}
+		var accepted []string
+		if cs.Compress != nil {
+			for _, encoding := range cs.Compress.Encodings() {
+				if accepts(r, encoding) {
+					accepted = append(accepted, encoding)
+				}
+			}
+		}
+		if len(accepted) == 0 {
+			files.ServeHTTP(w, r)
+			return
+		}
+		src := filepath.Join(cs.C.MapPath, name)
+		f, info, encoding := cs.Compress.open(src, hash, accepted)
+		if f == nil {
+			// not compressed yet, don't make them wait for it
+			go func() {
+				if err := cs.Compress.Compress(src, hash); err != nil {
+					cs.L.Err("failed to compress map: ", err)
+				}
+			}()
+			files.ServeHTTP(w, r)
+			return
+		}
+		defer f.Close()
+		w.Header().Set("Content-Encoding", encoding)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, name, info.ModTime(), f)
+	})
+}
+
+// fileErrorWriter sends the plain text errors from http.FileServer and http.ServeContent (file
+// gone since the hash map was made, bad ranges...) as json like every other error
+type fileErrorWriter struct {
+	http.ResponseWriter
+	cs     *CsgoSync
+	r      *http.Request
+	failed bool
+}
+
+func (fw *fileErrorWriter) WriteHeader(status int) {
+	if status < http.StatusBadRequest {
+		fw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	fw.failed = true
+	fw.Header().Del("Content-Encoding")
+	fw.Header().Del("Content-Length")
+	switch status {
+	case http.StatusNotFound:
+		fw.cs.notFound(fw.ResponseWriter, fw.r)
+	case http.StatusForbidden:
+		fw.cs.writeError(fw.ResponseWriter, fw.r, status, models.ErrCodeForbidden, "Forbidden")
+	case http.StatusInternalServerError:
+		fw.cs.internalError(fw.ResponseWriter, fw.r)
+	default:
+		fw.cs.writeError(fw.ResponseWriter, fw.r, status, models.ErrCodeBadRequest, http.StatusText(status))
+	}
+}
+
+// Write drops the plain text body of an error, the json one was already sent
+func (fw *fileErrorWriter) Write(b []byte) (int, error) {
+	if fw.failed {
+		return len(b), nil
+	}
+	return fw.ResponseWriter.Write(b)
+}
+
+// accepts reports if the Accept-Encoding header allows the encoding
+func accepts(r *http.Request, encoding string) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(enc, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if name != encoding && name != "*" {
+			continue
+		}
+		// "gzip;q=0" means anything but gzip
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,333 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/compress_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the compressed map downloads.
+*/
+
+package httpserver
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kthomas422/csgosync/internal/models"
+	"github.com/kthomas422/csgosync/internal/zstd"
+)
+
+func TestAccepts(t *testing.T) {
+	tests := []struct {
+		header   string
+		encoding string
+		want     bool
+	}{
+		{"", "gzip", false},
+		{"gzip", "gzip", true},
+		{"GZIP", "gzip", true},
+		{"deflate, gzip;q=0.5", "gzip", true},
+		{"gzip;q=0", "gzip", false},
+		{"gzip; q=0.0", "gzip", false},
+		{"*", "gzip", true},
+		{"br, zstd", "gzip", false},
+		{"br, zstd", "zstd", true},
+		{"zstd;q=0, gzip", "zstd", false},
+		{"gzip", "zstd", false},
+		{"*", "zstd", true},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/maps/de_a.bsp", nil)
+		r.Header.Set("Accept-Encoding", test.header)
+		if got := accepts(r, test.encoding); got != test.want {
+			t.Error("[", test.header, " ", test.encoding, "] got: ", got, " wanted: ", test.want)
+		}
+	}
+}
+
+// newTestCache returns a compression cache, gzip only unless withZstd is set (and the zstd
+// program is installed, if it isn't the test is skipped)
+func newTestCache(t *testing.T, withZstd bool) *CompressCache {
+	t.Helper()
+	cc, err := NewCompressCache(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if withZstd && cc.zstd == "" {
+		t.Skip("no zstd program")
+	}
+	if !withZstd {
+		cc.zstd = ""
+	}
+	return cc
+}
+
+func TestCompressCache(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "de_a.bsp")
+	data := strings.Repeat("de_dust2 ", 1000)
+	if err := ioutil.WriteFile(src, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cc := newTestCache(t, false)
+	if f, _, _ := cc.open(src, "a0", []string{"gzip"}); f != nil {
+		t.Fatal("miss got a file")
+	}
+	if err := cc.Compress(src, "a0"); err != nil {
+		t.Fatal(err)
+	}
+	f, info, encoding := cc.open(src, "a0", []string{"zstd", "gzip"})
+	if f == nil || encoding != "gzip" {
+		t.Fatal("hit got no file")
+	}
+	defer f.Close()
+	if info.Size() >= int64(len(data)) {
+		t.Error("not smaller: ", info.Size())
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadAll(gz); err != nil || string(b) != data {
+		t.Error("decompressed got: ", len(b), " bytes ", err)
+	}
+
+	// gone from the list so it goes from the cache
+	if errs := cc.Prune(map[string]string{"de_b.bsp": "b0"}); len(errs) > 0 {
+		t.Error(errs)
+	}
+	if f, _, _ := cc.open(src, "a0", []string{"gzip"}); f != nil {
+		f.Close()
+		t.Error("pruned file is still there")
+	}
+}
+
+func TestCompressCacheZstd(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "de_a.bsp")
+	data := strings.Repeat("de_dust2 ", 1000)
+	if err := ioutil.WriteFile(src, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cc := newTestCache(t, true)
+	if got := cc.Encodings(); !reflect.DeepEqual(got, []string{"zstd", "gzip"}) {
+		t.Error("got encodings: ", got)
+	}
+	if err := cc.Compress(src, "a0"); err != nil {
+		t.Fatal(err)
+	}
+	// both are there, the client's order doesn't matter only what it takes
+	for _, accepted := range [][]string{{"zstd", "gzip"}, {"zstd"}, {"gzip"}} {
+		f, _, encoding := cc.open(src, "a0", accepted)
+		if f == nil || encoding != accepted[0] {
+			t.Error("[", accepted, "] got: ", encoding)
+			continue
+		}
+		f.Close()
+	}
+	f, _, _ := cc.open(src, "a0", []string{"zstd"})
+	if f == nil {
+		t.Fatal("no zstd copy")
+	}
+	defer f.Close()
+	zr, err := zstd.NewReader(cc.zstd, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	if b, err := ioutil.ReadAll(zr); err != nil || string(b) != data {
+		t.Error("decompressed got: ", len(b), " bytes ", err)
+	}
+
+	// gone from the list so both go from the cache
+	if errs := cc.Prune(map[string]string{"de_b.bsp": "b0"}); len(errs) > 0 {
+		t.Error(errs)
+	}
+	if f, _, _ := cc.open(src, "a0", []string{"zstd", "gzip"}); f != nil {
+		f.Close()
+		t.Error("pruned file is still there")
+	}
+}
+
+func TestCompressInFlight(t *testing.T) {
+	cc := newTestCache(t, false)
+	// someone else is compressing it
+	done := make(chan struct{})
+	cc.inflight["a0"] = done
+	returned := make(chan error)
+	go func() { returned <- cc.Compress("missing.bsp", "a0") }()
+	select {
+	case err := <-returned:
+		t.Fatal("didn't wait for the other compression: ", err)
+	case <-time.After(time.Millisecond * 50):
+	}
+	close(done)
+	if err := <-returned; err != nil {
+		t.Error("got: ", err)
+	}
+}
+
+func TestPruneInFlight(t *testing.T) {
+	cc := newTestCache(t, false)
+	dir := cc.dir
+	// a0 is being compressed by a download while the refresh prunes, b0 was left by a crash
+	cc.inflight["a0"] = make(chan struct{})
+	for _, name := range []string{"a0.gz.tmp", "b0.gz.tmp", "c0.gz"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("gz"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if errs := cc.Prune(map[string]string{"de_a.bsp": "a0"}); len(errs) > 0 {
+		t.Error(errs)
+	}
+	for name, want := range map[string]bool{"a0.gz.tmp": true, "b0.gz.tmp": false, "c0.gz": false} {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != want {
+			t.Error("[", name, "] got: ", err, " wanted it kept: ", want)
+		}
+	}
+}
+
+func TestMapsGzip(t *testing.T) {
+	data := strings.Repeat("de_dust2 ", 1000)
+	cs := newTestServer(t, map[string]string{"de_a.bsp": data}, nil)
+	cs.Compress = newTestCache(t, false)
+	get := func(encoding string) *http.Response {
+		r := httptest.NewRequest(http.MethodGet, "/maps/de_a.bsp", nil)
+		r.Header.Set("Pass", testPass)
+		r.Header.Set("Accept-Encoding", encoding)
+		w := httptest.NewRecorder()
+		cs.Maps().ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	// not compressed yet, they get it as is
+	resp := get("gzip")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "" || resp.Header.Get("Vary") != "Accept-Encoding" {
+		t.Error("miss got: ", resp.Status, resp.Header)
+	}
+
+	// the miss compresses it in the background
+	src := filepath.Join(cs.C.MapPath, "de_a.bsp")
+	for start := time.Now(); ; time.Sleep(time.Millisecond * 10) {
+		if f, _, _ := cs.Compress.open(src, cs.Manifest.Files()["de_a.bsp"], []string{"gzip"}); f != nil {
+			f.Close()
+			break
+		}
+		if time.Since(start) > time.Second*5 {
+			t.Fatal("miss wasn't compressed")
+		}
+	}
+	resp = get("gzip")
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatal("hit got: ", resp.Header)
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadAll(gz); err != nil || string(b) != data {
+		t.Error("decompressed got: ", len(b), " bytes ", err)
+	}
+
+	resp = get("identity")
+	if b, _ := ioutil.ReadAll(resp.Body); resp.Header.Get("Content-Encoding") != "" || string(b) != data {
+		t.Error("without gzip got: ", resp.Header, len(b), " bytes")
+	}
+}
+
+func TestMapsZstd(t *testing.T) {
+	data := strings.Repeat("de_dust2 ", 1000)
+	cs := newTestServer(t, map[string]string{"de_a.bsp": data}, nil)
+	cs.Compress = newTestCache(t, true)
+	if err := cs.Compress.Compress(filepath.Join(cs.C.MapPath, "de_a.bsp"), cs.Manifest.Files()["de_a.bsp"]); err != nil {
+		t.Fatal(err)
+	}
+	if got := cs.info().Compression; !reflect.DeepEqual(got, []string{"zstd", "gzip"}) {
+		t.Error("info got: ", got)
+	}
+	tests := map[string]string{
+		"zstd, gzip":     "zstd",
+		"gzip, zstd":     "zstd",
+		"zstd":           "zstd",
+		"gzip":           "gzip",
+		"gzip, zstd;q=0": "gzip",
+		"br":             "",
+		"identity":       "",
+	}
+	for accepted, want := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/maps/de_a.bsp", nil)
+		r.Header.Set("Pass", testPass)
+		r.Header.Set("Accept-Encoding", accepted)
+		w := httptest.NewRecorder()
+		cs.Maps().ServeHTTP(w, r)
+		if got := w.Header().Get("Content-Encoding"); w.Code != http.StatusOK || got != want {
+			t.Error("[", accepted, "] got: ", w.Code, " ", got, " wanted: ", want)
+			continue
+		}
+		var body io.Reader = w.Body
+		switch want {
+		case "zstd":
+			zr, err := zstd.NewReader(cs.Compress.zstd, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer zr.Close()
+			body = zr
+		case "gzip":
+			gz, err := gzip.NewReader(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = gz
+		}
+		if b, err := ioutil.ReadAll(body); err != nil || string(b) != data {
+			t.Error("[", accepted, "] decompressed got: ", len(b), " bytes ", err)
+		}
+	}
+}
+
+func TestMapsErrors(t *testing.T) {
+	cs := newTestServer(t, map[string]string{"de_a.bsp": "aaaa", "de_gone.bsp": "gone"}, nil)
+	// deleted after the hash map was made
+	if err := os.Remove(filepath.Join(cs.C.MapPath, "de_gone.bsp")); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path   string
+		pass   string
+		rng    string
+		status int
+		code   string
+	}{
+		{"/maps/de_a.bsp", "", "", http.StatusUnauthorized, models.ErrCodeUnauthorized},
+		{"/maps/de_a.bsp", "wrong", "", http.StatusUnauthorized, models.ErrCodeUnauthorized},
+		{"/maps/de_missing.bsp", testPass, "", http.StatusNotFound, models.ErrCodeNotFound},
+		{"/maps/de_gone.bsp", testPass, "", http.StatusNotFound, models.ErrCodeNotFound},
+		{"/maps/de_a.bsp", testPass, "bytes=100-", http.StatusRequestedRangeNotSatisfiable, models.ErrCodeBadRequest},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if test.pass != "" {
+			r.Header.Set("Pass", test.pass)
+		}
+		if test.rng != "" {
+			r.Header.Set("Range", test.rng)
+		}
+		w := httptest.NewRecorder()
+		cs.Maps().ServeHTTP(w, r)
+		var e models.Error
+		err := json.NewDecoder(w.Body).Decode(&e)
+		if w.Code != test.status || w.Header().Get("Content-Type") != "application/json" || err != nil || e.Code != test.code {
+			t.Error("[", test.path, "] got: ", w.Code, " ", w.Header().Get("Content-Type"), " ", e, err)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/dashboard.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the admin dashboard, a single page with no outside assets so it works
+	without internet.
+*/
+
+package httpserver
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+var dashboard = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"size": func(n int64) string {
+		const unit = 1024
+		if n < unit {
+			return fmt.Sprintf("%d B", n)
+		}
+		div, exp := int64(unit), 0
+		for m := n / unit; m >= unit; m /= unit {
+			div *= unit
+			exp++
+		}
+		return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+	},
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return t.Local().Format("2006-01-02 15:04:05")
+	},
+	"seconds": func(s float64) string {
+		return (time.Duration(s * float64(time.Second))).Round(time.Millisecond).String()
+	},
+	"short": func(hash string) string {
+		if len(hash) > 12 {
+			return hash[:12]
+		}
+		return hash
+	},
+}).Parse(dashboardHTML))
+
+// Dashboard shows the admin dashboard (GET /admin/)
+func (cs *CsgoSync) Dashboard(w http.ResponseWriter, r *http.Request) {
+	if !cs.authorizedAdmin(w, r) {
+		return
+	}
+	if r.URL.Path != "/admin/" {
+		cs.notFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		cs.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; script-src 'unsafe-inline'; connect-src 'self'")
+	err := dashboard.Execute(w, struct {
+		Status interface{}
+		Scopes []string
+	}{cs.adminStatus(), tokenScopes})
+	if err != nil {
+		cs.L.Err("failed to render dashboard: ", err)
+	}
+}
+
+const dashboardHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>csgosyncd</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; color: #222; }
+h1 small { font-size: 50%; color: #777; }
+h2 { border-bottom: 1px solid #ccc; margin-top: 1.5em; }
+table { border-collapse: collapse; width: 100%; font-size: 90%; }
+th, td { text-align: left; padding: 3px 8px; border-bottom: 1px solid #eee; }
+th { background: #f4f4f4; }
+td.num { text-align: right; }
+code { font-size: 95%; }
+.bad { color: #b00; }
+.empty { color: #777; font-style: italic; }
+button { cursor: pointer; }
+</style>
+</head>
+<body>
+{{with .Status}}
+<h1>csgosyncd <small>{{.Version}}, up {{seconds .Uptime}}</small></h1>
+<p>
+Generation {{.Generation}} with {{len .Files}} files, generated {{time .Updated}}.
+<button id="rescan">Rescan now</button>
+</p>
+
+<h2>Downloads in progress</h2>
+{{if .Transfers}}
+<table>
+<tr><th>Started</th><th>IP</th><th>User</th><th>File</th><th>Sent</th></tr>
+{{range .Transfers}}
+<tr><td>{{time .Started}}</td><td>{{.IP}}</td><td>{{.User}}</td><td>{{.File}}</td><td class="num">{{size .Bytes}}</td></tr>
+{{end}}
+</table>
+{{else}}<p class="empty">Nothing downloading.</p>{{end}}
+
+<h2>Recent syncs</h2>
+{{if .Syncs}}
+<table>
+<tr><th>Time</th><th>IP</th><th>User</th><th>Library</th><th>Status</th><th>Client</th><th>Request</th></tr>
+{{range .Syncs}}
+<tr><td>{{time .Time}}</td><td>{{.IP}}</td><td>{{.User}}</td><td>{{.Library}}</td><td{{if ge .Status 400}} class="bad"{{end}}>{{.Status}}</td><td>{{.UserAgent}}</td><td><code>{{.RequestID}}</code></td></tr>
+{{end}}
+</table>
+{{else}}<p class="empty">No clients have synced since the server started.</p>{{end}}
+
+<h2>Refreshes</h2>
+{{if .Refreshes}}
+<table>
+<tr><th>Time</th><th>Took</th><th>Files</th><th>Generation</th><th>Changed</th><th>Errors</th></tr>
+{{range .Refreshes}}
+<tr><td>{{time .Time}}</td><td>{{seconds .Duration}}</td><td class="num">{{.Files}}</td><td class="num">{{.Generation}}</td><td>{{.Changed}}</td>
+<td class="bad">{{range .Errors}}{{.}}<br>{{end}}</td></tr>
+{{end}}
+</table>
+{{else}}<p class="empty">The hash map hasn't been generated yet.</p>{{end}}
+
+<h2>Tokens</h2>
+{{if .Tokens}}
+<table>
+<tr><th>Name</th><th>ID</th><th>Scopes</th><th>Created</th><th>Last used</th><th></th></tr>
+{{range .Tokens}}
+<tr><td>{{.Name}}</td><td><code>{{.ID}}</code></td><td>{{range .Scopes}}{{.}} {{end}}</td><td>{{time .Created}}</td><td>{{time .LastUsed}}</td>
+<td><button class="revoke" data-id="{{.ID}}" data-name="{{.Name}}">Revoke</button></td></tr>
+{{end}}
+</table>
+{{else}}<p class="empty">No tokens.</p>{{end}}
+{{end}}
+<p>
+New token: <input id="token-name" placeholder="name">
+{{range .Scopes}}<label><input type="checkbox" class="scope" value="{{.}}"{{if eq . "sync"}} checked{{end}}> {{.}}</label> {{end}}
+<button id="create">Create</button>
+</p>
+<p id="secret" hidden>Copy the token now, it won't be shown again: <code id="secret-value"></code></p>
+
+{{with .Status}}
+<h2>Firewall</h2>
+{{with .Firewall}}
+<p>
+Allow: {{range .Allow}}<code>{{.}}</code> {{else}}everyone{{end}}.
+Deny: {{range .Deny}}<code>{{.}}</code> {{else}}nobody{{end}}.
+Requests per ip: {{if .RequestRate}}{{.RequestRate}}/s (burst {{.RequestBurst}}){{else}}unlimited{{end}}.
+Bans: {{if .MaxFailures}}{{.MaxFailures}} failed logins in {{.FailureWindow}} for {{.BanTime}}{{else}}off{{end}}.
+</p>
+{{if .Bans}}
+<table>
+<tr><th>Banned IP</th><th>Until</th><th></th></tr>
+{{range .Bans}}
+<tr><td>{{.IP}}</td><td>{{time .Until}}</td><td><button class="unban" data-ip="{{.IP}}">Unban</button></td></tr>
+{{end}}
+</table>
+{{else}}<p class="empty">Nobody is banned.</p>{{end}}
+{{end}}
+
+<h2>Files</h2>
+<table>
+<tr><th>File</th><th>Size</th><th>Hash</th><th>Modified</th><th></th></tr>
+{{range .Files}}
+<tr><td>{{.Name}}</td><td class="num">{{size .Size}}</td><td><code title="{{.Hash}}">{{short .Hash}}</code></td><td>{{time .Modified}}</td>
+<td><button class="retire" data-name="{{.Name}}">Retire</button></td></tr>
+{{else}}
+<tr><td colspan="5" class="empty">No files.</td></tr>
+{{end}}
+</table>
+
+<h2>Retired files</h2>
+{{if .Retired}}
+<table>
+<tr><th>File</th><th>Hash</th><th>Deleted</th></tr>
+{{range $name, $ts := .Retired}}
+<tr><td>{{$name}}</td><td><code title="{{$ts.Hash}}">{{short $ts.Hash}}</code></td><td>{{time $ts.Deleted}}</td></tr>
+{{end}}
+</table>
+{{else}}<p class="empty">No files have been deleted.</p>{{end}}
+{{end}}
+
+<script>
+// reload every 30 seconds until a token is made, a meta refresh can't be stopped once it's
+// scheduled and the secret is only shown once
+var refresh = setTimeout(function () { location.reload(); }, 30000);
+function call(method, path, body) {
+	return fetch(path, {
+		method: method,
+		headers: {"X-Requested-With": "csgosync", "Content-Type": "application/json"},
+		body: body ? JSON.stringify(body) : undefined
+	}).then(function (resp) {
+		if (!resp.ok) {
+			return resp.json().then(function (e) { throw new Error(e.message); });
+		}
+		return resp.status === 204 ? null : resp.json();
+	}).catch(function (e) { alert(method + " " + path + " failed: " + e.message); throw e; });
+}
+document.getElementById("rescan").onclick = function () {
+	call("POST", "/v1/admin/rescan").then(function () { setTimeout(function () { location.reload(); }, 1000); });
+};
+document.getElementById("create").onclick = function () {
+	clearTimeout(refresh);
+	var name = document.getElementById("token-name").value;
+	var scopes = [];
+	document.querySelectorAll(".scope:checked").forEach(function (c) { scopes.push(c.value); });
+	call("POST", "/v1/admin/tokens", {name: name, scopes: scopes}).then(function (t) {
+		document.getElementById("secret-value").textContent = t.secret;
+		document.getElementById("secret").hidden = false;
+	});
+};
+document.querySelectorAll(".revoke").forEach(function (b) {
+	b.onclick = function () {
+		if (confirm("Revoke token " + b.dataset.name + "?")) {
+			call("DELETE", "/v1/admin/tokens/" + b.dataset.id).then(function () { location.reload(); });
+		}
+	};
+});
+document.querySelectorAll(".retire").forEach(function (b) {
+	b.onclick = function () {
+		if (confirm("Delete " + b.dataset.name + " from the server? Clients will remove it too.")) {
+			call("DELETE", "/v1/admin/files/" + encodeURIComponent(b.dataset.name)).then(function () { location.reload(); });
+		}
+	};
+});
+document.querySelectorAll(".unban").forEach(function (b) {
+	b.onclick = function () {
+		call("DELETE", "/v1/admin/bans/" + b.dataset.ip).then(function () { location.reload(); });
+	};
+});
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,37 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/dashboard_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the admin dashboard.
+*/
+
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDashboard(t *testing.T) {
+	cs := newTestServer(t, map[string]string{"de_a.bsp": "a"}, map[string]interface{}{"ADMIN_PASSWORD": "admin"})
+	r := httptest.NewRequest(http.MethodGet, "/admin/", nil)
+	r.SetBasicAuth("admin", "admin")
+	w := httptest.NewRecorder()
+	cs.Dashboard(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatal("got: ", w.Code, w.Body.String())
+	}
+	page := w.Body.String()
+	// a meta refresh would reload the page while a new token's secret is on it
+	if strings.Contains(page, `http-equiv="refresh"`) || !strings.Contains(page, "clearTimeout(refresh)") {
+		t.Error("page reloads without a way to stop it")
+	}
+	if !strings.Contains(page, "de_a.bsp") {
+		t.Error("page doesn't list the files")
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/deadline.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains changing the server's read and write timeouts for a single request.
+*/
+
+package httpserver
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// The server's timeouts, handlers that need longer change their own deadlines
+const (
+	ReadTimeout  = time.Second * 10
+	WriteTimeout = time.Minute * 10 // hopefully files don't take longer than 10 minutes to download
+)
+
+type connKey struct{}
+
+// conn returns the connection the request came in on, nil if the server's ConnContext isn't ours
+func conn(r *http.Request) net.Conn {
+	c, _ := r.Context().Value(connKey{}).(net.Conn)
+	return c
+}
+
+// setWriteDeadline replaces the server's WriteTimeout for the rest of the response, a zero time
+// means no deadline. The server sets its own again for the next request on the connection.
+func setWriteDeadline(r *http.Request, t time.Time) {
+	if c := conn(r); c != nil {
+		if err := c.SetWriteDeadline(t); err != nil {
+			return // connection is closed, the next write fails anyway
+		}
+	}
+}
+
+// setReadDeadline replaces the server's ReadTimeout for the rest of the request body
+func setReadDeadline(r *http.Request, t time.Time) {
+	if c := conn(r); c != nil {
+		if err := c.SetReadDeadline(t); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/delta.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the handler for block delta downloads of changed maps.
+*/
+
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kthomas422/csgosync/internal/delta"
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+const (
+	maxDeltaRatio   = 0.5      // only send a delta if it's at most half of the file
+	maxDeltaReqSize = 64 << 20 // biggest signature we'll read
+)
+
+// Delta takes the signature of the client's old copy of a file (POST /delta/<file>) and sends
+// back the ops to rebuild the server's copy from it. If the delta wouldn't save much it sends
+// 204 No Content and the client downloads the whole file instead.
+func (cs *CsgoSync) Delta(w http.ResponseWriter, r *http.Request) {
+	if !cs.authorized(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		cs.methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+
+	// only files in the hash map, that also keeps them from asking for ../../etc/passwd
+	name := strings.TrimPrefix(r.URL.Path, "/delta/")
+	if _, ok := cs.Manifest.Files()[name]; !ok {
+		cs.notFound(w, r)
+		return
+	}
+
+	setFile(r, name)
+	defer cs.transferring(r, name+" (delta)")()
+
+	var req models.DeltaRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxDeltaReqSize)).Decode(&req)
+	if err == nil && (req.BlockSize < delta.MinBlockSize || req.BlockSize > delta.MaxBlockSize) {
+		err = fmt.Errorf("block size %d out of range", req.BlockSize)
+	}
+	if err != nil {
+		cs.L.Err("bad delta request: ", err)
+		cs.writeError(w, r, http.StatusUnprocessableEntity, models.ErrCodeBadRequest, "Error parsing JSON: "+err.Error())
+		return
+	}
+	// the last block is worked out from the size, blocks that don't add up to it would make it
+	// point outside the client's copy
+	blocks := (req.Size + int64(req.BlockSize) - 1) / int64(req.BlockSize)
+	if req.Size < 1 || int64(len(req.Blocks)) != blocks {
+		cs.L.Simple(fmt.Sprintf("bad delta request: %d blocks for %d bytes", len(req.Blocks), req.Size))
+		cs.writeError(w, r, http.StatusBadRequest, models.ErrCodeBadRequest,
+			fmt.Sprintf("%d blocks don't match a size of %d bytes", len(req.Blocks), req.Size))
+		return
+	}
+
+	f, err := os.Open(filepath.Join(cs.C.MapPath, name))
+	if err != nil {
+		cs.L.Err("failed to open map: ", err)
+		cs.internalError(w, r)
+		return
+	}
+	defer f.Close()
+	d, err := delta.Compute(f, req)
+	if err != nil {
+		cs.L.Err("failed to compute delta: ", err)
+		cs.internalError(w, r)
+		return
+	}
+	ip := GetRequestIp(r)
+	if float64(d.Literal) > maxDeltaRatio*float64(d.Size) {
+		cs.L.Simple(fmt.Sprintf("ip: %v delta for %s not worth it (%d of %d bytes changed)", ip, name, d.Literal, d.Size))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-csgosync-delta")
+	w.WriteHeader(http.StatusOK)
+	if err = delta.Write(w, f, d); err != nil {
+		cs.L.Err("failed to write delta: ", err)
+		return
+	}
+	cs.L.Simple(fmt.Sprintf("ip: %v sent delta for %s (%d of %d bytes changed)", ip, name, d.Literal, d.Size))
+}
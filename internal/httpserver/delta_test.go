@@ -0,0 +1,60 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/delta_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the delta endpoint.
+*/
+
+package httpserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kthomas422/csgosync/internal/delta"
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+func TestDeltaBlockCount(t *testing.T) {
+	data := strings.Repeat("de_dust2 ", 1000)
+	cs := newTestServer(t, map[string]string{"de_a.bsp": data}, nil)
+	// the client's copy is 5000 bytes so the last of its 3 blocks is short
+	sigs, err := delta.Signature(strings.NewReader(data[:5000]), delta.MinBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		why    string
+		size   int64
+		blocks []models.BlockSignature
+		status int
+	}{
+		{"matches", 5000, sigs, http.StatusOK},
+		{"last block full", 3 * delta.MinBlockSize, sigs, http.StatusOK},
+		{"too few blocks", 5000, sigs[:2], http.StatusBadRequest},
+		{"too many blocks", 4000, sigs, http.StatusBadRequest},
+		{"past the last block", 1 << 40, sigs, http.StatusBadRequest},
+		{"no size", 0, nil, http.StatusBadRequest},
+		{"negative size", -5000, sigs, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		body, err := json.Marshal(models.DeltaRequest{BlockSize: delta.MinBlockSize, Size: test.size, Blocks: test.blocks})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/delta/de_a.bsp", bytes.NewReader(body))
+		r.Header.Set("Pass", testPass)
+		w := httptest.NewRecorder()
+		cs.Delta(w, r)
+		if w.Code != test.status {
+			t.Error("[", test.why, "] got: ", w.Code, " ", w.Body.String(), " wanted: ", test.status)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/errors.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains sending errors back to clients.
+*/
+
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+// writeError sends the error back as json with the status
+func (cs *CsgoSync) writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(models.Error{
+		Code:      code,
+		Message:   message,
+		RequestID: requestID(r),
+	})
+	if err != nil {
+		cs.L.Err("failed to write back to client: ", err)
+	}
+}
+
+// notFound tells the client there's nothing there
+func (cs *CsgoSync) notFound(w http.ResponseWriter, r *http.Request) {
+	cs.writeError(w, r, http.StatusNotFound, models.ErrCodeNotFound, "Not found")
+}
+
+// methodNotAllowed tells the client the endpoint only takes the allowed method
+func (cs *CsgoSync) methodNotAllowed(w http.ResponseWriter, r *http.Request, allowed string) {
+	w.Header().Set("Allow", allowed)
+	cs.writeError(w, r, http.StatusMethodNotAllowed, models.ErrCodeMethodNotAllowed, "Method not allowed")
+}
+
+// internalError tells the client something went wrong on our end, what went wrong goes in the
+// log and not to the client
+func (cs *CsgoSync) internalError(w http.ResponseWriter, r *http.Request) {
+	cs.writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal, "Internal server error")
+}
+
+// Outdated is the handler for the old sync path. Clients from before /v1 hash files the old way
+// (protocol 1) so every file would look different to them every sync.
+func (cs *CsgoSync) Outdated(w http.ResponseWriter, r *http.Request) {
+	cs.writeError(w, r, http.StatusGone, models.ErrCodeOutdated, "This client is too old for the server, update it")
+}
+
+// NotFound is the handler for anything that isn't an endpoint
+func (cs *CsgoSync) NotFound(w http.ResponseWriter, r *http.Request) {
+	cs.notFound(w, r)
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/events.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the server sent events endpoint that tells clients when the server's files change.
+*/
+
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+// How often to send a comment down the stream so proxies don't close it
+const heartbeatInterval = time.Second * 30
+
+// eventWriteTimeout is how long a single write down the stream can take, the stream itself
+// stays open for as long as the client wants so the server's WriteTimeout doesn't apply
+const eventWriteTimeout = time.Minute
+
+// Events streams a "manifest" event with the current generation as soon as the client connects
+// and then every time the generation changes.
+func (cs *CsgoSync) Events(w http.ResponseWriter, r *http.Request) {
+	if !cs.authorized(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		cs.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		cs.L.Err("can't stream events: ", fmt.Errorf("%T is not a flusher", w))
+		cs.internalError(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // tell nginx not to buffer the stream
+	setWriteDeadline(r, time.Now().Add(eventWriteTimeout))
+	w.WriteHeader(http.StatusOK)
+
+	ip := GetRequestIp(r)
+	cs.L.Simple(fmt.Sprintf("ip: %v subscribed to events", ip))
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		gen, changed := cs.Manifest.Generation()
+		data, err := json.Marshal(models.ManifestEvent{Generation: gen, Files: len(cs.Manifest.Files())})
+		if err != nil {
+			cs.L.Err("can't marshal json ", err)
+			return
+		}
+		setWriteDeadline(r, time.Now().Add(eventWriteTimeout))
+		if _, err = fmt.Fprintf(w, "event: manifest\nid: %d\ndata: %s\n\n", gen, data); err != nil {
+			cs.L.Err("failed to write back to client: ", err)
+			return
+		}
+		flusher.Flush()
+
+		// wait for the next generation
+		for waiting := true; waiting; {
+			select {
+			case <-changed:
+				waiting = false
+			case <-heartbeat.C:
+				setWriteDeadline(r, time.Now().Add(eventWriteTimeout))
+				if _, err = fmt.Fprint(w, ": ping\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			case <-r.Context().Done():
+				cs.L.Simple(fmt.Sprintf("ip: %v unsubscribed from events", ip))
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/events_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the server sent events endpoint.
+*/
+
+package httpserver
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventsOutliveWriteTimeout(t *testing.T) {
+	cs := newTestServer(t, map[string]string{"a.bsp": "a"}, nil)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(cs.Events))
+	srv.Config.WriteTimeout = time.Millisecond * 200
+	srv.Config.ConnContext = cs.ConnContext
+	srv.Start()
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Pass", testPass)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	lines := bufio.NewScanner(resp.Body)
+	next := func() string {
+		for lines.Scan() {
+			if strings.HasPrefix(lines.Text(), "id: ") {
+				return lines.Text()
+			}
+		}
+		return fmt.Sprint("stream closed: ", lines.Err())
+	}
+	if got := next(); got != "id: 1" {
+		t.Fatal("first event got: ", got)
+	}
+
+	// the change comes after the server's WriteTimeout
+	time.Sleep(time.Millisecond * 500)
+	cs.Manifest.Set(map[string]string{"a.bsp": "a", "b.bsp": "b"})
+	if got := next(); got != "id: 2" {
+		t.Error("event after the write timeout got: ", got)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/firewall.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains keeping out the ips the firewall doesn't let in.
+*/
+
+package httpserver
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kthomas422/csgosync/internal/firewall"
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+// Filter turns away requests the firewall doesn't let through, it has to be inside AccessLog so
+// it knows the client's ip
+func (cs *CsgoSync) Filter(next http.Handler) http.Handler {
+	if cs.Firewall == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verdict, wait := cs.Firewall.Check(requestIP(r))
+		switch verdict {
+		case firewall.Denied:
+			cs.Metrics.reject("denied")
+			cs.writeError(w, r, http.StatusForbidden, models.ErrCodeForbidden, "Forbidden")
+		case firewall.Banned:
+			cs.Metrics.reject("banned")
+			retryAfter(w, wait)
+			cs.writeError(w, r, http.StatusForbidden, models.ErrCodeBanned, "Banned for too many failed logins")
+		case firewall.Limited:
+			cs.Metrics.reject("rate_limited")
+			retryAfter(w, wait)
+			cs.writeError(w, r, http.StatusTooManyRequests, models.ErrCodeRateLimited, "Too many requests")
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// retryAfter tells the client how many seconds to wait before trying again
+func retryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/groups.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains groups of files (surf maps, retakes maps...) clients can subscribe to so
+	they don't have to sync everything.
+*/
+
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kthomas422/csgosync/internal/ignore"
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+// errUnknownGroup is returned when a client subscribes to a group we don't have
+var errUnknownGroup = errors.New("unknown group")
+
+// Groups are named sets of gitignore style patterns. A nil Groups has no groups.
+type Groups struct {
+	names    []string // sorted
+	raw      map[string][]string
+	patterns map[string]*ignore.Patterns
+}
+
+// NewGroups compiles the groups from the config
+func NewGroups(groups map[string][]string) (*Groups, error) {
+	g := &Groups{raw: groups, patterns: make(map[string]*ignore.Patterns, len(groups))}
+	for name, patterns := range groups {
+		p, err := ignore.Compile(patterns)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern in group %s: %w", name, err)
+		}
+		g.names = append(g.names, name)
+		g.patterns[name] = p
+	}
+	sort.Strings(g.names)
+	return g, nil
+}
+
+// Select returns the files in any of the groups
+func (g *Groups) Select(names []string, files map[string]string) (map[string]string, error) {
+	var subscribed []*ignore.Patterns
+	for _, name := range names {
+		var p *ignore.Patterns
+		if g != nil {
+			p = g.patterns[strings.ToLower(name)]
+		}
+		if p == nil {
+			return nil, fmt.Errorf("%w: %s", errUnknownGroup, name)
+		}
+		subscribed = append(subscribed, p)
+	}
+	selected := make(map[string]string)
+	for file, hash := range files {
+		for _, p := range subscribed {
+			if p.Match(file) {
+				selected[file] = hash
+				break
+			}
+		}
+	}
+	return selected, nil
+}
+
+// list describes every group with the files in it
+func (g *Groups) list(mapDir string, files map[string]string) []models.Group {
+	groups := make([]models.Group, 0)
+	if g == nil {
+		return groups
+	}
+	for _, name := range g.names {
+		group := models.Group{Name: name, Patterns: g.raw[name], Files: make([]string, 0)}
+		for file := range files {
+			if g.patterns[name].Match(file) {
+				group.Files = append(group.Files, file)
+				if info, err := os.Stat(filepath.Join(mapDir, file)); err == nil {
+					group.Size += info.Size()
+				}
+			}
+		}
+		sort.Strings(group.Files)
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// GroupList answers GET /v1/groups with the groups clients can subscribe to
+func (cs *CsgoSync) GroupList(w http.ResponseWriter, r *http.Request) {
+	if !cs.authorized(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		cs.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	cs.writeJSON(w, http.StatusOK, models.GroupList{Groups: cs.Groups.list(cs.C.MapPath, cs.Manifest.Files())})
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/groups_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the server's groups of files.
+*/
+
+package httpserver
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestGroups(t *testing.T) {
+	g, err := NewGroups(map[string][]string{
+		"surf":     {"surf_*"},
+		"retakes":  {"retake_*", "de_*", "!de_old*"},
+		"no_match": {"nothing_*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{"surf_a.bsp": "1", "retake_b.bsp": "2", "de_c.bsp": "3", "de_old.bsp": "4", "aim_d.bsp": "5"}
+	tests := []struct {
+		groups []string
+		want   map[string]string
+	}{
+		{[]string{"surf"}, map[string]string{"surf_a.bsp": "1"}},
+		{[]string{"Retakes"}, map[string]string{"retake_b.bsp": "2", "de_c.bsp": "3"}},
+		{[]string{"surf", "retakes"}, map[string]string{"surf_a.bsp": "1", "retake_b.bsp": "2", "de_c.bsp": "3"}},
+		{[]string{"no_match"}, map[string]string{}},
+	}
+	for _, test := range tests {
+		got, err := g.Select(test.groups, files)
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Error("[", test.groups, "] got: ", got, err, " wanted: ", test.want)
+		}
+	}
+	if _, err := g.Select([]string{"surf", "kz"}, files); !errors.Is(err, errUnknownGroup) {
+		t.Error("unknown group got: ", err)
+	}
+	var none *Groups
+	if _, err := none.Select([]string{"surf"}, files); !errors.Is(err, errUnknownGroup) {
+		t.Error("no groups got: ", err)
+	}
+
+	list := g.list(t.TempDir(), files)
+	if len(list) != 3 || list[1].Name != "retakes" || !reflect.DeepEqual(list[1].Files, []string{"de_c.bsp", "retake_b.bsp"}) {
+		t.Error("list got: ", list)
+	}
+}
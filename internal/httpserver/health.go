@@ -0,0 +1,120 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/health.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the health and readiness handlers for load balancers and orchestrators.
+*/
+
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kthomas422/csgosync/internal/disk"
+	"github.com/kthomas422/csgosync/internal/models"
+	"github.com/kthomas422/csgosync/internal/version"
+)
+
+var started = time.Now()
+
+// Healthz says the server is alive (GET /healthz), if it can answer at all it is
+func (cs *CsgoSync) Healthz(w http.ResponseWriter, r *http.Request) {
+	cs.writeHealth(w, r, nil)
+}
+
+// Readyz says if the server is ready for clients (GET /readyz). It isn't until the hash map (and
+// every library's) has been generated, and stops being if a directory can't be read or the disk
+// is full.
+func (cs *CsgoSync) Readyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]models.Check{
+		"manifest": cs.checkManifest(),
+		"map_path": checkReadable(cs.C.MapPath),
+		"disk":     cs.checkDisk(),
+	}
+	for _, lib := range cs.Libraries {
+		checks["manifest:"+lib.Library] = lib.checkManifest()
+		checks["map_path:"+lib.Library] = checkReadable(lib.C.MapPath)
+	}
+	cs.writeHealth(w, r, checks)
+}
+
+// writeHealth sends the checks back, 503 if any of them failed
+func (cs *CsgoSync) writeHealth(w http.ResponseWriter, r *http.Request, checks map[string]models.Check) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		cs.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	health := models.Health{
+		Status:  models.HealthOK,
+		Version: version.Version,
+		Uptime:  time.Since(started).Seconds(),
+		Checks:  checks,
+	}
+	status := http.StatusOK
+	for _, check := range checks {
+		if !check.OK {
+			health.Status = models.HealthUnavailable
+			status = http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(health); err != nil {
+		cs.L.Err("failed to write back to client: ", err)
+	}
+}
+
+// checkManifest passes once the hash map has been generated
+func (cs *CsgoSync) checkManifest() models.Check {
+	if cs.Manifest == nil || cs.Manifest.Updated().IsZero() {
+		return models.Check{Message: "hash map not generated yet"}
+	}
+	gen, _ := cs.Manifest.Generation()
+	return models.Check{OK: true, Message: fmt.Sprintf("generation %d, %d files, updated %s",
+		gen, len(cs.Manifest.Files()), cs.Manifest.Updated().UTC().Format(time.RFC3339))}
+}
+
+// checkReadable passes if the directory can be listed
+func checkReadable(dir string) models.Check {
+	f, err := os.Open(dir)
+	if err != nil {
+		return models.Check{Message: err.Error()}
+	}
+	defer f.Close()
+	if _, err = f.Readdirnames(1); err != nil && err != io.EOF {
+		return models.Check{Message: err.Error()}
+	}
+	return models.Check{OK: true}
+}
+
+// checkDisk passes if the disk the maps (and any caches) are on has MIN_FREE_SPACE left
+func (cs *CsgoSync) checkDisk() models.Check {
+	var messages []string
+	for _, dir := range []string{cs.C.MapPath, cs.C.CompressCache, cs.C.FastDLPath} {
+		if dir == "" {
+			continue
+		}
+		u, err := disk.Space(dir)
+		if err == disk.ErrUnsupported {
+			return models.Check{OK: true, Message: err.Error()}
+		}
+		if err != nil {
+			return models.Check{Message: err.Error()}
+		}
+		if int64(u.Free) < cs.C.MinFreeSpace {
+			return models.Check{Message: fmt.Sprintf("%s has %d bytes free, need %d", dir, u.Free, cs.C.MinFreeSpace)}
+		}
+		messages = append(messages, fmt.Sprintf("%s: %d of %d bytes free", dir, u.Free, u.Total))
+	}
+	return models.Check{OK: true, Message: strings.Join(messages, ", ")}
+}
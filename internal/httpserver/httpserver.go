@@ -14,22 +14,45 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/kthomas422/csgosync/config"
 
 	"github.com/kthomas422/csgosync/internal/csgolog"
+	"github.com/kthomas422/csgosync/internal/fastdl"
+	"github.com/kthomas422/csgosync/internal/firewall"
 
 	"github.com/kthomas422/csgosync/internal/filelist"
 	"github.com/kthomas422/csgosync/internal/models"
+	"github.com/kthomas422/csgosync/internal/tokens"
 )
 
 // Wrapper for "things" the handler will need
 type CsgoSync struct {
-	L       *csgolog.CsgoLogger  // logger
-	C       *config.ServerConfig // config
-	HashMap map[string]string    // "List" of files and their hashes
+	L        *csgolog.CsgoLogger  // logger
+	C        *config.ServerConfig // config
+	Manifest *Manifest            // "List" of files and their hashes
+	FastDL   *fastdl.Mirror       // bzip2 mirror of the map directory, nil if disabled
+	Compress *CompressCache       // gzip and zstd compressed copies of the maps, nil if disabled
+	Firewall *firewall.Firewall   // ip allow/deny lists, request limits and bans, nil lets everyone in
+	Metrics  *Metrics             // prometheus metrics, nil if disabled
+	Tokens   *tokens.Store        // api tokens that can be used instead of the password
+	Groups   *Groups              // named sets of files clients can subscribe to
+
+	Library   string      // name of the library this serves, empty for MAP_PATH
+	Libraries []*CsgoSync // the other libraries, only on the one serving MAP_PATH
+
+	refreshMu sync.Mutex     // one refresh at a time
+	history   refreshHistory // last refreshes for the dashboard
+	transfers transferList   // downloads in progress for the dashboard
+
+	chunksOnce sync.Once
+	chunks     *chunkIndex // chunks of the files clients asked for, use chunkIndex()
 }
 
 func (cs *CsgoSync) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -41,25 +64,8 @@ func (cs *CsgoSync) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		resp        models.FileResponse
 		ip          = GetRequestIp(r)
 	)
-	cs.L.WebRequest(r) // log request
 
-	// make sure user was "authenticated"
-	// TODO: put this in middlware
-	if pass := r.Header.Get("Pass"); pass != "" {
-		if pass != cs.C.Pass {
-			cs.L.Simple(fmt.Sprintf("unauthorized: bad pass: %s", r.Header.Get("Pass")))
-			err = unAuth(w)
-			if err != nil {
-				cs.L.Err("failed to write back to client: ", err)
-			}
-			return
-		}
-	} else {
-		cs.L.Simple("unauthorized: no password")
-		err = unAuth(w)
-		if err != nil {
-			cs.L.Err("failed to write back to client: ", err)
-		}
+	if !cs.authorized(w, r) {
 		return
 	}
 	defer func() {
@@ -73,35 +79,67 @@ func (cs *CsgoSync) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		bytes, err = ioutil.ReadAll(r.Body)
 		if err != nil {
 			cs.L.Err("failed to read request body: ", err)
-			w.WriteHeader(http.StatusUnprocessableEntity)
-			_, err = w.Write([]byte("{ \"Message\": \"Error reading request body\"}"))
-			if err != nil {
-				cs.L.Err("failed to write back to client: ", err)
-			}
+			cs.writeError(w, r, http.StatusUnprocessableEntity, models.ErrCodeBadRequest, "Error reading request body")
 			return
 		}
 		err = json.Unmarshal(bytes, &remoteFiles)
 		if err != nil {
 			cs.L.Err("can't unmarshal json ", err)
-			w.WriteHeader(http.StatusUnprocessableEntity)
-			_, err = w.Write([]byte("{ \"Message\": \"Error parsing JSON\"}"))
-			if err != nil {
-				cs.L.Err("failed to write back to client: ", err)
-			}
+			cs.writeError(w, r, http.StatusUnprocessableEntity, models.ErrCodeBadRequest, "Error parsing JSON: "+err.Error())
 			return
 		}
 
-		resp.Files = filelist.CompareMaps(cs.HashMap, remoteFiles.Files)
+		resp.Generation, _ = cs.Manifest.Generation()
+		serverFiles := cs.Manifest.Files()
+		// files we don't offer aren't any of our business
+		matcher := cs.Manifest.Ignore()
+		for file := range remoteFiles.Files {
+			if matcher.Ignored(file) {
+				delete(remoteFiles.Files, file)
+			}
+		}
+		// clients that subscribed to groups only get the files in them
+		offered := serverFiles
+		if len(remoteFiles.Groups) > 0 {
+			if offered, err = cs.Groups.Select(remoteFiles.Groups, serverFiles); err != nil {
+				cs.writeError(w, r, http.StatusBadRequest, models.ErrCodeBadRequest, err.Error())
+				return
+			}
+		}
+		resp.Files = filelist.CompareMaps(offered, remoteFiles.Files)
+		resp.Hashes = make(map[string]string, len(resp.Files))
+		resp.Sizes = make(map[string]int64, len(resp.Files))
+		for _, file := range resp.Files {
+			resp.Hashes[file] = serverFiles[file]
+			if info, err := os.Stat(filepath.Join(cs.C.MapPath, file)); err == nil {
+				resp.Sizes[file] = info.Size()
+			}
+		}
+		// two way clients upload these
+		for file := range remoteFiles.Files {
+			if _, ok := serverFiles[file]; !ok {
+				resp.Extra = append(resp.Extra, file)
+			}
+		}
+		sort.Strings(resp.Extra)
+		// files the client still has that were deleted on purpose
+		tombstones := cs.Manifest.Tombstones()
+		for file := range remoteFiles.Files {
+			if ts, ok := tombstones[file]; ok {
+				if resp.Retired == nil {
+					resp.Retired = make(map[string]models.Tombstone)
+				}
+				resp.Retired[file] = ts
+			}
+		}
 
 		jsonBody, err = json.Marshal(resp)
 		if err != nil {
 			cs.L.Err("can't marshal json ", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			_, err = w.Write([]byte("{ \"Message\": \"Error creating response\"}"))
-			if err != nil {
-				cs.L.Err("failed to write back to client: ", err)
-			}
+			cs.internalError(w, r)
+			return
 		}
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		_, err = w.Write(jsonBody)
 		if err != nil {
@@ -109,27 +147,78 @@ func (cs *CsgoSync) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	default:
 		cs.L.Simple(fmt.Sprintf("non-existent endpoint: %s", r.URL.String()))
-		w.WriteHeader(http.StatusNotFound)
-		_, err = w.Write([]byte("{ \"Message\": \"Not found\"}"))
-		if err != nil {
-			log.Println(err)
-		}
+		cs.methodNotAllowed(w, r, http.MethodPost)
+		return
 	}
 	cs.L.Simple(fmt.Sprintf("ip: %v successfully sent map delta (%d)", ip, len(resp.Files)))
 }
 
+// make sure user was "authenticated", if not tells them and returns false. A token with the
+// sync scope works in place of the password, in the pass header or as a bearer token.
+// TODO: put this in middlware
+func (cs *CsgoSync) authorized(w http.ResponseWriter, r *http.Request) bool {
+	return cs.authorizedFor(w, r, models.ScopeSync)
+}
+
+// authorizedFor is authorized for tokens with the scope, the password only works for syncing
+func (cs *CsgoSync) authorizedFor(w http.ResponseWriter, r *http.Request, scope string) bool {
+	if pass := credentials(r); pass != "" {
+		if t, ok := cs.Tokens.Check(pass, scope); ok {
+			setUser(r, "token:"+t.Name)
+			return true
+		} else if t.ID != "" {
+			setUser(r, "token:"+t.Name)
+			cs.writeError(w, r, http.StatusForbidden, models.ErrCodeForbidden, "Token doesn't have the "+scope+" scope")
+			return false
+		}
+		if pass != cs.C.Pass {
+			cs.L.Simple(fmt.Sprintf("unauthorized: bad pass from %s", GetRequestIp(r)))
+			cs.authFailed(r)
+			cs.unauthorized(w, r)
+			return false
+		}
+		setUser(r, "client")
+		if scope != models.ScopeSync {
+			cs.writeError(w, r, http.StatusForbidden, models.ErrCodeForbidden, "The password can't "+scope+", use a token")
+			return false
+		}
+		return true
+	}
+	cs.L.Simple("unauthorized: no password")
+	cs.unauthorized(w, r)
+	return false
+}
+
+// authFailed counts a wrong password against the ip, too many and it gets banned
+func (cs *CsgoSync) authFailed(r *http.Request) {
+	cs.Metrics.authFailure()
+	if cs.Firewall != nil && cs.Firewall.Failure(requestIP(r)) {
+		cs.L.Simple(fmt.Sprintf("banned %s for %v after %d failed logins",
+			GetRequestIp(r), cs.C.BanTime, cs.C.MaxAuthFailures))
+	}
+}
+
+// credentials returns the password or token the request was sent with
+func credentials(r *http.Request) string {
+	if pass := r.Header.Get("Pass"); pass != "" {
+		return pass
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
 // Tell the user they're unauthorized and to f off
-func unAuth(w http.ResponseWriter) (err error) {
-	w.WriteHeader(http.StatusUnauthorized)
-	_, err = w.Write([]byte("{ \"Message\": \"Unauthorized\"}"))
-	return
+func (cs *CsgoSync) unauthorized(w http.ResponseWriter, r *http.Request) {
+	cs.writeError(w, r, http.StatusUnauthorized, models.ErrCodeUnauthorized, "Unauthorized")
 }
 
-// Grabs the request ip address
+// Grabs the request ip address, see clientIP for how proxies are handled
 func GetRequestIp(r *http.Request) string {
-	ip := r.Header.Get("X-Forwarded-For")
-	if ip == "" {
-		ip = r.RemoteAddr
+	ip := requestIP(r)
+	if ip == nil {
+		return r.RemoteAddr
 	}
-	return ip
+	return ip.String()
 }
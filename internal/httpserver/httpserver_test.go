@@ -0,0 +1,66 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/httpserver_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the helpers for testing the http server.
+*/
+
+package httpserver
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/kthomas422/csgosync/config"
+	"github.com/kthomas422/csgosync/internal/csgolog"
+	"github.com/kthomas422/csgosync/internal/tokens"
+)
+
+// testPass is the password of the test servers
+const testPass = "pass"
+
+// newTestServer returns a server for a map directory with files in it, settings are put in the
+// config before it's read. The hash map is generated before it's returned.
+func newTestServer(t *testing.T, files map[string]string, settings map[string]interface{}) *CsgoSync {
+	t.Helper()
+	dir, state := t.TempDir(), t.TempDir()
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	viper.Reset()
+	viper.Set("MAP_PATH", dir)
+	viper.Set("PASSWORD", testPass)
+	viper.Set("TOKENS_FILE", filepath.Join(state, "tokens.json"))
+	viper.Set("MANIFEST_FILE", filepath.Join(state, "manifest.json"))
+	for key, value := range settings {
+		viper.Set(key, value)
+	}
+	c, err := config.InitServerConfig()
+	if err != nil {
+		t.Fatal("config: ", err)
+	}
+	l, err := csgolog.InitLogger(filepath.Join(state, "csgosyncd.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	cs := &CsgoSync{L: l, C: c}
+	if cs.Tokens, err = tokens.Open(c.TokensFile); err != nil {
+		t.Fatal(err)
+	}
+	if cs.Manifest, err = LoadManifest(c.ManifestFile); err != nil {
+		t.Fatal(err)
+	}
+	if errs := cs.Refresh(); len(errs) > 0 {
+		t.Fatal("refresh: ", errs)
+	}
+	return cs
+}
@@ -0,0 +1,64 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/info.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the handler telling clients what the server supports.
+*/
+
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kthomas422/csgosync/internal/filelist"
+	"github.com/kthomas422/csgosync/internal/models"
+	"github.com/kthomas422/csgosync/internal/version"
+)
+
+// Info returns the server's version and what it supports. It doesn't need the password so
+// clients can find out how to authenticate, nothing in it is secret.
+func (cs *CsgoSync) Info(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		cs.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(cs.info()); err != nil {
+		cs.L.Err("failed to write back to client: ", err)
+	}
+}
+
+// info describes the server
+func (cs *CsgoSync) info() models.Info {
+	info := models.Info{
+		Version:        version.Version,
+		Protocols:      version.Protocols,
+		HashAlgorithms: []string{filelist.Algorithm},
+		Compression:    []string{},
+		Auth:           []string{models.AuthPass, models.AuthBearer},
+		Features: []string{
+			models.FeatureEvents,
+			models.FeatureDelta,
+			models.FeatureChunks,
+			models.FeatureBundle,
+			models.FeatureUpload,
+			models.FeatureGroups,
+			models.FeatureLibraries,
+		},
+		Library: cs.Library,
+	}
+	for _, lib := range cs.Libraries {
+		info.Libraries = append(info.Libraries, lib.Library)
+	}
+	if cs.Compress != nil {
+		info.Compression = append(info.Compression, cs.Compress.Encodings()...)
+	}
+	if cs.FastDL != nil {
+		info.Features = append(info.Features, models.FeatureFastDL)
+	}
+	return info
+}
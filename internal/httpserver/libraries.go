@@ -0,0 +1,50 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/libraries.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains libraries, other directories (sounds, configs...) served next to the maps.
+	Each one is served by its own CsgoSync with its own hash map at /v1/libraries/<name>/.
+*/
+
+package httpserver
+
+import (
+	"fmt"
+
+	"github.com/kthomas422/csgosync/config"
+	"github.com/kthomas422/csgosync/internal/tokens"
+)
+
+// LibraryPrefix is where libraries are under /v1, /v1/libraries/<name>/...
+const LibraryPrefix = "/libraries/"
+
+// NewLibrary returns a CsgoSync serving the library. It logs, firewalls and counts with ours and
+// shares our api tokens unless it has its own TOKENS_FILE.
+func (cs *CsgoSync) NewLibrary(lc config.LibraryConfig) (*CsgoSync, error) {
+	lib := &CsgoSync{
+		L:        cs.L,
+		C:        cs.C.Library(lc),
+		Firewall: cs.Firewall,
+		Metrics:  cs.Metrics,
+		Tokens:   cs.Tokens,
+		Library:  lc.Name,
+	}
+	var err error
+	if lib.C.TokensFile != cs.C.TokensFile {
+		if lib.Tokens, err = tokens.Open(lib.C.TokensFile); err != nil {
+			return nil, fmt.Errorf("library %s: failed to load tokens: %w", lc.Name, err)
+		}
+	}
+	if lib.Manifest, err = LoadManifest(lib.C.ManifestFile); err != nil {
+		return nil, fmt.Errorf("library %s: failed to load manifest: %w", lc.Name, err)
+	}
+	if lib.C.CompressCache != "" {
+		if lib.Compress, err = NewCompressCache(lib.C.CompressCache, lib.C.Zstd); err != nil {
+			return nil, fmt.Errorf("library %s: failed to create compression cache: %w", lc.Name, err)
+		}
+	}
+	return lib, nil
+}
@@ -0,0 +1,326 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/manifest.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the server's list of files and the loop that keeps it up to date.
+*/
+
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kthomas422/csgosync/internal/filelist"
+	"github.com/kthomas422/csgosync/internal/ignore"
+	"github.com/kthomas422/csgosync/internal/models"
+	"github.com/kthomas422/csgosync/internal/version"
+)
+
+// Manifest is the server's list of files and their hashes. The generation is bumped every time
+// the list changes so clients can tell if they're out of date. Files that disappear from the list
+// get a tombstone so clients know they were deleted on purpose.
+type Manifest struct {
+	mu         sync.RWMutex
+	files      map[string]string // file name -> hash, replaced (never modified) on refresh
+	tombstones map[string]models.Tombstone
+	generation uint64
+	updated    time.Time
+	changed    chan struct{}   // closed and replaced when the generation changes
+	ignore     *ignore.Matcher // files that aren't offered, from the last refresh
+
+	path  string            // where the files and tombstones are saved, empty doesn't save
+	saved map[string]string // files from the last run, what the first list is compared to
+}
+
+// manifestState is what's saved of the manifest between runs
+type manifestState struct {
+	Protocol   int                         `json:"protocol"`
+	Files      map[string]string           `json:"files"`
+	Tombstones map[string]models.Tombstone `json:"tombstones"`
+}
+
+// NewManifest returns an empty manifest
+func NewManifest() *Manifest {
+	return &Manifest{
+		files:      make(map[string]string),
+		tombstones: make(map[string]models.Tombstone),
+		changed:    make(chan struct{}),
+	}
+}
+
+// LoadManifest returns an empty manifest that's saved to path. The files and tombstones from the
+// last run are loaded so files deleted while the server was down get tombstones too.
+func LoadManifest(path string) (*Manifest, error) {
+	m := NewManifest()
+	m.path = path
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var state manifestState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+	// hashes from another protocol can't be compared to ours, it'd look like every file changed
+	// and the tombstones would never match a client's file
+	if state.Protocol != version.Protocol {
+		return m, nil
+	}
+	m.saved = state.Files
+	if state.Tombstones != nil {
+		m.tombstones = state.Tombstones
+	}
+	return m, nil
+}
+
+// Files returns the current list of files, the map must not be modified
+func (m *Manifest) Files() map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.files
+}
+
+// Tombstones returns the files that were deleted, the map must not be modified
+func (m *Manifest) Tombstones() map[string]models.Tombstone {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.tombstones
+}
+
+// Generation returns the current generation and a channel that is closed when it changes
+func (m *Manifest) Generation() (uint64, <-chan struct{}) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.generation, m.changed
+}
+
+// Updated returns when the manifest was last generated, zero if it hasn't been yet
+func (m *Manifest) Updated() time.Time {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.updated
+}
+
+// SetIgnore sets the files that aren't offered
+func (m *Manifest) SetIgnore(matcher *ignore.Matcher) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ignore = matcher
+}
+
+// Ignore returns the files that aren't offered
+func (m *Manifest) Ignore() *ignore.Matcher {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.ignore
+}
+
+// Set replaces the list of files and bumps the generation if anything is different. Files that
+// are gone get a tombstone and files that are back lose theirs, files that are only gone because
+// they're ignored now weren't deleted so they don't.
+func (m *Manifest) Set(files map[string]string) (changed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.updated = time.Now()
+	if m.generation > 0 && sameFiles(m.files, files) {
+		return false
+	}
+	old := m.files
+	if m.generation == 0 && m.saved != nil {
+		old, m.saved = m.saved, nil
+	}
+	tombstones := make(map[string]models.Tombstone, len(m.tombstones))
+	for file, ts := range m.tombstones {
+		if _, back := files[file]; !back {
+			tombstones[file] = ts
+		}
+	}
+	for file, hash := range old {
+		if _, ok := files[file]; !ok && !m.ignore.Ignored(file) {
+			tombstones[file] = models.Tombstone{Hash: hash, Deleted: m.updated.UTC()}
+		}
+	}
+	m.files = files
+	m.tombstones = tombstones
+	m.generation++
+	close(m.changed) // wake up everyone waiting on this generation
+	m.changed = make(chan struct{})
+	return true
+}
+
+// Save writes the files and tombstones to the manifest's file
+func (m *Manifest) Save() error {
+	m.mu.RLock()
+	state := manifestState{Protocol: version.Protocol, Files: m.files, Tombstones: m.tombstones}
+	m.mu.RUnlock()
+	if m.path == "" {
+		return nil
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+	return nil
+}
+
+// sameFiles reports if both lists have the same files with the same hashes
+func sameFiles(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for file, hash := range a {
+		if h, ok := b[file]; !ok || h != hash {
+			return false
+		}
+	}
+	return true
+}
+
+// Refresh regenerates the hash map from the map directory
+func (cs *CsgoSync) Refresh() []error {
+	cs.refreshMu.Lock()
+	defer cs.refreshMu.Unlock()
+	cs.L.Simple("generating hash map")
+	start := time.Now()
+	var (
+		files   map[string]string
+		errs    []error
+		changed bool
+		gen     uint64
+	)
+	defer func() {
+		cs.history.add(start, time.Since(start), len(files), gen, changed, errs)
+		if cs.Metrics != nil && cs.Library == "" { // the gauges are for MAP_PATH
+			cs.Metrics.refreshed(time.Since(start), cs.manifestSize(files), len(errs))
+		}
+	}()
+	matcher, err := ignore.Load(cs.C.MapPath, cs.C.Include, cs.C.Exclude)
+	if err != nil {
+		errs = append(errs, err)
+		return errs
+	}
+	cs.Manifest.SetIgnore(matcher)
+	if files, errs = filelist.GenerateMap(cs.C.MapPath, matcher); len(errs) > 0 {
+		return errs
+	}
+	changed, gen = cs.publish(files)
+	cs.L.Simple(fmt.Sprintf("hash map generated in %v (generation: %d, changed: %v)", time.Since(start), gen, changed))
+	cs.L.Simple(fmt.Sprintf("files list: %v", files))
+	return nil
+}
+
+// publish makes files the hash map and brings the caches up to date, refreshMu has to be held
+func (cs *CsgoSync) publish(files map[string]string) (changed bool, gen uint64) {
+	changed = cs.Manifest.Set(files)
+	gen, _ = cs.Manifest.Generation()
+	if changed {
+		if err := cs.Manifest.Save(); err != nil {
+			cs.L.Err("manifest: ", err)
+		}
+	}
+
+	cs.chunkIndex().prune(files)
+
+	// keep the FastDL mirror up to date, files that didn't change are skipped
+	if cs.FastDL != nil {
+		status := cs.FastDL.Sync(files)
+		for _, err := range status.Errs {
+			cs.L.Err("fastdl mirror: ", err)
+		}
+		cs.L.Simple(status.String())
+	}
+
+	// compress new maps ahead of time so the first player to download them gets them compressed
+	if cs.Compress != nil {
+		for _, err := range cs.Compress.Warm(cs.C.MapPath, files) {
+			cs.L.Err("compression cache: ", err)
+		}
+	}
+	return changed, gen
+}
+
+// historySize is how many refreshes the dashboard shows
+const historySize = 20
+
+// refreshHistory is the last refreshes, newest last
+type refreshHistory struct {
+	mu        sync.Mutex
+	refreshes []models.Refresh
+}
+
+func (rh *refreshHistory) add(start time.Time, took time.Duration, files int, gen uint64, changed bool, errs []error) {
+	refresh := models.Refresh{
+		Time:       start.UTC(),
+		Duration:   took.Seconds(),
+		Files:      files,
+		Generation: gen,
+		Changed:    changed,
+	}
+	for _, err := range errs {
+		refresh.Errors = append(refresh.Errors, err.Error())
+	}
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+	rh.refreshes = append(rh.refreshes, refresh)
+	if len(rh.refreshes) > historySize {
+		rh.refreshes = rh.refreshes[len(rh.refreshes)-historySize:]
+	}
+}
+
+// list returns the refreshes, newest first
+func (rh *refreshHistory) list() []models.Refresh {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+	list := make([]models.Refresh, len(rh.refreshes))
+	for i, refresh := range rh.refreshes {
+		list[len(list)-1-i] = refresh
+	}
+	return list
+}
+
+// manifestSize adds up the sizes of the files in the hash map
+func (cs *CsgoSync) manifestSize(files map[string]string) int64 {
+	var size int64
+	for file := range files {
+		if info, err := os.Stat(filepath.Join(cs.C.MapPath, file)); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// RefreshLoop regenerates the hash map every refresh interval. If the first one fails there is
+// nothing to serve so it gives up, after that the old list is kept until the next refresh.
+func (cs *CsgoSync) RefreshLoop(fatal func()) {
+	for first := true; ; first = false {
+		if errs := cs.Refresh(); len(errs) > 0 {
+			for _, err := range errs {
+				cs.L.Err("failed getting hashmap", err)
+			}
+			if first {
+				fatal() // crash and burn since we can't make maps
+				return
+			}
+		}
+		time.Sleep(cs.C.RefreshInterval)
+	}
+}
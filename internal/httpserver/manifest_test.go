@@ -0,0 +1,82 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/manifest_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the server's manifest.
+*/
+
+package httpserver
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/kthomas422/csgosync/internal/ignore"
+)
+
+func TestTombstones(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	m, err := LoadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Set(map[string]string{"a.bsp": "a0", "b.bsp": "b0"})
+	m.Set(map[string]string{"a.bsp": "a0"})
+	if ts, ok := m.Tombstones()["b.bsp"]; !ok || ts.Hash != "b0" || ts.Deleted.IsZero() {
+		t.Error("b.bsp tombstone got: ", ts, ok)
+	}
+	if err := m.Save(); err != nil {
+		t.Fatal("failed to save: ", err)
+	}
+
+	// a.bsp was deleted while the server was down and b.bsp is back
+	m, err = LoadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Set(map[string]string{"b.bsp": "b1"}) {
+		t.Error("first set didn't change anything")
+	}
+	tombstones := m.Tombstones()
+	if ts, ok := tombstones["a.bsp"]; !ok || ts.Hash != "a0" {
+		t.Error("a.bsp tombstone got: ", ts, ok)
+	}
+	if _, ok := tombstones["b.bsp"]; ok {
+		t.Error("b.bsp is back but still has a tombstone")
+	}
+}
+
+func TestIgnoredNotTombstoned(t *testing.T) {
+	m := NewManifest()
+	m.Set(map[string]string{"a.bsp": "a0", "a.bsp.bak": "b0"})
+	matcher, err := ignore.New(nil, []string{"*.bak"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetIgnore(matcher)
+	m.Set(map[string]string{"a.bsp": "a0"})
+	if ts, ok := m.Tombstones()["a.bsp.bak"]; ok {
+		t.Error("ignored file got a tombstone: ", ts)
+	}
+}
+
+func TestOldProtocolManifest(t *testing.T) {
+	// saved before there was a protocol in it, the hashes were protocol 1's
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	old := `{"files":{"a.bsp":"a0"},"tombstones":{"b.bsp":{"hash":"b0"}}}`
+	if err := ioutil.WriteFile(path, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := LoadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Set(map[string]string{"c.bsp": "c0"})
+	if ts := m.Tombstones(); len(ts) != 0 {
+		t.Error("old tombstones kept: ", ts)
+	}
+}
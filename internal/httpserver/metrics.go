@@ -0,0 +1,170 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/metrics.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the server's prometheus metrics.
+*/
+
+package httpserver
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/kthomas422/csgosync/internal/metrics"
+	"github.com/kthomas422/csgosync/internal/version"
+)
+
+// Metrics are the things the server counts for /metrics. A nil *Metrics counts nothing.
+type Metrics struct {
+	registry       *metrics.Registry
+	requests       *metrics.CounterVec
+	latency        *metrics.HistogramVec
+	fileBytes      *metrics.CounterVec
+	downloads      *metrics.GaugeVec
+	authFailures   *metrics.CounterVec
+	rejected       *metrics.CounterVec
+	manifestBytes  *metrics.GaugeVec
+	refreshSeconds *metrics.GaugeVec
+	lastRefresh    *metrics.GaugeVec
+	hashErrors     *metrics.CounterVec
+}
+
+// InitMetrics starts counting metrics
+func (cs *CsgoSync) InitMetrics() {
+	r := metrics.NewRegistry()
+	m := &Metrics{
+		registry: r,
+		requests: r.Counter("csgosync_http_requests_total",
+			"Requests answered by route, method and status.", "route", "method", "status"),
+		latency: r.Histogram("csgosync_http_request_duration_seconds",
+			"Time taken to answer requests by route and status.", metrics.DefaultBuckets, "route", "status"),
+		fileBytes: r.Counter("csgosync_file_bytes_sent_total",
+			"Bytes sent of each map by whole file and delta downloads.", "file"),
+		downloads: r.Gauge("csgosync_active_downloads",
+			"Map, delta and bundle downloads in progress."),
+		authFailures: r.Counter("csgosync_auth_failures_total",
+			"Requests with a wrong password or token."),
+		rejected: r.Counter("csgosync_firewall_rejected_total",
+			"Requests turned away by the firewall by reason.", "reason"),
+		manifestBytes: r.Gauge("csgosync_manifest_bytes",
+			"Total size of the files in the hash map."),
+		refreshSeconds: r.Gauge("csgosync_refresh_duration_seconds",
+			"Time the last hash map refresh took."),
+		lastRefresh: r.Gauge("csgosync_last_refresh_timestamp_seconds",
+			"Unix time of the last hash map refresh."),
+		hashErrors: r.Counter("csgosync_hash_errors_total",
+			"Files that couldn't be hashed while refreshing the hash map."),
+	}
+	r.GaugeFunc("csgosync_manifest_files", "Files in the hash map.", func() float64 {
+		if cs.Manifest == nil {
+			return 0
+		}
+		return float64(len(cs.Manifest.Files()))
+	})
+	r.GaugeFunc("csgosync_manifest_generation", "Generation of the hash map.", func() float64 {
+		if cs.Manifest == nil {
+			return 0
+		}
+		gen, _ := cs.Manifest.Generation()
+		return float64(gen)
+	})
+	r.GaugeFunc("go_goroutines", "Number of goroutines that currently exist.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+	r.Gauge("csgosync_build_info", "Version of csgosync, always 1.", "version", "protocol").
+		Set(1, version.Version, strconv.Itoa(version.Protocol))
+	cs.Metrics = m
+}
+
+// ServeMetrics writes the metrics in the prometheus text format (GET /metrics), with a metrics
+// token set it has to be sent as a bearer token
+func (cs *CsgoSync) ServeMetrics(w http.ResponseWriter, r *http.Request) {
+	if cs.C.MetricsToken != "" {
+		want := "Bearer " + cs.C.MetricsToken
+		if got := r.Header.Get("Authorization"); subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+			if got != "" {
+				cs.authFailed(r)
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			cs.unauthorized(w, r)
+			return
+		}
+		setUser(r, "metrics")
+	}
+	if r.Method != http.MethodGet {
+		cs.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	if cs.Metrics == nil {
+		cs.notFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", metrics.ContentType)
+	if _, err := cs.Metrics.registry.WriteTo(w); err != nil {
+		cs.L.Err("failed to write back to client: ", err)
+	}
+}
+
+// request counts a request that was answered
+func (m *Metrics) request(route, method string, status int, took time.Duration, file string, bytes int64) {
+	if m == nil {
+		return
+	}
+	if route == "" {
+		route = "other"
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete:
+	default:
+		method = "other" // don't let clients make up label values
+	}
+	m.requests.Inc(route, method, strconv.Itoa(status))
+	m.latency.Observe(took.Seconds(), route, strconv.Itoa(status))
+	// error bodies aren't the file (206 is a 2xx too)
+	if file != "" && bytes > 0 && status >= 200 && status < 300 {
+		m.fileBytes.Add(float64(bytes), file)
+	}
+}
+
+// downloading counts a download as active until the returned func is called
+func (m *Metrics) downloading() func() {
+	if m == nil {
+		return func() {}
+	}
+	m.downloads.Add(1)
+	return func() { m.downloads.Add(-1) }
+}
+
+// authFailure counts a wrong password
+func (m *Metrics) authFailure() {
+	if m != nil {
+		m.authFailures.Inc()
+	}
+}
+
+// reject counts a request the firewall turned away
+func (m *Metrics) reject(reason string) {
+	if m != nil {
+		m.rejected.Inc(reason)
+	}
+}
+
+// refreshed records a hash map refresh
+func (m *Metrics) refreshed(took time.Duration, bytes int64, hashErrors int) {
+	if m == nil {
+		return
+	}
+	m.refreshSeconds.Set(took.Seconds())
+	m.lastRefresh.Set(float64(time.Now().Unix()))
+	m.hashErrors.Add(float64(hashErrors))
+	if hashErrors == 0 {
+		m.manifestBytes.Set(float64(bytes))
+	}
+}
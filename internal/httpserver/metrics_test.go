@@ -0,0 +1,89 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/metrics_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the server's prometheus metrics.
+*/
+
+package httpserver
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLatencyByStatus(t *testing.T) {
+	cs := newTestServer(t, map[string]string{"de_a.bsp": "a"}, nil)
+	cs.InitMetrics()
+	h := cs.AccessLog(Route("/v1/maps/", http.StripPrefix("/v1", cs.Maps())))
+	for _, path := range []string{"/v1/maps/de_a.bsp", "/v1/maps/de_a.bsp", "/v1/maps/de_missing.bsp"} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Pass", testPass)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	var out bytes.Buffer
+	if _, err := cs.Metrics.registry.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`csgosync_http_request_duration_seconds_count{route="/v1/maps/",status="200"} 2`,
+		`csgosync_http_request_duration_seconds_count{route="/v1/maps/",status="404"} 1`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Error("missing: ", want)
+		}
+	}
+}
+
+func TestUploadsHaveNoFileLabel(t *testing.T) {
+	cs := newTestServer(t, map[string]string{"de_a.bsp": "a"}, map[string]interface{}{"MIN_FREE_SPACE": "0"})
+	cs.InitMetrics()
+	token := uploadToken(t, cs)
+	h := cs.AccessLog(Route("/v1/files/", http.StripPrefix("/v1", http.HandlerFunc(cs.Upload))))
+	// rejected or not, the names are whatever the client sent
+	for _, name := range []string{"made_up_1.bsp", "evil.exe", "de_b.bsp"} {
+		r := httptest.NewRequest(http.MethodPut, "/v1/files/"+name, strings.NewReader("b"))
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.Header.Set(HashHeader, sha1Hex("not b"))
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	var out bytes.Buffer
+	if _, err := cs.Metrics.registry.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "csgosync_file_bytes_sent_total{") {
+		t.Error("uploads got file labels: ", out.String())
+	}
+}
+
+func TestFileBytesOnlyForFiles(t *testing.T) {
+	cs := newTestServer(t, map[string]string{"de_a.bsp": "aaaa"}, nil)
+	cs.InitMetrics()
+	h := cs.AccessLog(Route("/v1/maps/", http.StripPrefix("/v1", cs.Maps())))
+	for _, rng := range []string{"", "bytes=2-", "bytes=100-"} {
+		r := httptest.NewRequest(http.MethodGet, "/v1/maps/de_a.bsp", nil)
+		r.Header.Set("Pass", testPass)
+		if rng != "" {
+			r.Header.Set("Range", rng)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	var out bytes.Buffer
+	if _, err := cs.Metrics.registry.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	// the whole file and the 206, not the 416's error
+	want := `csgosync_file_bytes_sent_total{file="de_a.bsp"} 6`
+	if !strings.Contains(out.String(), want) {
+		t.Error("missing: ", want, " got: ", out.String())
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/proxy.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains working out the client's ip when the server is behind proxies.
+*/
+
+package httpserver
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// clientIP returns the ip of the client that made the request. X-Forwarded-For and Forwarded are
+// only believed when they come from a trusted proxy, and then only back to the first address
+// that isn't a trusted proxy since anything before that could have been made up by the client.
+func clientIP(r *http.Request, trusted []*net.IPNet) net.IP {
+	ip := parseAddr(r.RemoteAddr)
+	if ip == nil || !contains(trusted, ip) {
+		return ip
+	}
+	chain := forwardedFor(r.Header)
+	for i := len(chain) - 1; i >= 0 && contains(trusted, ip); i-- {
+		next := parseAddr(chain[i])
+		if next == nil {
+			break // "unknown" or garbage, the last proxy we trust is as far back as we can go
+		}
+		ip = next
+	}
+	return ip
+}
+
+// forwardedFor returns the addresses the request was forwarded for, client first. Forwarded is
+// used if the proxies sent it, otherwise X-Forwarded-For.
+func forwardedFor(h http.Header) []string {
+	var chain []string
+	if values := h.Values("Forwarded"); len(values) > 0 {
+		for _, value := range values {
+			for _, hop := range strings.Split(value, ",") {
+				for _, pair := range strings.Split(hop, ";") {
+					pair = strings.TrimSpace(pair)
+					if len(pair) > 4 && strings.EqualFold(pair[:4], "for=") {
+						chain = append(chain, strings.Trim(pair[4:], `"`))
+					}
+				}
+			}
+		}
+		return chain
+	}
+	for _, value := range h.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(value, ",") {
+			chain = append(chain, strings.TrimSpace(addr))
+		}
+	}
+	return chain
+}
+
+// parseAddr parses an ip that might have a port and brackets around it, nil if it isn't an ip
+func parseAddr(addr string) net.IP {
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]"))
+}
+
+// contains returns whether the ip is in any of the networks
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
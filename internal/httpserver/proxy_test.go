@@ -0,0 +1,73 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/proxy_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the client ip detection for the csgo sync application.
+*/
+
+package httpserver
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	var trusted []*net.IPNet
+	for _, cidr := range []string{"10.0.0.0/8", "fd00::/8"} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trusted = append(trusted, n)
+	}
+	var tests = []struct {
+		name    string
+		remote  string
+		headers map[string][]string
+		trusted []*net.IPNet
+		want    string
+	}{
+		{"no proxy", "203.0.113.7:4000", nil, trusted, "203.0.113.7"},
+		{"spoofed by untrusted peer", "203.0.113.7:4000",
+			map[string][]string{"X-Forwarded-For": {"1.2.3.4"}}, trusted, "203.0.113.7"},
+		{"no trusted proxies", "10.0.0.1:4000",
+			map[string][]string{"X-Forwarded-For": {"1.2.3.4"}}, nil, "10.0.0.1"},
+		{"trusted proxy", "10.0.0.1:4000",
+			map[string][]string{"X-Forwarded-For": {"198.51.100.9"}}, trusted, "198.51.100.9"},
+		{"right most untrusted", "10.0.0.1:4000",
+			map[string][]string{"X-Forwarded-For": {"1.2.3.4, 198.51.100.9, 10.0.0.2"}}, trusted, "198.51.100.9"},
+		{"multiple headers", "10.0.0.1:4000",
+			map[string][]string{"X-Forwarded-For": {"1.2.3.4, 198.51.100.9", "10.0.0.2"}}, trusted, "198.51.100.9"},
+		{"all trusted", "10.0.0.1:4000",
+			map[string][]string{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, trusted, "10.0.0.3"},
+		{"garbage", "10.0.0.1:4000",
+			map[string][]string{"X-Forwarded-For": {"198.51.100.9, nonsense"}}, trusted, "10.0.0.1"},
+		{"forwarded", "10.0.0.1:4000",
+			map[string][]string{"Forwarded": {`for=1.2.3.4, for="[2001:db8:cafe::17]:4711";proto=https, For=10.0.0.2`}},
+			trusted, "2001:db8:cafe::17"},
+		{"forwarded over x-forwarded-for", "10.0.0.1:4000",
+			map[string][]string{"Forwarded": {"for=198.51.100.9"}, "X-Forwarded-For": {"1.2.3.4"}},
+			trusted, "198.51.100.9"},
+		{"forwarded unknown", "10.0.0.1:4000",
+			map[string][]string{"Forwarded": {"for=unknown"}}, trusted, "10.0.0.1"},
+		{"ipv6 proxy", "[fd00::1]:4000",
+			map[string][]string{"X-Forwarded-For": {"198.51.100.9"}}, trusted, "198.51.100.9"},
+	}
+	for _, test := range tests {
+		r := &http.Request{RemoteAddr: test.remote, Header: http.Header{}}
+		for k, values := range test.headers {
+			for _, v := range values {
+				r.Header.Add(k, v)
+			}
+		}
+		got := clientIP(r, test.trusted)
+		if got.String() != test.want {
+			t.Error("[", test.name, "] got: ", got, " wanted: ", test.want)
+		}
+	}
+}
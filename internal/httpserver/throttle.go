@@ -0,0 +1,100 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/throttle.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the bandwidth limiting for the http server.
+*/
+
+package httpserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kthomas422/csgosync/internal/ratelimit"
+)
+
+type connBucketKey struct{}
+
+// ConnContext gives every connection its own bucket for the per connection rate limit and lets
+// handlers change their deadlines, set it as the http.Server's ConnContext
+func (cs *CsgoSync) ConnContext(ctx context.Context, c net.Conn) context.Context {
+	ctx = context.WithValue(ctx, connKey{}, c)
+	if cs.C.ConnRateLimit <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, connBucketKey{}, ratelimit.NewBucket(cs.C.ConnRateLimit, cs.C.RateBurst))
+}
+
+// Throttle limits everything the handler sends to the total and per connection rate limits
+func (cs *CsgoSync) Throttle(next http.Handler) http.Handler {
+	total := ratelimit.NewBucket(cs.C.RateLimit, cs.C.RateBurst)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _ := r.Context().Value(connBucketKey{}).(*ratelimit.Bucket)
+		if total == nil && conn == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&throttledWriter{
+			ResponseWriter: w,
+			w:              ratelimit.Writer(w, total, conn),
+			r:              r,
+			rate:           slowest(cs.C.RateLimit, cs.C.ConnRateLimit),
+		}, r)
+	})
+}
+
+// slowest returns the lowest of the rate limits, 0 if they're all unlimited
+func slowest(rates ...int64) int64 {
+	var min int64
+	for _, rate := range rates {
+		if rate > 0 && (min == 0 || rate < min) {
+			min = rate
+		}
+	}
+	return min
+}
+
+// throttledWriter sends the body through the rate limited writer
+type throttledWriter struct {
+	http.ResponseWriter
+	w       io.Writer
+	r       *http.Request
+	rate    int64 // slowest limit the body goes out at
+	started bool
+}
+
+// WriteHeader gives the response as long as it takes to send it at the rate limit on top of the
+// server's WriteTimeout, otherwise big maps get cut off. Responses without a length keep it.
+func (tw *throttledWriter) WriteHeader(status int) {
+	if !tw.started {
+		tw.started = true
+		size, err := strconv.ParseInt(tw.Header().Get("Content-Length"), 10, 64)
+		if err == nil && size > 0 && tw.rate > 0 {
+			send := time.Duration(float64(size) / float64(tw.rate) * float64(time.Second))
+			setWriteDeadline(tw.r, time.Now().Add(WriteTimeout+send))
+		}
+	}
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *throttledWriter) Write(b []byte) (int, error) {
+	if !tw.started {
+		tw.WriteHeader(http.StatusOK)
+	}
+	return tw.w.Write(b)
+}
+
+// Flush keeps the event stream working
+func (tw *throttledWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/throttle_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the bandwidth limiting.
+*/
+
+package httpserver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThrottledDownloadOutlivesWriteTimeout(t *testing.T) {
+	// 128KB at 64KB/s takes about a second, way over the server's timeout
+	data := strings.Repeat("x", 128*1024)
+	cs := newTestServer(t, map[string]string{"de_big.bsp": data}, map[string]interface{}{"RATE_LIMIT": "64KB"})
+	srv := httptest.NewUnstartedServer(cs.Throttle(http.StripPrefix("/v1", cs.Maps())))
+	srv.Config.WriteTimeout = time.Millisecond * 100
+	srv.Config.ConnContext = cs.ConnContext
+	srv.Start()
+	defer srv.Close()
+
+	start := time.Now()
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/v1/maps/de_big.bsp", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Pass", testPass)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil || len(body) != len(data) {
+		t.Fatal("got: ", len(body), " bytes ", err, " wanted: ", len(data))
+	}
+	if took := time.Since(start); took < time.Millisecond*500 {
+		t.Error("download wasn't throttled, took: ", took)
+	}
+}
+
+func TestSlowest(t *testing.T) {
+	tests := []struct {
+		rates []int64
+		want  int64
+	}{
+		{[]int64{0, 0}, 0},
+		{[]int64{100, 0}, 100},
+		{[]int64{0, 50}, 50},
+		{[]int64{100, 50}, 50},
+	}
+	for _, test := range tests {
+		if got := slowest(test.rates...); got != test.want {
+			t.Error("[", test.rates, "] got: ", got, " wanted: ", test.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/transfers.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains keeping track of the downloads in progress.
+*/
+
+package httpserver
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+// transferList is the downloads in progress
+type transferList struct {
+	mu     sync.Mutex
+	next   uint64
+	active map[uint64]*transfer
+}
+
+type transfer struct {
+	models.Transfer
+	rec *statusRecorder // how much has been sent, nil outside AccessLog
+}
+
+// transferring tracks the request as a download of file (for the dashboard and metrics) until
+// the returned func is called
+func (cs *CsgoSync) transferring(r *http.Request, file string) func() {
+	t := &transfer{Transfer: models.Transfer{
+		IP:      GetRequestIp(r),
+		File:    file,
+		Started: time.Now().UTC(),
+	}}
+	if info, ok := r.Context().Value(requestKey{}).(*requestInfo); ok {
+		t.RequestID, t.User, t.Route, t.rec = info.id, info.user, info.route, info.rec
+	}
+
+	tl := &cs.transfers
+	tl.mu.Lock()
+	if tl.active == nil {
+		tl.active = make(map[uint64]*transfer)
+	}
+	id := tl.next
+	tl.next++
+	tl.active[id] = t
+	tl.mu.Unlock()
+
+	done := cs.Metrics.downloading()
+	return func() {
+		done()
+		tl.mu.Lock()
+		delete(tl.active, id)
+		tl.mu.Unlock()
+	}
+}
+
+// list returns the downloads in progress, oldest first
+func (tl *transferList) list() []models.Transfer {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	list := make([]models.Transfer, 0, len(tl.active))
+	for _, t := range tl.active {
+		tr := t.Transfer
+		if t.rec != nil {
+			tr.Bytes = t.rec.written()
+		}
+		list = append(list, tr)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Started.Before(list[j].Started) })
+	return list
+}
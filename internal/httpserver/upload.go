@@ -0,0 +1,191 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/upload.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the handler for uploading files into the map directory.
+*/
+
+package httpserver
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kthomas422/csgosync/internal/bundle"
+	"github.com/kthomas422/csgosync/internal/disk"
+	"github.com/kthomas422/csgosync/internal/filelist"
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+// uploadDir is where uploads are written until they're checked, it's in the map directory so
+// they can be renamed into place but the hash map doesn't look in directories
+const uploadDir = ".csgosync-uploads"
+
+// uploadTimeout is how long reading an upload can take, the server's ReadTimeout is too short for
+// big files but everything else should be quick so it only goes up for uploads
+const uploadTimeout = time.Minute * 10
+
+// HashHeader is the header uploads are sent with the file's hash in (like in the hash map)
+const HashHeader = "X-Hash"
+
+// Upload puts a file in the map directory (PUT /files/<file>). It needs a token with the upload
+// scope and the file's hash in the X-Hash header. The file is written next to the maps, checked
+// against the hash and then renamed into place and added to the hash map.
+func (cs *CsgoSync) Upload(w http.ResponseWriter, r *http.Request) {
+	if !cs.authorizedFor(w, r, models.ScopeUpload) {
+		return
+	}
+	if r.Method != http.MethodPut {
+		cs.methodNotAllowed(w, r, http.MethodPut)
+		return
+	}
+	if gen, _ := cs.Manifest.Generation(); gen == 0 {
+		cs.writeError(w, r, http.StatusServiceUnavailable, models.ErrCodeUnavailable, "The hash map hasn't been generated yet")
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/files/")
+	if !bundle.SafeName(name) || strings.HasPrefix(name, ".") {
+		cs.writeError(w, r, http.StatusBadRequest, models.ErrCodeBadRequest, "Bad file name")
+		return
+	}
+	if !cs.uploadAllowed(name) {
+		cs.writeError(w, r, http.StatusUnsupportedMediaType, models.ErrCodeUnsupportedType,
+			fmt.Sprintf("Only files ending in %s can be uploaded", strings.Join(cs.C.UploadExts, " ")))
+		return
+	}
+	if cs.Manifest.Ignore().Ignored(name) {
+		cs.writeError(w, r, http.StatusUnsupportedMediaType, models.ErrCodeUnsupportedType,
+			"The server's include/exclude patterns don't sync "+name)
+		return
+	}
+	hash := strings.ToLower(r.Header.Get(HashHeader))
+	if b, err := hex.DecodeString(hash); err != nil || len(b) == 0 {
+		cs.writeError(w, r, http.StatusBadRequest, models.ErrCodeBadRequest, "Missing or bad "+HashHeader+" header")
+		return
+	}
+	if r.ContentLength > cs.C.MaxUploadSize {
+		cs.tooLarge(w, r)
+		return
+	}
+	if r.ContentLength > 0 {
+		u, err := disk.Space(cs.C.MapPath)
+		if err == nil && int64(u.Free)-r.ContentLength < cs.C.MinFreeSpace {
+			cs.writeError(w, r, http.StatusInsufficientStorage, models.ErrCodeNoSpace, "Not enough free space for the file")
+			return
+		}
+	}
+
+	// write it out of the way first
+	dir := filepath.Join(cs.C.MapPath, uploadDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		cs.L.Err("failed to create upload directory: ", err)
+		cs.internalError(w, r)
+		return
+	}
+	f, err := ioutil.TempFile(dir, name+".*.tmp")
+	if err != nil {
+		cs.L.Err("failed to create upload file: ", err)
+		cs.internalError(w, r)
+		return
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp) // nothing to remove once it's been renamed
+	setReadDeadline(r, time.Now().Add(uploadTimeout))
+	n, err := io.Copy(f, http.MaxBytesReader(w, r.Body, cs.C.MaxUploadSize))
+	if cerr := f.Close(); err == nil && cerr != nil {
+		cs.L.Err("failed to write upload: ", cerr)
+		cs.internalError(w, r)
+		return
+	}
+	switch {
+	case err != nil && n >= cs.C.MaxUploadSize:
+		cs.tooLarge(w, r)
+		return
+	case err != nil:
+		cs.L.Err(fmt.Sprintf("failed reading upload of %s from %s: ", name, GetRequestIp(r)), err)
+		cs.writeError(w, r, http.StatusBadRequest, models.ErrCodeBadRequest, "Failed reading the file")
+		return
+	case n == 0:
+		cs.writeError(w, r, http.StatusBadRequest, models.ErrCodeBadRequest, "Empty file")
+		return
+	}
+	got, err := filelist.HashFile(tmp)
+	if err != nil {
+		cs.L.Err("failed to hash upload: ", err)
+		cs.internalError(w, r)
+		return
+	}
+	if got != hash {
+		cs.writeError(w, r, http.StatusUnprocessableEntity, models.ErrCodeHashMismatch,
+			fmt.Sprintf("File hashed to %s, not %s", got, hash))
+		return
+	}
+	if err := os.Chmod(tmp, 0644); err != nil {
+		cs.L.Err("failed to chmod upload: ", err)
+	}
+
+	// waits for a refresh in progress, otherwise it could put back a hash map from before the file
+	cs.refreshMu.Lock()
+	old := cs.Manifest.Files()
+	_, replaced := old[name]
+	if err := os.Rename(tmp, filepath.Join(cs.C.MapPath, name)); err != nil {
+		cs.refreshMu.Unlock()
+		cs.L.Err("failed to move upload into place: ", err)
+		cs.internalError(w, r)
+		return
+	}
+	files := make(map[string]string, len(old)+1)
+	for file, h := range old {
+		files[file] = h
+	}
+	files[name] = hash
+	_, gen := cs.publish(files)
+	cs.refreshMu.Unlock()
+
+	cs.L.Simple(fmt.Sprintf("ip: %s uploaded %s (%d bytes, replaced: %v, generation: %d)",
+		GetRequestIp(r), name, n, replaced, gen))
+	status := http.StatusCreated
+	if replaced {
+		status = http.StatusOK
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err = json.NewEncoder(w).Encode(models.Uploaded{
+		File:       name,
+		Size:       n,
+		Hash:       hash,
+		Replaced:   replaced,
+		Generation: gen,
+	})
+	if err != nil {
+		cs.L.Err("failed to write back to client: ", err)
+	}
+}
+
+// uploadAllowed returns whether files named name can be uploaded
+func (cs *CsgoSync) uploadAllowed(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, allowed := range cs.C.UploadExts {
+		if allowed == "*" || allowed == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// tooLarge tells the client the upload is bigger than we take
+func (cs *CsgoSync) tooLarge(w http.ResponseWriter, r *http.Request) {
+	cs.writeError(w, r, http.StatusRequestEntityTooLarge, models.ErrCodeTooLarge,
+		fmt.Sprintf("Files can't be bigger than %d bytes", cs.C.MaxUploadSize))
+}
@@ -0,0 +1,181 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/httpserver/upload_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing uploads.
+*/
+
+package httpserver
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+// uploadToken returns the secret of a token that can upload to the server
+func uploadToken(t *testing.T, cs *CsgoSync) string {
+	t.Helper()
+	secret, _, err := cs.Tokens.Create("mapper", []string{models.ScopeUpload})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+func sha1Hex(data string) string {
+	sum := sha1.Sum([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestSlowUploadOutlivesReadTimeout(t *testing.T) {
+	cs := newTestServer(t, map[string]string{"de_a.bsp": "a"}, map[string]interface{}{"MIN_FREE_SPACE": "0"})
+	srv := httptest.NewUnstartedServer(http.StripPrefix("/v1", http.HandlerFunc(cs.Upload)))
+	srv.Config.ReadTimeout = time.Millisecond * 200
+	srv.Config.ConnContext = cs.ConnContext
+	srv.Start()
+	defer srv.Close()
+
+	// the body takes longer to send than the server's ReadTimeout
+	body, pw := io.Pipe()
+	go func() {
+		for i := 0; i < 5; i++ {
+			time.Sleep(time.Millisecond * 100)
+			if _, err := pw.Write([]byte("slow")); err != nil {
+				return
+			}
+		}
+		pw.Close()
+	}()
+	req, _ := http.NewRequest(http.MethodPut, srv.URL+"/v1/files/de_slow.bsp", body)
+	req.Header.Set("Authorization", "Bearer "+uploadToken(t, cs))
+	req.Header.Set(HashHeader, sha1Hex("slowslowslowslowslow"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Error("got: ", resp.Status)
+	}
+}
+
+// upload sends the file like csgosync push does, a negative length sends it without one
+func upload(cs *CsgoSync, token, name, data, hash string, length int64) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPut, "/files/"+name, strings.NewReader(data))
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.Header.Set(HashHeader, hash)
+	r.ContentLength = length
+	w := httptest.NewRecorder()
+	cs.Upload(w, r)
+	return w
+}
+
+func TestUploadRejected(t *testing.T) {
+	cs := newTestServer(t, map[string]string{"de_a.bsp": "a"}, map[string]interface{}{
+		"MIN_FREE_SPACE":  "0",
+		"MAX_UPLOAD_SIZE": "1KB",
+		"EXCLUDE":         "wip_*",
+	})
+	token := uploadToken(t, cs)
+	big := strings.Repeat("x", 2000)
+	tests := []struct {
+		why    string
+		name   string
+		data   string
+		hash   string
+		length int64
+		status int
+		code   string
+	}{
+		{"traversal", "../evil.bsp", "x", sha1Hex("x"), 1, http.StatusBadRequest, models.ErrCodeBadRequest},
+		{"directory", "maps/evil.bsp", "x", sha1Hex("x"), 1, http.StatusBadRequest, models.ErrCodeBadRequest},
+		{"backslash", `..%5Cevil.bsp`, "x", sha1Hex("x"), 1, http.StatusBadRequest, models.ErrCodeBadRequest},
+		{"hidden", ".csgosyncignore.bsp", "x", sha1Hex("x"), 1, http.StatusBadRequest, models.ErrCodeBadRequest},
+		{"empty name", "", "x", sha1Hex("x"), 1, http.StatusBadRequest, models.ErrCodeBadRequest},
+		{"extension", "evil.exe", "x", sha1Hex("x"), 1, http.StatusUnsupportedMediaType, models.ErrCodeUnsupportedType},
+		{"ignored", "wip_x.bsp", "x", sha1Hex("x"), 1, http.StatusUnsupportedMediaType, models.ErrCodeUnsupportedType},
+		{"no hash", "de_b.bsp", "x", "", 1, http.StatusBadRequest, models.ErrCodeBadRequest},
+		{"too large", "de_b.bsp", big, sha1Hex(big), int64(len(big)), http.StatusRequestEntityTooLarge, models.ErrCodeTooLarge},
+		{"too large without a length", "de_b.bsp", big, sha1Hex(big), -1, http.StatusRequestEntityTooLarge, models.ErrCodeTooLarge},
+		{"hash mismatch", "de_b.bsp", "b", sha1Hex("not b"), 1, http.StatusUnprocessableEntity, models.ErrCodeHashMismatch},
+	}
+	gen, _ := cs.Manifest.Generation()
+	for _, test := range tests {
+		w := upload(cs, token, test.name, test.data, test.hash, test.length)
+		var e models.Error
+		if err := json.NewDecoder(w.Body).Decode(&e); w.Code != test.status || err != nil || e.Code != test.code {
+			t.Error("[", test.why, "] got: ", w.Code, " ", e.Code, err, " wanted: ", test.status, " ", test.code)
+		}
+	}
+
+	// nothing got in and nothing was left behind
+	if now, _ := cs.Manifest.Generation(); now != gen {
+		t.Error("generation changed: ", gen, " -> ", now)
+	}
+	entries, err := ioutil.ReadDir(cs.C.MapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != "de_a.bsp" && entry.Name() != uploadDir {
+			t.Error("left in the map directory: ", entry.Name())
+		}
+	}
+	if left, _ := ioutil.ReadDir(filepath.Join(cs.C.MapPath, uploadDir)); len(left) > 0 {
+		t.Error("left in ", uploadDir, ": ", left[0].Name())
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(cs.C.MapPath), "evil.bsp")); !os.IsNotExist(err) {
+		t.Error("traversal wrote outside the map directory: ", err)
+	}
+}
+
+func TestUploadReplaces(t *testing.T) {
+	cs := newTestServer(t, map[string]string{"de_a.bsp": "a"}, map[string]interface{}{"MIN_FREE_SPACE": "0"})
+	token := uploadToken(t, cs)
+	gen, _ := cs.Manifest.Generation()
+
+	w := upload(cs, token, "de_a.bsp", "a2", sha1Hex("a2"), 2)
+	var up models.Uploaded
+	if err := json.NewDecoder(w.Body).Decode(&up); w.Code != http.StatusOK || err != nil || !up.Replaced {
+		t.Fatal("got: ", w.Code, " ", up, err)
+	}
+	if now, _ := cs.Manifest.Generation(); now != gen+1 || up.Generation != now {
+		t.Error("generation got: ", now, " ", up.Generation, " wanted: ", gen+1)
+	}
+	if hash := cs.Manifest.Files()["de_a.bsp"]; hash != sha1Hex("a2") {
+		t.Error("hash map has: ", hash)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(cs.C.MapPath, "de_a.bsp")); string(b) != "a2" {
+		t.Error("file has: ", string(b))
+	}
+
+	// a new one is created
+	if w = upload(cs, token, "de_b.bsp", "b", sha1Hex("b"), 1); w.Code != http.StatusCreated {
+		t.Error("new file got: ", w.Code)
+	}
+
+	// the password can't upload
+	r := httptest.NewRequest(http.MethodPut, "/files/de_c.bsp", strings.NewReader("c"))
+	r.Header.Set("Pass", testPass)
+	r.Header.Set(HashHeader, sha1Hex("c"))
+	rec := httptest.NewRecorder()
+	cs.Upload(rec, r)
+	if rec.Code != http.StatusForbidden {
+		t.Error("password upload got: ", rec.Code)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/ignore/ignore.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains gitignore style patterns for picking which files in the map directory get
+	synced. The map directory is flat so patterns only ever see file names.
+*/
+
+package ignore
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// File is the name of the ignore file read from the map directory
+const File = ".csgosyncignore"
+
+// builtin are always ignored, our own partial downloads and uploads and the ignore file itself.
+// They're checked on their own so a "!" pattern can't put them back.
+var builtin = []rule{{pattern: "*.tmp"}, {pattern: File}}
+
+// rule is one line of patterns
+type rule struct {
+	pattern string
+	negate  bool // a leading "!" puts back what earlier rules matched
+}
+
+// Matcher decides which files are synced. If it has include patterns a file has to match them,
+// then it's ignored if it matches the exclude patterns. Like .gitignore the last matching rule
+// wins, except nothing can put back the builtin patterns. A nil Matcher ignores nothing.
+type Matcher struct {
+	include []rule
+	exclude []rule
+}
+
+// New returns a matcher for the patterns
+func New(include, exclude []string) (*Matcher, error) {
+	m := new(Matcher)
+	var err error
+	if m.include, err = parse(include); err != nil {
+		return nil, fmt.Errorf("bad include pattern: %w", err)
+	}
+	if m.exclude, err = parse(exclude); err != nil {
+		return nil, fmt.Errorf("bad exclude pattern: %w", err)
+	}
+	return m, nil
+}
+
+// Load returns a matcher for the patterns and the ignore file in dir (if there is one), the ignore
+// file's patterns come after exclude so it can put back files exclude took out
+func Load(dir string, include, exclude []string) (*Matcher, error) {
+	m, err := New(include, exclude)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(dir, File))
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", File, err)
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", File, err)
+	}
+	rules, err := parse(lines)
+	if err != nil {
+		return nil, fmt.Errorf("bad pattern in %s: %w", File, err)
+	}
+	m.exclude = append(m.exclude, rules...)
+	return m, nil
+}
+
+// Ignored reports if the file isn't synced
+func (m *Matcher) Ignored(name string) bool {
+	if m == nil {
+		return false
+	}
+	if matches(builtin, name) {
+		return true
+	}
+	if len(m.include) > 0 && !matches(m.include, name) {
+		return true
+	}
+	return matches(m.exclude, name)
+}
+
+// Filter returns the files that aren't ignored
+func (m *Matcher) Filter(files []string) []string {
+	if m == nil {
+		return files
+	}
+	var kept []string
+	for _, file := range files {
+		if !m.Ignored(file) {
+			kept = append(kept, file)
+		}
+	}
+	return kept
+}
+
+// Patterns is a list of gitignore style patterns on their own, like a group of files
+type Patterns struct {
+	rules []rule
+}
+
+// Compile parses the patterns
+func Compile(patterns []string) (*Patterns, error) {
+	rules, err := parse(patterns)
+	if err != nil {
+		return nil, err
+	}
+	return &Patterns{rules: rules}, nil
+}
+
+// Match reports if the last pattern that matches name isn't negated
+func (p *Patterns) Match(name string) bool {
+	return matches(p.rules, name)
+}
+
+// matches reports if the last rule that matches name isn't negated
+func matches(rules []rule, name string) bool {
+	matched := false
+	for _, r := range rules {
+		if ok, _ := path.Match(r.pattern, name); ok {
+			matched = !r.negate
+		}
+	}
+	return matched
+}
+
+// parse turns lines of a .gitignore into rules. Blank lines and comments are skipped and so are
+// patterns for directories or files in them, they can't match anything in a flat directory.
+func parse(lines []string) ([]rule, error) {
+	var rules []rule
+	for _, line := range lines {
+		line = strings.TrimRight(strings.TrimSuffix(line, "\r"), " ")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		var r rule
+		if line[0] == '!' {
+			r.negate, line = true, line[1:]
+		} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			continue // only matches directories
+		}
+		line = strings.TrimPrefix(line, "/")
+		line = strings.TrimPrefix(line, "**/")
+		if strings.Contains(line, "/") {
+			continue // only matches files in directories
+		}
+		r.pattern = strings.ReplaceAll(line, "**", "*")
+		if r.pattern == "" {
+			continue
+		}
+		if _, err := path.Match(r.pattern, ""); err != nil {
+			return nil, fmt.Errorf("%q: %w", line, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/ignore/ignore_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the ignore module for the csgo sync application.
+*/
+
+package ignore
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIgnored(t *testing.T) {
+	m, err := New(nil, []string{"*.bak", "*.log", "!keep.log", "# comment", "", "/root.txt", "**/deep.txt", "dir/", "dir/file.bsp", `\#hash.txt`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		ignored bool
+	}{
+		{"de_dust2.bsp", false},
+		{"de_dust2.bsp.bak", true},
+		{"console.log", true},
+		{"keep.log", false},
+		{"de_dust2.bsp.tmp", true}, // partial download
+		{File, true},
+		{"root.txt", true},
+		{"deep.txt", true},
+		{"dir", false},
+		{"file.bsp", false},
+		{"#hash.txt", true},
+		{"comment", false},
+	}
+	for _, test := range tests {
+		if got := m.Ignored(test.name); got != test.ignored {
+			t.Error("[", test.name, "] got: ", got, " wanted: ", test.ignored)
+		}
+	}
+}
+
+func TestInclude(t *testing.T) {
+	m, err := New([]string{"*.bsp", "*.nav", "!aim_*"}, []string{"de_old*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := m.Filter([]string{"de_x.bsp", "de_x.nav", "de_x.txt", "aim_x.bsp", "de_old.bsp"})
+	if !reflect.DeepEqual(got, []string{"de_x.bsp", "de_x.nav"}) {
+		t.Error("got: ", got)
+	}
+
+	var none *Matcher
+	if none.Ignored("x.tmp") {
+		t.Error("nil matcher ignored a file")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, File), []byte("# mine\r\n!important.bak\r\nwip_*\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := Load(dir, nil, []string{"*.bak"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := m.Filter([]string{"a.bak", "important.bak", "wip_x.bsp", "de_x.bsp"})
+	if !reflect.DeepEqual(got, []string{"important.bak", "de_x.bsp"}) {
+		t.Error("got: ", got)
+	}
+
+	if _, err := Load(t.TempDir(), nil, nil); err != nil {
+		t.Error("missing ignore file got: ", err)
+	}
+	if _, err := New(nil, []string{"[bad"}); err == nil {
+		t.Error("bad pattern didn't fail")
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	p, err := Compile([]string{"surf_*.bsp", "surf_*.nav", "!surf_old*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"surf_ski.bsp": true, "surf_ski.nav": true, "surf_old.bsp": false, "de_x.bsp": false} {
+		if got := p.Match(name); got != want {
+			t.Error("[", name, "] got: ", got, " wanted: ", want)
+		}
+	}
+}
+
+func TestBuiltinCantBeNegated(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, File), []byte("!*.tmp\n!"+File+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := Load(dir, []string{"*.tmp", "*.bsp", File}, []string{"!de_x.bsp.tmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"de_x.bsp.tmp", "de_x.bsp.123.tmp", File} {
+		if !m.Ignored(name) {
+			t.Error("[", name, "] was put back")
+		}
+	}
+	if m.Ignored("de_x.bsp") {
+		t.Error("de_x.bsp ignored")
+	}
+}
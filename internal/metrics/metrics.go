@@ -0,0 +1,299 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/metrics/metrics.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains counters, gauges and histograms written in the prometheus text format.
+*/
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of what WriteTo writes
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are histogram buckets in seconds good for http requests, up to file downloads
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// Registry is a set of metrics to be scraped
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+// metric is anything the registry can write
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) add(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteTo writes every metric in the prometheus text format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// vec is a metric with a value for every combination of label values
+type vec struct {
+	name, help, kind string
+	labels           []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	values []string // label values
+	value  float64
+	counts []uint64 // histograms, count of observations <= each bucket
+	sum    float64  // histograms
+}
+
+func newVec(name, help, kind string, labels []string) *vec {
+	v := &vec{name: name, help: help, kind: kind, labels: labels, series: make(map[string]*series)}
+	if len(labels) == 0 && kind != "histogram" {
+		v.get(nil) // without labels there's only one series, it starts at 0
+	}
+	return v
+}
+
+// get returns the series for the label values, must hold the lock
+func (v *vec) get(values []string) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// sorted returns the series in order of their label values, must hold the lock
+func (v *vec) sorted() []*series {
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	all := make([]*series, len(keys))
+	for i, key := range keys {
+		all[i] = v.series[key]
+	}
+	return all
+}
+
+func (v *vec) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escape(v.help, false), v.name, v.kind)
+}
+
+func (v *vec) write(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.header(w)
+	for _, s := range v.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, labels(v.labels, s.values, "", ""), format(s.value))
+	}
+}
+
+// CounterVec is a counter for every combination of label values, it only goes up
+type CounterVec struct{ *vec }
+
+// Counter adds a counter to the registry
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(name, help, "counter", labels)}
+	r.add(c)
+	return c
+}
+
+// Add adds n (which can't be negative) to the counter with the label values
+func (c *CounterVec) Add(n float64, values ...string) {
+	if n < 0 {
+		panic("metrics: counters can't go down")
+	}
+	c.mu.Lock()
+	c.get(values).value += n
+	c.mu.Unlock()
+}
+
+// Inc adds one to the counter with the label values
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// GaugeVec is a value for every combination of label values that can go up and down
+type GaugeVec struct{ *vec }
+
+// Gauge adds a gauge to the registry
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newVec(name, help, "gauge", labels)}
+	r.add(g)
+	return g
+}
+
+// Set sets the gauge with the label values
+func (g *GaugeVec) Set(n float64, values ...string) {
+	g.mu.Lock()
+	g.get(values).value = n
+	g.mu.Unlock()
+}
+
+// Add adds n to the gauge with the label values, n can be negative
+func (g *GaugeVec) Add(n float64, values ...string) {
+	g.mu.Lock()
+	g.get(values).value += n
+	g.mu.Unlock()
+}
+
+// gaugeFunc is a gauge whose value is worked out when it's scraped
+type gaugeFunc struct {
+	*vec
+	f func() float64
+}
+
+// GaugeFunc adds a gauge that calls f for its value every time it's scraped
+func (r *Registry) GaugeFunc(name, help string, f func() float64) {
+	r.add(&gaugeFunc{newVec(name, help, "gauge", nil), f})
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	g.header(w)
+	fmt.Fprintf(w, "%s %s\n", g.name, format(g.f()))
+}
+
+// HistogramVec counts observations into buckets for every combination of label values
+type HistogramVec struct {
+	*vec
+	buckets []float64
+}
+
+// Histogram adds a histogram with the upper bounds of its buckets to the registry
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{newVec(name, help, "histogram", labels), buckets}
+	r.add(h)
+	return h
+}
+
+// Observe adds an observation to the histogram with the label values
+func (h *HistogramVec) Observe(n float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.get(values)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets)+1) // last is +Inf
+	}
+	for i, bound := range h.buckets {
+		if n <= bound {
+			s.counts[i]++
+		}
+	}
+	s.counts[len(h.buckets)]++
+	s.sum += n
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w)
+	for _, s := range h.sorted() {
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels(h.labels, s.values, "le", format(bound)), s.counts[i])
+		}
+		count := s.counts[len(h.buckets)]
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels(h.labels, s.values, "le", "+Inf"), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels(h.labels, s.values, "", ""), format(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels(h.labels, s.values, "", ""), count)
+	}
+}
+
+// labels formats the labels like {a="1",b="2"} with an extra label on the end if extra isn't empty
+func labels(names, values []string, extra, extraValue string) string {
+	if len(names) == 0 && extra == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", name, escape(values[i], true))
+	}
+	if extra != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", extra, extraValue)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// escape escapes backslashes and newlines, and double quotes in label values
+func escape(s string, quotes bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if quotes {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+	return s
+}
+
+// format formats a value the way prometheus reads it
+func format(n float64) string {
+	switch {
+	case math.IsInf(n, 1):
+		return "+Inf"
+	case math.IsInf(n, -1):
+		return "-Inf"
+	case math.IsNaN(n):
+		return "NaN"
+	}
+	return strconv.FormatFloat(n, 'g', -1, 64)
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/metrics/metrics_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the metrics module for the csgo sync application.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.Counter("requests_total", "Requests by route.", "route", "status")
+	active := r.Gauge("active", "Things going on\nright now.")
+	latency := r.Histogram("latency_seconds", "Latency.", []float64{1, 0.5}, "route")
+	r.GaugeFunc("files", "Files.", func() float64 { return 42 })
+
+	requests.Inc("/maps/", "200")
+	requests.Add(2, "/maps/", "200")
+	requests.Inc(`/a"b\c`, "404")
+	active.Add(2)
+	active.Add(-1)
+	latency.Observe(0.25, "/maps/")
+	latency.Observe(0.75, "/maps/")
+	latency.Observe(3, "/maps/")
+
+	want := `# HELP requests_total Requests by route.
+# TYPE requests_total counter
+requests_total{route="/a\"b\\c",status="404"} 1
+requests_total{route="/maps/",status="200"} 3
+# HELP active Things going on\nright now.
+# TYPE active gauge
+active 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/maps/",le="0.5"} 1
+latency_seconds_bucket{route="/maps/",le="1"} 2
+latency_seconds_bucket{route="/maps/",le="+Inf"} 3
+latency_seconds_sum{route="/maps/"} 4
+latency_seconds_count{route="/maps/"} 3
+# HELP files Files.
+# TYPE files gauge
+files 42
+`
+	var buf bytes.Buffer
+	n, err := r.WriteTo(&buf)
+	if err != nil {
+		t.Fatal("failed to write metrics: ", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Error("wrote ", buf.Len(), " bytes, said ", n)
+	}
+	if buf.String() != want {
+		t.Error("got:\n", buf.String(), "\nwanted:\n", want)
+	}
+}
+
+func TestLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("wrong number of label values didn't panic")
+		}
+	}()
+	NewRegistry().Counter("c", "c", "a", "b").Inc("only one")
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/models/admin.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the json models for the admin endpoints.
+*/
+
+package models
+
+import "time"
+
+// FirewallStatus is how the server's firewall is set up and who it's keeping out
+type FirewallStatus struct {
+	Allow         []string       `json:"allow"` // only these cidrs can connect, empty is everyone
+	Deny          []string       `json:"deny"`
+	RequestRate   float64        `json:"request_rate"` // requests per second per ip, 0 is unlimited
+	RequestBurst  int            `json:"request_burst"`
+	MaxFailures   int            `json:"max_auth_failures"` // failed logins before a ban, 0 never bans
+	FailureWindow string         `json:"auth_failure_window"`
+	BanTime       string         `json:"ban_time"`
+	Bans          []Ban          `json:"bans"`
+	Failures      map[string]int `json:"failures"` // failed logins of ips that aren't banned (yet)
+}
+
+// Ban is an ip that failed to log in too many times
+type Ban struct {
+	IP    string    `json:"ip"`
+	Until time.Time `json:"until"`
+}
+
+// Token scopes, what a token is allowed to do
+const (
+	ScopeSync   = "sync"   // sync and download files like the password
+	ScopeUpload = "upload" // upload files, the password can't
+)
+
+// Token is an api token that can be used instead of the password, the secret is only ever
+// shown when it's created
+type Token struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Scopes   []string  `json:"scopes"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"last_used"` // zero if not used since the server started
+}
+
+// Has returns whether the token has the scope
+func (t Token) Has(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// NewToken asks the server for a token
+type NewToken struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// CreatedToken is the new token with its secret, the only time the secret is sent
+type CreatedToken struct {
+	Token
+	Secret string `json:"secret"`
+}
+
+// Transfer is a download in progress
+type Transfer struct {
+	RequestID string    `json:"request_id"`
+	IP        string    `json:"ip"`
+	User      string    `json:"user,omitempty"`
+	Route     string    `json:"route,omitempty"`
+	File      string    `json:"file"`
+	Started   time.Time `json:"started"`
+	Bytes     int64     `json:"bytes"` // sent so far
+}
+
+// Refresh is one regeneration of the hash map
+type Refresh struct {
+	Time       time.Time `json:"time"`
+	Duration   float64   `json:"duration"` // seconds
+	Files      int       `json:"files"`
+	Generation uint64    `json:"generation"`
+	Changed    bool      `json:"changed"`
+	Errors     []string  `json:"errors,omitempty"` // files that couldn't be hashed, the refresh failed
+}
+
+// ManifestFile is a file in the hash map
+type ManifestFile struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Hash     string    `json:"hash"`
+	Modified time.Time `json:"modified"`
+}
+
+// AdminStatus is everything the dashboard shows
+type AdminStatus struct {
+	Version    string               `json:"version"`
+	Uptime     float64              `json:"uptime"` // seconds
+	Generation uint64               `json:"generation"`
+	Updated    time.Time            `json:"updated"` // when the hash map was last generated
+	Files      []ManifestFile       `json:"files"`
+	Retired    map[string]Tombstone `json:"retired"` // files that were deleted
+	Syncs      []AccessEntry        `json:"syncs"`   // recent hash map requests from clients, newest first
+	Transfers  []Transfer           `json:"transfers"`
+	Refreshes  []Refresh            `json:"refreshes"` // newest first
+	Firewall   FirewallStatus       `json:"firewall"`
+	Tokens     []Token              `json:"tokens"`
+}
+
+// AccessEntry is a request from the access log
+type AccessEntry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	IP        string    `json:"ip"`
+	User      string    `json:"user,omitempty"`
+	Library   string    `json:"library,omitempty"` // library it synced, empty for MAP_PATH
+	Status    int       `json:"status"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
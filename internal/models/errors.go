@@ -0,0 +1,45 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/models/errors.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the json model of errors the server sends back.
+*/
+
+package models
+
+import "fmt"
+
+// Error codes, these don't change so programs can check them instead of the message
+const (
+	ErrCodeBadRequest       = "bad_request"        // the request body couldn't be read or parsed
+	ErrCodeUnauthorized     = "unauthorized"       // missing or wrong password
+	ErrCodeForbidden        = "forbidden"          // the ip isn't allowed to connect
+	ErrCodeBanned           = "banned"             // the ip failed to log in too many times, see Retry-After
+	ErrCodeRateLimited      = "rate_limited"       // the ip made too many requests, see Retry-After
+	ErrCodeNotFound         = "not_found"          // no such endpoint or file
+	ErrCodeMethodNotAllowed = "method_not_allowed" // endpoint doesn't take that method
+	ErrCodeTooLarge         = "too_large"          // the upload is bigger than the server takes
+	ErrCodeUnsupportedType  = "unsupported_type"   // the server doesn't take uploads with that extension
+	ErrCodeHashMismatch     = "hash_mismatch"      // the upload didn't match the hash it was sent with
+	ErrCodeNoSpace          = "no_space"           // the server's disk is too full for the upload
+	ErrCodeUnavailable      = "unavailable"        // the server isn't ready yet, try again later
+	ErrCodeOutdated         = "outdated"           // the client hashes files differently, update it
+	ErrCodeInternal         = "internal_error"     // something went wrong on the server, see its log
+)
+
+// Error is the body of every error response from the server
+type Error struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"` // find the request in the server's log with this
+}
+
+func (e *Error) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("%s: %s (request %s)", e.Code, e.Message, e.RequestID)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
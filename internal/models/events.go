@@ -0,0 +1,79 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/models/events.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the json models for the client's machine readable output.
+*/
+
+package models
+
+import "time"
+
+// Types of events the client emits while syncing
+const (
+	EventHashStart    = "hash_start"    // started hashing the local map directory
+	EventHashDone     = "hash_done"     // finished hashing the local map directory
+	EventDiff         = "diff"          // server responded with the files we need
+	EventFileStart    = "file_start"    // started downloading a file
+	EventFileProgress = "file_progress" // more bytes of a file were downloaded
+	EventFileDone     = "file_done"     // file was downloaded and moved into place
+	EventFileFailed   = "file_failed"   // file failed to download (or upload)
+	EventFileUploaded = "file_uploaded" // file was uploaded and the server added it to its maps
+	EventFileRetired  = "file_retired"  // server deleted the file so it was archived or removed here
+	EventConflict     = "conflict"      // file changed here and on the server since the last two way sync
+	EventBackup       = "backup"        // a backup of the files a sync replaced, from csgosync restore
+	EventFileRestored = "file_restored" // file was put back from a backup
+	EventGroup        = "group"         // a group of the server's files, from csgosync groups
+	EventSummary      = "summary"       // sync run is finished
+)
+
+// Event is a single line of the client's json output
+type Event struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Dir      string    `json:"dir,omitempty"`     // directory being hashed
+	File     string    `json:"file,omitempty"`    // file the event is about
+	Files    []string  `json:"files,omitempty"`   // files the server says we need
+	Count    int       `json:"count"`             // number of files hashed or in the diff
+	Bytes    int64     `json:"bytes,omitempty"`   // bytes downloaded so far
+	Total    int64     `json:"total,omitempty"`   // total size of the file if the server told us
+	Elapsed  float64   `json:"elapsed,omitempty"` // seconds the step took
+	Error    string    `json:"error,omitempty"`
+	Backup   string    `json:"backup,omitempty"` // id of the backup the event is about
+	Conflict *Conflict `json:"conflict,omitempty"`
+	Group    *Group    `json:"group,omitempty"`
+	Summary  *Summary  `json:"summary,omitempty"`
+}
+
+// Summary contains the totals for a sync run
+type Summary struct {
+	Needed      int      `json:"needed"`                 // files the server said we needed
+	Downloaded  int      `json:"downloaded"`             // files successfully downloaded
+	Uploaded    int      `json:"uploaded,omitempty"`     // files uploaded by a two way sync
+	Conflicts   int      `json:"conflicts,omitempty"`    // files that changed here and on the server
+	Failed      int      `json:"failed"`                 // files that failed to download (or upload)
+	FailedFiles []string `json:"failed_files,omitempty"` // names of the files that failed
+	Bytes       int64    `json:"bytes"`                  // bytes downloaded
+	Generation  uint64   `json:"generation,omitempty"`   // generation of the server's files we synced with
+}
+
+// How two way syncs settle conflicts
+const (
+	PolicyServerWins = "server-wins" // download the server's copy over ours
+	PolicyClientWins = "client-wins" // upload our copy over the server's
+	PolicyKeepBoth   = "keep-both"   // rename our copy and upload it, then download the server's
+	Unresolved       = "unresolved"  // keep-both couldn't rename our copy so it was left alone
+)
+
+// Conflict is a file that changed here and on the server since the last two way sync
+type Conflict struct {
+	File       string `json:"file"`
+	Local      string `json:"local"`          // hash of our copy
+	Server     string `json:"server"`         // hash of the server's copy
+	Base       string `json:"base,omitempty"` // hash both had at the last sync, empty if neither had it
+	Resolution string `json:"resolution"`     // the policy that settled it
+	Kept       string `json:"kept,omitempty"` // what our copy was renamed to with keep-both
+}
@@ -10,12 +10,88 @@
 
 package models
 
+import "time"
+
 // Response contains the server response code and the list of files that are different
 type FileResponse struct {
-	Files []string `json:"files"`
+	Files      []string             `json:"files"`
+	Hashes     map[string]string    `json:"hashes,omitempty"`     // hashes of the files so downloads can be checked
+	Sizes      map[string]int64     `json:"sizes,omitempty"`      // sizes of the files
+	Generation uint64               `json:"generation,omitempty"` // generation of the server's files the list came from
+	Extra      []string             `json:"extra,omitempty"`      // files the client has that the server doesn't
+	Retired    map[string]Tombstone `json:"retired,omitempty"`    // files the client has that the server deleted
+}
+
+// Tombstone is a file the server deleted
+type Tombstone struct {
+	Hash    string    `json:"hash"` // hash of the file before it was deleted
+	Deleted time.Time `json:"deleted"`
 }
 
 // ClientFileHashMap contains the map of files with the value being the hash of the files
 type FileHashMap struct {
-	Files map[string]string `json:"files"`
+	Files  map[string]string `json:"files"`
+	Groups []string          `json:"groups,omitempty"` // only sync the server's files in these groups, empty is all of them
+}
+
+// Group is a named set of the server's files clients can subscribe to instead of syncing everything
+type Group struct {
+	Name     string   `json:"name"`
+	Patterns []string `json:"patterns"` // gitignore style patterns of the files in the group
+	Files    []string `json:"files"`    // the server's files in the group right now
+	Size     int64    `json:"size"`     // total size of the files
+}
+
+// GroupList is what GET /v1/groups answers with
+type GroupList struct {
+	Groups []Group `json:"groups"`
+}
+
+// ManifestEvent is sent to clients listening on the event stream when the server's files change
+type ManifestEvent struct {
+	Generation uint64 `json:"generation"` // bumped every time the server's list of files changes
+	Files      int    `json:"files"`      // number of files the server has
+}
+
+// DeltaRequest is sent by the client with the signatures of every block of its old copy of a
+// file so the server only has to send the parts that changed
+type DeltaRequest struct {
+	BlockSize int              `json:"block_size"`
+	Size      int64            `json:"size"` // size of the client's copy, the last block can be short
+	Blocks    []BlockSignature `json:"blocks"`
+}
+
+// BlockSignature is the rolling (weak) and strong checksum of a block of a file
+type BlockSignature struct {
+	Weak   uint32 `json:"weak"`
+	Strong string `json:"strong"`
+}
+
+// ChunkList is the chunked manifest of a file, the file is the chunks one after another
+type ChunkList struct {
+	File   string  `json:"file"`
+	Hash   string  `json:"hash"` // hash of the whole file like in the hash map
+	Size   int64   `json:"size"`
+	Chunks []Chunk `json:"chunks"`
+}
+
+// Chunk is a piece of a file, named by the sha1 of its bytes
+type Chunk struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+// BundleRequest asks the server for a tar of many files at once
+type BundleRequest struct {
+	Files    []string `json:"files"`
+	Compress string   `json:"compress,omitempty"` // "gzip" for a .tar.gz, empty for a plain tar
+}
+
+// Uploaded is the file the server got from an upload
+type Uploaded struct {
+	File       string `json:"file"`
+	Size       int64  `json:"size"`
+	Hash       string `json:"hash"`
+	Replaced   bool   `json:"replaced"`   // there was already a file with the name
+	Generation uint64 `json:"generation"` // generation of the hash map with the file in it
 }
@@ -0,0 +1,31 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/models/health.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the json models for the health and readiness endpoints.
+*/
+
+package models
+
+// Health statuses
+const (
+	HealthOK          = "ok"
+	HealthUnavailable = "unavailable"
+)
+
+// Health is the answer to /healthz and /readyz
+type Health struct {
+	Status  string           `json:"status"` // ok if every check passed
+	Version string           `json:"version"`
+	Uptime  float64          `json:"uptime"` // seconds since the server started
+	Checks  map[string]Check `json:"checks,omitempty"`
+}
+
+// Check is one of the things /readyz looks at
+type Check struct {
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
@@ -0,0 +1,42 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/models/info.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the json model the server describes itself with.
+*/
+
+package models
+
+// Auth schemes the server can accept
+const (
+	AuthPass   = "pass"   // the password in the "pass" header
+	AuthBearer = "bearer" // an api token as a bearer token (or in the "pass" header)
+)
+
+// Optional features of the server, clients only use the ones the server lists
+const (
+	FeatureEvents = "events" // GET /v1/events server sent events
+	FeatureDelta  = "delta"  // POST /v1/delta/<file> block delta downloads
+	FeatureChunks = "chunks" // GET /v1/chunks/<file> and /v1/chunk/<hash> chunked downloads
+	FeatureBundle = "bundle" // POST /v1/bundle tar downloads
+	FeatureFastDL = "fastdl" // bzip2 mirror at /fastdl/maps/
+	FeatureUpload = "upload" // PUT /v1/files/<file> uploads with an upload token
+	FeatureGroups = "groups" // GET /v1/groups and syncing only some groups of files
+
+	FeatureLibraries = "libraries" // other directories at /v1/libraries/<name>/
+)
+
+// Info is what GET /v1/info answers with so clients can tell what the server supports
+type Info struct {
+	Version        string   `json:"version"`             // version of csgosync the server is running
+	Protocols      []int    `json:"protocols"`           // protocol versions the server speaks
+	HashAlgorithms []string `json:"hash_algorithms"`     // algorithms the file hashes can be in
+	Compression    []string `json:"compression"`         // Content-Encodings maps can be sent with
+	Auth           []string `json:"auth"`                // ways to send credentials
+	Features       []string `json:"features"`            // optional endpoints the server has
+	Library        string   `json:"library,omitempty"`   // name of the library this is the info of
+	Libraries      []string `json:"libraries,omitempty"` // the server's other libraries
+}
@@ -0,0 +1,164 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/output/output.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the client's output writer which can print human readable text or json events.
+*/
+
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+// Valid values for the output format
+const (
+	Text = "text"
+	Json = "json"
+)
+
+// Logger is where human readable text goes when the client runs as a daemon
+type Logger interface {
+	Simple(msg string)
+}
+
+// Output writes the client's messages and events. In json mode events are written to stdout as
+// newline delimited json and all human text goes to stderr so it doesn't get mixed in.
+type Output struct {
+	json  bool
+	mu    sync.Mutex // downloads run in their own go routines
+	human io.Writer  // where human readable text goes
+	log   Logger     // if set human readable text goes here instead
+	enc   *json.Encoder
+}
+
+// New returns an Output for the format ("text" or "json")
+func New(format string) (*Output, error) {
+	switch format {
+	case Text, "":
+		return &Output{human: os.Stdout}, nil
+	case Json:
+		return &Output{
+			json:  true,
+			human: os.Stderr,
+			enc:   json.NewEncoder(os.Stdout),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format: %q (valid formats are %q and %q)", format, Text, Json)
+	}
+}
+
+// Json reports if we are writing json events
+func (o *Output) Json() bool {
+	return o.json
+}
+
+// Human returns the writer that human readable text should go to
+func (o *Output) Human() io.Writer {
+	return o.human
+}
+
+// SetLogger sends all human readable text to the logger instead of stdout/stderr
+func (o *Output) SetLogger(l Logger) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.log = l
+}
+
+// Println writes human readable text
+func (o *Output) Println(a ...interface{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.log != nil {
+		o.log.Simple(strings.TrimSuffix(fmt.Sprintln(a...), "\n"))
+		return
+	}
+	_, _ = fmt.Fprintln(o.human, a...)
+}
+
+// Printf writes formatted human readable text
+func (o *Output) Printf(format string, a ...interface{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.log != nil {
+		o.log.Simple(strings.TrimSuffix(fmt.Sprintf(format, a...), "\n"))
+		return
+	}
+	_, _ = fmt.Fprintf(o.human, format, a...)
+}
+
+// Emit writes the event as json, or as the matching human readable text in text mode
+func (o *Output) Emit(e models.Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if o.json {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		if err := o.enc.Encode(e); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "failed to write event:", err)
+		}
+		return
+	}
+	switch e.Type {
+	case models.EventHashStart:
+		o.Println("generating hash map...")
+	case models.EventHashDone:
+		o.Printf("hashed %d files in %.2fs\n", e.Count, e.Elapsed)
+	case models.EventDiff:
+		if e.Count == 0 {
+			o.Println("nothing to do, already have server's maps")
+		} else {
+			o.Printf("downloading %d files from server...\n", e.Count)
+		}
+	case models.EventFileDone:
+		o.Printf("file: %s downloaded\n", e.File)
+	case models.EventFileUploaded:
+		o.Printf("file: %s uploaded (%d bytes)\n", e.File, e.Bytes)
+	case models.EventFileFailed:
+		o.Printf("file: %s failed: %s\n", e.File, e.Error)
+	case models.EventFileRetired:
+		o.Printf("file: %s was retired by the server\n", e.File)
+	case models.EventBackup:
+		o.Printf("backup: %s has %d files: %s\n", e.Backup, len(e.Files), strings.Join(e.Files, ", "))
+	case models.EventFileRestored:
+		o.Printf("file: %s restored from backup %s\n", e.File, e.Backup)
+	case models.EventGroup:
+		if g := e.Group; g != nil {
+			o.Printf("group: %s has %d files (%d bytes): %s\n", g.Name, len(g.Files), g.Size, strings.Join(g.Patterns, " "))
+		}
+	case models.EventConflict:
+		if c := e.Conflict; c != nil {
+			switch c.Resolution {
+			case models.PolicyServerWins:
+				o.Printf("conflict: %s changed here and on the server, downloading the server's copy\n", c.File)
+			case models.PolicyClientWins:
+				o.Printf("conflict: %s changed here and on the server, uploading ours\n", c.File)
+			case models.PolicyKeepBoth:
+				o.Printf("conflict: %s changed here and on the server, keeping ours as %s and downloading the server's\n", c.File, c.Kept)
+			default:
+				o.Printf("conflict: %s changed here and on the server, left alone\n", c.File)
+			}
+		}
+	case models.EventSummary:
+		if e.Summary != nil && e.Summary.Needed > 0 {
+			o.Printf("downloaded %d of %d files (%d bytes), %d failed\n",
+				e.Summary.Downloaded, e.Summary.Needed, e.Summary.Bytes, e.Summary.Failed)
+		}
+		if e.Summary != nil && (e.Summary.Uploaded > 0 || e.Summary.Conflicts > 0) {
+			o.Printf("uploaded %d files, %d conflicts\n", e.Summary.Uploaded, e.Summary.Conflicts)
+		}
+	}
+	// file_start and file_progress are too noisy for a terminal
+}
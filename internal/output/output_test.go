@@ -0,0 +1,185 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/output/output_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the client's output writer.
+*/
+
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+// newTestOutput returns an Output for the format that writes to buffers instead of stdout/stderr
+func newTestOutput(t *testing.T, format string) (o *Output, events, human *bytes.Buffer) {
+	t.Helper()
+	o, err := New(format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, human = new(bytes.Buffer), new(bytes.Buffer)
+	o.human = human
+	if o.enc != nil {
+		o.enc = json.NewEncoder(events)
+	}
+	return o, events, human
+}
+
+// testEvents is one of every event the client emits
+var testEvents = []models.Event{
+	{Type: models.EventHashStart, Dir: "/maps"},
+	{Type: models.EventHashDone, Count: 0, Elapsed: 1.5},
+	{Type: models.EventDiff, Count: 0},
+	{Type: models.EventDiff, Count: 2, Files: []string{"de_a.bsp", "de_b.bsp"}},
+	{Type: models.EventFileStart, File: "de_a.bsp", Total: 10},
+	{Type: models.EventFileProgress, File: "de_a.bsp", Bytes: 5, Total: 10},
+	{Type: models.EventFileDone, File: "de_a.bsp", Bytes: 10},
+	{Type: models.EventFileFailed, File: "de_b.bsp", Error: "hash mismatch"},
+	{Type: models.EventFileUploaded, File: "de_c.bsp", Bytes: 3},
+	{Type: models.EventFileRetired, File: "de_d.bsp"},
+	{Type: models.EventConflict, Conflict: &models.Conflict{File: "de_e.bsp", Resolution: models.PolicyKeepBoth, Kept: "de_e.conflict.bsp"}},
+	{Type: models.EventBackup, Backup: "20201019", Files: []string{"de_a.bsp"}},
+	{Type: models.EventFileRestored, File: "de_a.bsp", Backup: "20201019"},
+	{Type: models.EventGroup, Group: &models.Group{Name: "aim", Patterns: []string{"aim_*"}, Files: []string{"aim_a.bsp"}, Size: 7}},
+	{Type: models.EventSummary, Summary: &models.Summary{Needed: 2, Downloaded: 1, Failed: 1, Bytes: 10}},
+}
+
+func TestJsonEvents(t *testing.T) {
+	o, events, human := newTestOutput(t, Json)
+	if !o.Json() {
+		t.Fatal("json output isn't json")
+	}
+	now := time.Date(2020, 10, 19, 12, 0, 0, 0, time.UTC)
+	for _, e := range testEvents {
+		e.Time = now
+		o.Emit(e)
+	}
+	o.Emit(models.Event{Type: models.EventHashStart}) // the time is filled in
+
+	// one event per line, each a json object with the fields that are set
+	want := [][]string{
+		{"dir"},
+		{"elapsed"},
+		{},
+		{"files"},
+		{"file", "total"},
+		{"file", "bytes", "total"},
+		{"file", "bytes"},
+		{"file", "error"},
+		{"file", "bytes"},
+		{"file"},
+		{"conflict"},
+		{"backup", "files"},
+		{"file", "backup"},
+		{"group"},
+		{"summary"},
+		{},
+	}
+	lines := strings.Split(events.String(), "\n")
+	if len(lines) != len(want)+1 || lines[len(lines)-1] != "" {
+		t.Fatal("got ", len(lines), " lines: ", events.String())
+	}
+	for i, line := range lines[:len(want)] {
+		var got map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Error("[", line, "] got: ", err)
+			continue
+		}
+		keys := append([]string{"type", "time", "count"}, want[i]...)
+		sort.Strings(keys)
+		var gotKeys []string
+		for key := range got {
+			gotKeys = append(gotKeys, key)
+		}
+		sort.Strings(gotKeys)
+		if !reflect.DeepEqual(gotKeys, keys) {
+			t.Error("[", line, "] got: ", gotKeys, " wanted: ", keys)
+		}
+		if i < len(testEvents) {
+			if got["type"] != testEvents[i].Type || got["time"] != "2020-10-19T12:00:00Z" || got["count"] != float64(testEvents[i].Count) {
+				t.Error("[", line, "] got type: ", got["type"], " time: ", got["time"], " count: ", got["count"])
+			}
+		} else if ts, _ := got["time"].(string); strings.HasPrefix(ts, "0001") {
+			t.Error("[", line, "] time wasn't filled in")
+		}
+	}
+
+	// human text goes to stderr so it doesn't get mixed in with the events
+	written := events.Len()
+	o.Println("generating hash map...")
+	o.Printf("downloading %d files from server...\n", 2)
+	if human.String() != "generating hash map...\ndownloading 2 files from server...\n" || events.Len() != written {
+		t.Error("got human: ", human.String(), " events: ", events.String())
+	}
+}
+
+func TestTextEvents(t *testing.T) {
+	o, events, human := newTestOutput(t, Text)
+	if o.Json() {
+		t.Fatal("text output is json")
+	}
+	for _, e := range testEvents {
+		o.Emit(e)
+	}
+	// the same text the client printed before there were events, file_start and file_progress
+	// don't print anything
+	want := "generating hash map...\n" +
+		"hashed 0 files in 1.50s\n" +
+		"nothing to do, already have server's maps\n" +
+		"downloading 2 files from server...\n" +
+		"file: de_a.bsp downloaded\n" +
+		"file: de_b.bsp failed: hash mismatch\n" +
+		"file: de_c.bsp uploaded (3 bytes)\n" +
+		"file: de_d.bsp was retired by the server\n" +
+		"conflict: de_e.bsp changed here and on the server, keeping ours as de_e.conflict.bsp and downloading the server's\n" +
+		"backup: 20201019 has 1 files: de_a.bsp\n" +
+		"file: de_a.bsp restored from backup 20201019\n" +
+		"group: aim has 1 files (7 bytes): aim_*\n" +
+		"downloaded 1 of 2 files (10 bytes), 1 failed\n"
+	if human.String() != want {
+		t.Error("got: ", human.String(), " wanted: ", want)
+	}
+	if events.Len() != 0 {
+		t.Error("text mode wrote events: ", events.String())
+	}
+}
+
+// testLogger keeps what was logged
+type testLogger struct{ msgs []string }
+
+func (l *testLogger) Simple(msg string) { l.msgs = append(l.msgs, msg) }
+
+func TestLogger(t *testing.T) {
+	o, _, human := newTestOutput(t, Text)
+	l := &testLogger{}
+	o.SetLogger(l)
+	o.Emit(models.Event{Type: models.EventDiff, Count: 2})
+	o.Println("sending hashmap to server")
+	want := []string{"downloading 2 files from server...", "sending hashmap to server"}
+	if !reflect.DeepEqual(l.msgs, want) || human.Len() != 0 {
+		t.Error("got logged: ", l.msgs, " printed: ", human.String(), " wanted: ", want)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for format, isJson := range map[string]bool{"": false, Text: false, Json: true} {
+		if o, err := New(format); err != nil || o.Json() != isJson {
+			t.Error("[", format, "] got: ", o, err)
+		}
+	}
+	if _, err := New("xml"); err == nil {
+		t.Error("[ xml ] expected an error")
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/ratelimit/ratelimit.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains a token bucket for limiting bandwidth for the csgo sync application.
+*/
+
+package ratelimit
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kthomas422/csgosync/internal/disk"
+)
+
+// MinBurst is the smallest burst a bucket will have, one io.Copy buffer worth of bytes
+const MinBurst = 32 * 1024
+
+// Bucket is a token bucket where the tokens are bytes. It fills up at rate bytes per second and
+// holds at most burst bytes. A nil bucket is unlimited.
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens added per second
+	burst  float64 // most tokens the bucket can hold
+	tokens float64 // can go negative when a caller takes more than there is, they wait it off
+	last   time.Time
+}
+
+// NewBucket returns a bucket limited to rate bytes per second, or nil (unlimited) if rate isn't
+// positive. If burst isn't positive it's one second worth of bytes, and it's never less than
+// MinBurst. The bucket starts full.
+func NewBucket(rate, burst int64) *Bucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	if burst < MinBurst {
+		burst = MinBurst
+	}
+	return &Bucket{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst), // start full so small transfers aren't slowed down
+		last:   time.Now(),
+	}
+}
+
+// Burst returns the most bytes the bucket hands out at once
+func (b *Bucket) Burst() int {
+	if b == nil {
+		return 0
+	}
+	return int(b.burst)
+}
+
+// reserve takes n tokens and returns how long the caller has to wait before using them
+func (b *Bucket) reserve(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Wait blocks until n bytes can be sent
+func (b *Bucket) Wait(n int) {
+	if b == nil || n <= 0 {
+		return
+	}
+	if d := b.reserve(n); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// chunkSize returns the biggest piece of a read or write that fits in all the buckets
+func chunkSize(buckets []*Bucket) int {
+	size := 0
+	for _, b := range buckets {
+		if b != nil && (size == 0 || b.Burst() < size) {
+			size = b.Burst()
+		}
+	}
+	return size
+}
+
+// limited drops the nil (unlimited) buckets
+func limited(buckets []*Bucket) []*Bucket {
+	var l []*Bucket
+	for _, b := range buckets {
+		if b != nil {
+			l = append(l, b)
+		}
+	}
+	return l
+}
+
+type writer struct {
+	w       io.Writer
+	buckets []*Bucket
+	chunk   int
+}
+
+// Writer returns a writer that waits on every bucket before writing. If all the buckets are
+// unlimited the writer is returned as is.
+func Writer(w io.Writer, buckets ...*Bucket) io.Writer {
+	buckets = limited(buckets)
+	if len(buckets) == 0 {
+		return w
+	}
+	return &writer{w: w, buckets: buckets, chunk: chunkSize(buckets)}
+}
+
+func (lw *writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > lw.chunk {
+			n = lw.chunk
+		}
+		for _, b := range lw.buckets {
+			b.Wait(n)
+		}
+		n, err := lw.w.Write(p[:n])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+type reader struct {
+	r       io.Reader
+	buckets []*Bucket
+	chunk   int
+}
+
+// Reader returns a reader that waits on every bucket for the bytes it read. If all the buckets
+// are unlimited the reader is returned as is.
+func Reader(r io.Reader, buckets ...*Bucket) io.Reader {
+	buckets = limited(buckets)
+	if len(buckets) == 0 {
+		return r
+	}
+	return &reader{r: r, buckets: buckets, chunk: chunkSize(buckets)}
+}
+
+func (lr *reader) Read(p []byte) (int, error) {
+	if len(p) > lr.chunk {
+		p = p[:lr.chunk]
+	}
+	n, err := lr.r.Read(p)
+	for _, b := range lr.buckets {
+		b.Wait(n)
+	}
+	return n, err
+}
+
+// ParseRate parses a number of bytes like "500KB", "10MiB" or "1048576" (see disk.ParseSize). A
+// trailing "/s" is ignored. Empty or "0" is unlimited.
+func ParseRate(s string) (int64, error) {
+	rate, err := disk.ParseSize(strings.TrimSuffix(strings.TrimSpace(s), "/s"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate: %q", s)
+	}
+	return rate, nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/ratelimit/ratelimit_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the ratelimit module for the csgo sync application.
+*/
+
+package ratelimit
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := map[string]int64{
+		"":         0,
+		"0":        0,
+		"1048576":  1048576,
+		"500KB":    500000,
+		"500kb/s":  500000,
+		"10MiB":    10 << 20,
+		"1.5 MB":   1500000,
+		"2G":       2000000000,
+		"128 KiB":  128 << 10,
+		"100B":     100,
+		" 64KiB/s": 64 << 10,
+	}
+	for in, want := range tests {
+		got, err := ParseRate(in)
+		if err != nil {
+			t.Error("[", in, "] unexpected error: ", err)
+		} else if got != want {
+			t.Error("[", in, "] got: ", got, " wanted: ", want)
+		}
+	}
+	for _, in := range []string{"fast", "-5MB", "MB"} {
+		if _, err := ParseRate(in); err == nil {
+			t.Error("[", in, "] expected an error")
+		}
+	}
+}
+
+func TestNilBucketIsUnlimited(t *testing.T) {
+	if b := NewBucket(0, 0); b != nil {
+		t.Fatal("expected a nil bucket for a zero rate")
+	}
+	var buf bytes.Buffer
+	if w := Writer(&buf, nil, nil); w != io.Writer(&buf) {
+		t.Error("expected the writer to be returned as is")
+	}
+}
+
+func TestBurstDefaults(t *testing.T) {
+	if b := NewBucket(1<<20, 0); b.Burst() != 1<<20 {
+		t.Error("burst should default to the rate, got: ", b.Burst())
+	}
+	if b := NewBucket(1, 1); b.Burst() != MinBurst {
+		t.Error("burst should be at least MinBurst, got: ", b.Burst())
+	}
+}
+
+func TestReaderIsLimited(t *testing.T) {
+	const rate = MinBurst * 4 // bytes per second
+	data := make([]byte, MinBurst*6)
+	start := time.Now()
+	// the bucket starts full (one burst) so the other 5 bursts take 1.25 seconds
+	n, err := io.Copy(ioutil.Discard, Reader(bytes.NewReader(data), NewBucket(rate, MinBurst)))
+	elapsed := time.Since(start)
+	if err != nil || n != int64(len(data)) {
+		t.Fatal("copy failed: ", n, err)
+	}
+	if elapsed < time.Second || elapsed > time.Second*3 {
+		t.Error("expected the copy to take about 1.25s, took: ", elapsed)
+	}
+}
+
+func TestWriterSplitsLargeWrites(t *testing.T) {
+	var buf bytes.Buffer
+	data := bytes.Repeat([]byte("x"), MinBurst*2+10)
+	n, err := Writer(&buf, NewBucket(MinBurst*100, MinBurst)).Write(data)
+	if err != nil || n != len(data) || !bytes.Equal(buf.Bytes(), data) {
+		t.Error("write mismatch: ", n, err)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/tokens/tokens.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains api tokens that can be handed out instead of the password.
+*/
+
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+// Prefix starts every token so they're easy to spot (and to tell apart from passwords)
+const Prefix = "csgo_"
+
+// ErrNoName is returned when creating a token without a name
+var ErrNoName = errors.New("token needs a name")
+
+// stored is a token as it's saved, only the hash of the secret is kept
+type stored struct {
+	models.Token
+	Hash string `json:"hash"` // sha256 of the secret
+}
+
+// Store keeps the tokens, saved to a json file so they survive restarts
+type Store struct {
+	mu     sync.Mutex
+	path   string // empty keeps them in memory only
+	tokens []*stored
+}
+
+// Open loads the tokens saved at path, a missing file is no tokens yet. An empty path keeps
+// the tokens in memory.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path}
+	if path == "" {
+		return s, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokens: %w", err)
+	}
+	if err = json.Unmarshal(data, &s.tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse tokens in %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Create makes a new token with the scopes and returns its secret, which isn't kept anywhere
+// so it can only be shown this once
+func (s *Store) Create(name string, scopes []string) (string, models.Token, error) {
+	if name == "" {
+		return "", models.Token{}, ErrNoName
+	}
+	id, err := random(4)
+	if err != nil {
+		return "", models.Token{}, err
+	}
+	b, err := random(24)
+	if err != nil {
+		return "", models.Token{}, err
+	}
+	secret := Prefix + base64.RawURLEncoding.EncodeToString(b)
+	t := &stored{
+		Token: models.Token{
+			ID:      hex.EncodeToString(id),
+			Name:    name,
+			Scopes:  append([]string(nil), scopes...),
+			Created: time.Now().UTC(),
+		},
+		Hash: hash(secret),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens := append(s.tokens[:len(s.tokens):len(s.tokens)], t)
+	if err = s.save(tokens); err != nil {
+		return "", models.Token{}, err
+	}
+	s.tokens = tokens
+	return secret, t.Token, nil
+}
+
+// Revoke deletes the token with the id, it returns false if there wasn't one. If it can't be
+// saved the token isn't revoked, otherwise it'd come back after a restart.
+func (s *Store) Revoke(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, t := range s.tokens {
+		if t.ID == id {
+			tokens := append(s.tokens[:i:i], s.tokens[i+1:]...)
+			if err := s.save(tokens); err != nil {
+				return true, err
+			}
+			s.tokens = tokens
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// List returns every token, oldest first
+func (s *Store) List() []models.Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]models.Token, len(s.tokens))
+	for i, t := range s.tokens {
+		list[i] = t.Token
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list
+}
+
+// Check returns the token the secret belongs to if it has the scope
+func (s *Store) Check(secret, scope string) (models.Token, bool) {
+	if s == nil || len(secret) <= len(Prefix) || secret[:len(Prefix)] != Prefix {
+		return models.Token{}, false
+	}
+	h := []byte(hash(secret))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare(h, []byte(t.Hash)) == 1 {
+			if !t.Has(scope) {
+				return t.Token, false
+			}
+			t.LastUsed = time.Now().UTC() // only in memory, not worth a write every request
+			return t.Token, true
+		}
+	}
+	return models.Token{}, false
+}
+
+// save writes the tokens to the file, they only replace the ones in memory once it worked. Must
+// hold the lock.
+func (s *Store) save(tokens []*stored) error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), ".tokens-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save tokens: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Chmod(0600)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save tokens: %w", err)
+	}
+	return nil
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// random returns n random bytes
+func random(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to make token: %w", err)
+	}
+	return b, nil
+}
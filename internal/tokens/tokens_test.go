@@ -0,0 +1,105 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/tokens/tokens_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the tokens module for the csgo sync application.
+*/
+
+package tokens
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+func TestTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal("failed to open store: ", err)
+	}
+	secret, tok, err := s.Create("lan box", []string{models.ScopeSync})
+	if err != nil {
+		t.Fatal("failed to create token: ", err)
+	}
+	if !strings.HasPrefix(secret, Prefix) || tok.ID == "" {
+		t.Error("got secret: ", secret, " id: ", tok.ID)
+	}
+	if _, _, err = s.Create("", nil); err != ErrNoName {
+		t.Error("token without a name got: ", err)
+	}
+
+	if got, ok := s.Check(secret, models.ScopeSync); !ok || got.ID != tok.ID {
+		t.Error("valid token didn't check out")
+	}
+	if _, ok := s.Check(secret, "upload"); ok {
+		t.Error("token passed for a scope it doesn't have")
+	}
+	if _, ok := s.Check(secret+"x", models.ScopeSync); ok {
+		t.Error("wrong secret passed")
+	}
+	if _, ok := s.Check("password", models.ScopeSync); ok {
+		t.Error("non token passed")
+	}
+
+	// tokens survive a restart, the secret doesn't get saved
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal("failed to reopen store: ", err)
+	}
+	if list := s.List(); len(list) != 1 || list[0].Name != "lan box" {
+		t.Fatal("reopened store has: ", list)
+	}
+	if _, ok := s.Check(secret, models.ScopeSync); !ok {
+		t.Error("token didn't check out after reopening")
+	}
+
+	if ok, err := s.Revoke(tok.ID); !ok || err != nil {
+		t.Error("failed to revoke: ", ok, err)
+	}
+	if _, ok := s.Check(secret, models.ScopeSync); ok {
+		t.Error("revoked token passed")
+	}
+	if ok, _ := s.Revoke(tok.ID); ok {
+		t.Error("revoked a token twice")
+	}
+}
+
+func TestFailedSaveChangesNothing(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tokens")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(filepath.Join(dir, "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, tok, err := s.Create("lan box", []string{models.ScopeSync})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the directory is gone so saving fails
+	if err = os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.Revoke(tok.ID); !ok || err == nil {
+		t.Error("revoke got: ", ok, err)
+	}
+	if _, ok := s.Check(secret, models.ScopeSync); !ok {
+		t.Error("token was revoked without being saved")
+	}
+	if _, _, err := s.Create("other", nil); err == nil {
+		t.Error("create didn't fail")
+	}
+	if list := s.List(); len(list) != 1 || list[0].ID != tok.ID {
+		t.Error("tokens got: ", list)
+	}
+}
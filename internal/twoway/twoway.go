@@ -0,0 +1,230 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/twoway/twoway.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains working out what a two way sync has to do. The client keeps the hash map
+	both sides agreed on after the last sync (the base) so it can tell a file that changed here
+	from one that changed on the server, if both changed it's a conflict.
+*/
+
+package twoway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kthomas422/csgosync/internal/models"
+	"github.com/kthomas422/csgosync/internal/version"
+)
+
+// ParsePolicy checks the conflict policy from the config, empty is server-wins
+func ParsePolicy(policy string) (string, error) {
+	switch policy {
+	case "":
+		return models.PolicyServerWins, nil
+	case models.PolicyServerWins, models.PolicyClientWins, models.PolicyKeepBoth:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %q, use %s, %s or %s",
+		policy, models.PolicyServerWins, models.PolicyClientWins, models.PolicyKeepBoth)
+}
+
+// Base is the hash map we and the server agreed on after the last two way sync with it
+type Base struct {
+	URI      string            `json:"uri"`
+	Protocol int               `json:"protocol"` // the hashes are only comparable within a protocol
+	Files    map[string]string `json:"files"`
+}
+
+// LoadBase reads the base from path. It's empty if there isn't one yet or it's from a different
+// server or protocol, then nothing has a base and every difference is either new or a conflict.
+func LoadBase(path, uri string) (*Base, error) {
+	base := &Base{URI: uri, Protocol: version.Protocol, Files: make(map[string]string)}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return base, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read base: %w", err)
+	}
+	var saved Base
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return nil, fmt.Errorf("failed to parse base %s: %w", path, err)
+	}
+	if saved.URI == uri && saved.Protocol == version.Protocol && saved.Files != nil {
+		base.Files = saved.Files
+	}
+	return base, nil
+}
+
+// Save writes the base to path
+func (b *Base) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create base directory: %w", err)
+	}
+	data, err := json.MarshalIndent(b, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write base: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write base: %w", err)
+	}
+	return nil
+}
+
+// Plan is what a two way sync does
+type Plan struct {
+	Download  []string          // files to get from the server
+	Upload    []string          // files to send to the server
+	Renames   map[string]string // our copies to rename before uploading them (keep-both)
+	Conflicts []models.Conflict // files that changed on both sides and how they're settled
+	Removed   []string          // files the server got rid of since the last sync, left alone
+}
+
+// MakePlan works out what to do from our files, the base and what the server said about our
+// files. Files the server deleted aren't uploaded again and files we deleted are downloaded
+// again, deleting isn't synced.
+func MakePlan(local, base map[string]string, resp *models.FileResponse, policy string, now time.Time) Plan {
+	plan := Plan{Renames: make(map[string]string)}
+	for _, file := range resp.Files {
+		ours, have := local[file]
+		theirs, was := resp.Hashes[file], base[file]
+		switch {
+		case !have, ours == was:
+			plan.Download = append(plan.Download, file) // changed on the server
+		case theirs == was:
+			plan.Upload = append(plan.Upload, file) // changed here
+		default:
+			conflict := models.Conflict{File: file, Local: ours, Server: theirs, Base: was, Resolution: policy}
+			switch policy {
+			case models.PolicyClientWins:
+				plan.Upload = append(plan.Upload, file)
+			case models.PolicyKeepBoth:
+				conflict.Kept = ConflictName(file, now)
+				plan.Renames[file] = conflict.Kept
+				plan.Upload = append(plan.Upload, conflict.Kept)
+				plan.Download = append(plan.Download, file)
+			default:
+				plan.Download = append(plan.Download, file)
+			}
+			plan.Conflicts = append(plan.Conflicts, conflict)
+		}
+	}
+	for _, file := range resp.Extra {
+		ours, have := local[file]
+		if !have {
+			continue
+		}
+		if _, retired := resp.Retired[file]; retired {
+			plan.Removed = append(plan.Removed, file) // and it's staying that way
+			continue
+		}
+		if was, ok := base[file]; ok && was == ours {
+			plan.Removed = append(plan.Removed, file) // we had the same copy, so the server deleted it
+			continue
+		}
+		plan.Upload = append(plan.Upload, file)
+	}
+	sort.Strings(plan.Download)
+	sort.Strings(plan.Upload)
+	sort.Strings(plan.Removed)
+	sort.Slice(plan.Conflicts, func(i, j int) bool { return plan.Conflicts[i].File < plan.Conflicts[j].File })
+	return plan
+}
+
+// ConflictName is what our copy of file is renamed to when keeping both, "de_x.bsp" becomes
+// "de_x.conflict-20201130-154500.bsp"
+func ConflictName(file string, now time.Time) string {
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + ".conflict-" + now.Format("20060102-150405") + ext
+}
+
+// Rename renames our copies of conflicts being kept in dir. Files that couldn't be renamed are
+// dropped from the plan so the server's copy doesn't overwrite them and their conflicts are
+// unresolved.
+func (p *Plan) Rename(dir string) []error {
+	var errs []error
+	for i, conflict := range p.Conflicts {
+		kept, ok := p.Renames[conflict.File]
+		if !ok {
+			continue
+		}
+		if err := os.Rename(filepath.Join(dir, conflict.File), filepath.Join(dir, kept)); err != nil {
+			errs = append(errs, fmt.Errorf("failed to keep %s as %s: %w", conflict.File, kept, err))
+			p.Download = remove(p.Download, conflict.File)
+			p.Upload = remove(p.Upload, kept)
+			delete(p.Renames, conflict.File)
+			p.Conflicts[i].Resolution, p.Conflicts[i].Kept = models.Unresolved, ""
+		}
+	}
+	return errs
+}
+
+// NextBase returns the base after the plan ran, failed are the files that didn't make it across.
+// Files that failed keep their old base so they're tried again next time.
+func (p Plan) NextBase(local, base map[string]string, resp *models.FileResponse, failed map[string]bool) map[string]string {
+	var (
+		next    = make(map[string]string, len(local))
+		diff    = make(map[string]bool, len(resp.Files))
+		extra   = make(map[string]bool, len(resp.Extra))
+		renamed = make(map[string]string, len(p.Renames)) // kept name -> our file
+	)
+	for _, file := range resp.Files {
+		diff[file] = true
+	}
+	for _, file := range resp.Extra {
+		extra[file] = true
+	}
+	for file, kept := range p.Renames {
+		renamed[kept] = file
+	}
+	for file, hash := range base {
+		_, ours := local[file]
+		if ours || diff[file] {
+			next[file] = hash // gone from both sides otherwise
+		}
+	}
+	for file, hash := range local {
+		if !diff[file] && !extra[file] {
+			next[file] = hash // same on both sides
+		}
+	}
+	for _, file := range p.Download {
+		if !failed[file] {
+			next[file] = resp.Hashes[file]
+		}
+	}
+	for _, file := range p.Upload {
+		if failed[file] {
+			continue
+		}
+		if ours, ok := renamed[file]; ok {
+			next[file] = local[ours]
+		} else {
+			next[file] = local[file]
+		}
+	}
+	return next
+}
+
+func remove(list []string, s string) []string {
+	for i, item := range list {
+		if item == s {
+			return append(list[:i:i], list[i+1:]...)
+		}
+	}
+	return list
+}
@@ -0,0 +1,168 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/twoway/twoway_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing the twoway module for the csgo sync application.
+*/
+
+package twoway
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kthomas422/csgosync/internal/models"
+)
+
+var now = time.Date(2020, 11, 30, 15, 45, 0, 0, time.UTC)
+
+// the server has a.bsp (changed there), b.bsp (changed here), c.bsp (changed on both),
+// d.bsp (we don't have it) and doesn't have e.bsp (new here) or f.bsp (deleted there)
+var (
+	local = map[string]string{"a.bsp": "a0", "b.bsp": "b1", "c.bsp": "c1", "e.bsp": "e0", "f.bsp": "f0", "same.bsp": "s0"}
+	base  = map[string]string{"a.bsp": "a0", "b.bsp": "b0", "c.bsp": "c0", "f.bsp": "f0", "same.bsp": "s0"}
+	resp  = &models.FileResponse{
+		Files:  []string{"a.bsp", "b.bsp", "c.bsp", "d.bsp"},
+		Hashes: map[string]string{"a.bsp": "a1", "b.bsp": "b0", "c.bsp": "c2", "d.bsp": "d0"},
+		Extra:  []string{"e.bsp", "f.bsp"},
+	}
+)
+
+func TestMakePlan(t *testing.T) {
+	tests := []struct {
+		policy   string
+		download []string
+		upload   []string
+		kept     string
+	}{
+		{models.PolicyServerWins, []string{"a.bsp", "c.bsp", "d.bsp"}, []string{"b.bsp", "e.bsp"}, ""},
+		{models.PolicyClientWins, []string{"a.bsp", "d.bsp"}, []string{"b.bsp", "c.bsp", "e.bsp"}, ""},
+		{models.PolicyKeepBoth, []string{"a.bsp", "c.bsp", "d.bsp"},
+			[]string{"b.bsp", "c.conflict-20201130-154500.bsp", "e.bsp"}, "c.conflict-20201130-154500.bsp"},
+	}
+	for _, test := range tests {
+		plan := MakePlan(local, base, resp, test.policy, now)
+		if !reflect.DeepEqual(plan.Download, test.download) {
+			t.Error("[", test.policy, "] download got: ", plan.Download, " wanted: ", test.download)
+		}
+		if !reflect.DeepEqual(plan.Upload, test.upload) {
+			t.Error("[", test.policy, "] upload got: ", plan.Upload, " wanted: ", test.upload)
+		}
+		if !reflect.DeepEqual(plan.Removed, []string{"f.bsp"}) {
+			t.Error("[", test.policy, "] removed got: ", plan.Removed)
+		}
+		want := []models.Conflict{{File: "c.bsp", Local: "c1", Server: "c2", Base: "c0", Resolution: test.policy, Kept: test.kept}}
+		if !reflect.DeepEqual(plan.Conflicts, want) {
+			t.Error("[", test.policy, "] conflicts got: ", plan.Conflicts, " wanted: ", want)
+		}
+	}
+}
+
+func TestNoBase(t *testing.T) {
+	// without a base every file that's different on both sides is a conflict
+	plan := MakePlan(local, nil, resp, models.PolicyServerWins, now)
+	if len(plan.Conflicts) != 3 {
+		t.Error("got ", len(plan.Conflicts), " conflicts, wanted 3: ", plan.Conflicts)
+	}
+	if !reflect.DeepEqual(plan.Upload, []string{"e.bsp", "f.bsp"}) {
+		t.Error("upload got: ", plan.Upload)
+	}
+}
+
+func TestNextBase(t *testing.T) {
+	plan := MakePlan(local, base, resp, models.PolicyKeepBoth, now)
+	next := plan.NextBase(local, base, resp, map[string]bool{"d.bsp": true})
+	want := map[string]string{
+		"a.bsp":                          "a1", // downloaded
+		"b.bsp":                          "b1", // uploaded
+		"c.bsp":                          "c2", // server's copy downloaded
+		"c.conflict-20201130-154500.bsp": "c1", // our copy uploaded
+		"e.bsp":                          "e0", // uploaded
+		"f.bsp":                          "f0", // deleted on the server, kept so it isn't uploaded
+		"same.bsp":                       "s0",
+	}
+	if !reflect.DeepEqual(next, want) {
+		t.Error("got: ", next, " wanted: ", want)
+	}
+}
+
+func TestRename(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "c.bsp"), []byte("ours"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	plan := Plan{
+		Download: []string{"c.bsp", "g.bsp"},
+		Upload:   []string{"c.conflict.bsp", "g.conflict.bsp"},
+		Renames:  map[string]string{"c.bsp": "c.conflict.bsp", "g.bsp": "g.conflict.bsp"},
+		Conflicts: []models.Conflict{
+			{File: "c.bsp", Resolution: models.PolicyKeepBoth, Kept: "c.conflict.bsp"},
+			{File: "g.bsp", Resolution: models.PolicyKeepBoth, Kept: "g.conflict.bsp"},
+		},
+	}
+	if errs := plan.Rename(dir); len(errs) != 1 {
+		t.Error("got errors: ", errs, " wanted 1 for g.bsp")
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "c.conflict.bsp")); err != nil || string(b) != "ours" {
+		t.Error("c.bsp wasn't renamed: ", err)
+	}
+	if !reflect.DeepEqual(plan.Download, []string{"c.bsp"}) || !reflect.DeepEqual(plan.Upload, []string{"c.conflict.bsp"}) {
+		t.Error("g.bsp wasn't dropped, download: ", plan.Download, " upload: ", plan.Upload)
+	}
+	if plan.Conflicts[0].Kept != "c.conflict.bsp" || plan.Conflicts[1].Resolution != models.Unresolved {
+		t.Error("conflicts got: ", plan.Conflicts)
+	}
+}
+
+func TestBase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".csgosync", "base.json")
+	b, err := LoadBase(path, "http://a")
+	if err != nil || len(b.Files) != 0 {
+		t.Fatal("missing base got: ", b, err)
+	}
+	b.Files["x.bsp"] = "x0"
+	if err := b.Save(path); err != nil {
+		t.Fatal("failed to save: ", err)
+	}
+	if b, err = LoadBase(path, "http://a"); err != nil || b.Files["x.bsp"] != "x0" {
+		t.Error("saved base got: ", b, err)
+	}
+	if b, err = LoadBase(path, "http://b"); err != nil || len(b.Files) != 0 {
+		t.Error("other server's base got: ", b, err)
+	}
+	if err := ioutil.WriteFile(path, []byte(`{"uri":"http://a","files":{"x.bsp":"x0"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = LoadBase(path, "http://a"); err != nil || len(b.Files) != 0 {
+		t.Error("protocol 1 base got: ", b, err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("tmp file left behind: ", err)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	if p, err := ParsePolicy(""); err != nil || p != models.PolicyServerWins {
+		t.Error("empty got: ", p, err)
+	}
+	if _, err := ParsePolicy("newest-wins"); err == nil {
+		t.Error("unknown policy didn't fail")
+	}
+}
+
+func TestRetired(t *testing.T) {
+	// a file the server retired isn't uploaded even if it changed here
+	retired := *resp
+	retired.Retired = map[string]models.Tombstone{"e.bsp": {Hash: "e-old"}}
+	plan := MakePlan(local, base, &retired, models.PolicyServerWins, now)
+	if !reflect.DeepEqual(plan.Upload, []string{"b.bsp"}) || !reflect.DeepEqual(plan.Removed, []string{"e.bsp", "f.bsp"}) {
+		t.Error("upload got: ", plan.Upload, " removed got: ", plan.Removed)
+	}
+}
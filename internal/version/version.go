@@ -0,0 +1,29 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/version/version.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the version of csgosync and the protocol it speaks.
+*/
+
+package version
+
+// Version of csgosync, set when building with
+// -ldflags "-X github.com/kthomas422/csgosync/internal/version.Version=1.2.3"
+var Version = "dev"
+
+// Protocol is the version of the api under /v1 this build speaks. It goes up whenever a client
+// and server of different protocols would get the wrong answer from each other (like the hashes
+// changing), new endpoints are advertised as features instead.
+//
+// Every change to the hashes bumps it:
+//   - builds from before /v1 gave every file after the first the same hash. They don't speak any
+//     protocol, so protocol 2 clients and servers refuse them.
+//   - 1: every file got its own hash but the whole read buffer was hashed
+//   - 2: file hashes are the plain sha1 of the file, the same as sha1sum
+const Protocol = 2
+
+// Protocols are the protocol versions the server can serve
+var Protocols = []int{Protocol}
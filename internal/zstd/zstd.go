@@ -0,0 +1,119 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/zstd/zstd.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains zstd compression with the zstd program for the csgo sync application.
+*/
+
+package zstd
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Program returns the path of the zstd program. zstd is optional so an empty path looks for zstd
+// and returns "" if it isn't installed, a path that was set has to exist.
+func Program(path string) (string, error) {
+	if path == "" {
+		found, err := exec.LookPath("zstd")
+		if err != nil {
+			return "", nil
+		}
+		return found, nil
+	}
+	found, err := exec.LookPath(path)
+	if err != nil {
+		return "", fmt.Errorf("can't find zstd program: %w", err)
+	}
+	return found, nil
+}
+
+// Compress compresses src into dst with the program
+func Compress(program string, dst io.Writer, src io.Reader) error {
+	cmd := exec.Command(program, "-c", "-q", "-19")
+	cmd.Stdin = src
+	cmd.Stdout = dst
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Reader decompresses what it reads from the underlying reader with the program while it's being
+// read. It has to be closed to stop the program.
+type Reader struct {
+	cmd    *exec.Cmd
+	out    io.ReadCloser
+	stderr strings.Builder
+	copied chan error // what feeding the program returned
+	err    error      // what Read returns from now on
+	waited bool
+}
+
+// NewReader starts the program decompressing r
+func NewReader(program string, r io.Reader) (*Reader, error) {
+	zr := &Reader{cmd: exec.Command(program, "-d", "-c", "-q"), copied: make(chan error, 1)}
+	zr.cmd.Stderr = &zr.stderr
+	in, err := zr.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if zr.out, err = zr.cmd.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	if err = zr.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start zstd: %w", err)
+	}
+	// fed here instead of by exec so stopping the program early doesn't wait on r
+	go func() {
+		_, err := io.Copy(in, r)
+		if cerr := in.Close(); err == nil {
+			err = cerr
+		}
+		zr.copied <- err
+	}()
+	return zr, nil
+}
+
+// Read reads decompressed bytes, it only returns io.EOF if the program decompressed everything
+func (zr *Reader) Read(p []byte) (int, error) {
+	if zr.err != nil {
+		return 0, zr.err
+	}
+	n, err := zr.out.Read(p)
+	if err == io.EOF {
+		zr.waited = true
+		if werr := zr.cmd.Wait(); werr != nil {
+			err = fmt.Errorf("failed to decompress: %w %s", werr, strings.TrimSpace(zr.stderr.String()))
+			// a broken download is the real reason, not the program complaining it was cut off
+			select {
+			case cerr := <-zr.copied:
+				if cerr != nil {
+					err = cerr
+				}
+			default:
+			}
+		}
+	}
+	zr.err = err
+	return n, err
+}
+
+// Close stops the program if it didn't finish
+func (zr *Reader) Close() error {
+	if zr.waited {
+		return nil
+	}
+	zr.waited = true
+	_ = zr.cmd.Process.Kill()
+	_ = zr.cmd.Wait()
+	return nil
+}
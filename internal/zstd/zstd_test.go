@@ -0,0 +1,120 @@
+// Copyright 2020 Kyle Thomas. All rights reserved.
+
+/*
+	File:		csgosync/internal/zstd/zstd_test.go
+	Language:	Go 1.15
+	Dev Env:	Linux 5.9
+
+	This file contains the functions for testing zstd compression with the zstd program.
+*/
+
+package zstd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// program returns the zstd program or skips the test if it isn't installed
+func program(t *testing.T) string {
+	t.Helper()
+	path, err := Program("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path == "" {
+		t.Skip("no zstd program")
+	}
+	return path
+}
+
+func TestProgram(t *testing.T) {
+	if _, err := Program("/does/not/exist/zstd"); err == nil {
+		t.Error("no error for a program that doesn't exist")
+	}
+	path := program(t)
+	if got, err := Program(path); err != nil || got != path {
+		t.Error("[", path, "] got: ", got, err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	zstd := program(t)
+	data := strings.Repeat("de_dust2 ", 100000)
+	var compressed bytes.Buffer
+	if err := Compress(zstd, &compressed, strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if compressed.Len() >= len(data) {
+		t.Error("not smaller: ", compressed.Len())
+	}
+	zr, err := NewReader(zstd, &compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(zr)
+	if err != nil || string(b) != data {
+		t.Error("decompressed got: ", len(b), " bytes ", err)
+	}
+	if err := zr.Close(); err != nil {
+		t.Error("close got: ", err)
+	}
+}
+
+// brokenReader returns its data and then fails like a dropped connection
+type brokenReader struct{ r io.Reader }
+
+var errBroken = errors.New("connection reset")
+
+func (br brokenReader) Read(p []byte) (int, error) {
+	n, err := br.r.Read(p)
+	if err == io.EOF {
+		return n, errBroken
+	}
+	return n, err
+}
+
+func TestBadData(t *testing.T) {
+	zstd := program(t)
+	var compressed bytes.Buffer
+	if err := Compress(zstd, &compressed, strings.NewReader(strings.Repeat("de_dust2 ", 100000))); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]io.Reader{
+		"not zstd":  strings.NewReader("this isn't zstd"),
+		"truncated": bytes.NewReader(compressed.Bytes()[:compressed.Len()/2]),
+		"broken":    brokenReader{bytes.NewReader(compressed.Bytes()[:compressed.Len()/2])},
+	}
+	for name, r := range tests {
+		zr, err := NewReader(zstd, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ioutil.ReadAll(zr)
+		if err == nil {
+			t.Error("[", name, "] expected an error")
+		}
+		if name == "broken" && !errors.Is(err, errBroken) {
+			t.Error("[", name, "] got: ", err, " wanted: ", errBroken)
+		}
+		_ = zr.Close()
+	}
+}
+
+func TestCloseEarly(t *testing.T) {
+	zstd := program(t)
+	// never ends, like a download that stalls
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	zr, err := NewReader(zstd, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := zr.Close(); err != nil {
+		t.Error("got: ", err)
+	}
+}